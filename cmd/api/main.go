@@ -13,6 +13,9 @@ import (
 	"time"
 
 	"github.com/hnimtadd/run/internal/api"
+	"github.com/hnimtadd/run/internal/build"
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/version"
 
@@ -33,6 +36,10 @@ func main() {
 		slog.Error("could not load envFile", "at", envFile, "msg", err.Error())
 		return
 	}
+	// the api server and the ingress must agree on the domain endpoints are served at by slug.
+	if edgeDomain := os.Getenv("EDGE_DOMAIN"); edgeDomain != "" {
+		settings.EdgeDomain = edgeDomain
+	}
 
 	// init mongo store
 	url := os.Getenv("MONGO_URL")
@@ -59,6 +66,7 @@ func main() {
 	st, err := store.NewMongoStore(db)
 	if err != nil {
 		slog.Error("cannot init store with given mongo client", "msg", err.Error())
+		return
 	}
 
 	logStore, err := store.NewMongoLogStore(db)
@@ -66,6 +74,12 @@ func main() {
 		slog.Error("cannot init mongo log store", "msg", err)
 	}
 
+	metricStore, err := store.NewMongoMetricStore(db)
+	if err != nil {
+		slog.Error("cannot init mongo metric store", "msg", err)
+		return
+	}
+
 	creds := credentials.NewStaticV4(os.Getenv("MINIO_USERNAME"), os.Getenv("MINIO_PASSWORD"), "")
 	minioClient, err := minio.New(os.Getenv("MINIO_URL"), &minio.Options{
 		Creds:  creds,
@@ -83,13 +97,22 @@ func main() {
 	serverConfig := api.ServerConfig{
 		Addr:    fmt.Sprintf(":%v", os.Getenv("API_ADDR")),
 		Version: version.Version,
+		// the ingress stops runtimes of rolled back deployments right away if its admin address is reachable.
+		IngressAdminURL: os.Getenv("INGRESS_ADMIN_URL"),
 	}
-	apiServer := api.NewServer(st, logStore, blobStore, serverConfig)
+	deployer := deploy.NewPipeline(st, blobStore, build.NewBuilder(), settings.DeployWorkers, settings.DeployQueueSize)
+	apiServer := api.NewServer(st, logStore, blobStore, metricStore, deployer, serverConfig)
 
 	go func() {
 		panic(apiServer.ListenAndServe())
 	}()
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go store.RunRetentionSweeper(backgroundCtx, st, logStore, settings.LogRetentionSweepInterval)
+	go deployer.Run(backgroundCtx)
+	go deploy.NewHealthMonitor(st, metricStore, settings.HealthCheckInterval).Run(backgroundCtx)
+
 	exitCh := make(chan os.Signal, 1)
 	signal.Notify(exitCh, os.Interrupt)
 	signal.Notify(exitCh, syscall.SIGTERM)
@@ -14,6 +14,8 @@ import (
 	"time"
 
 	"github.com/hnimtadd/run/internal/actrs"
+	"github.com/hnimtadd/run/internal/metrics"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/version"
 	"github.com/minio/minio-go/v7"
@@ -39,6 +41,10 @@ func main() {
 		slog.Error("could not load envFile", "at", envFile, "msg", err.Error())
 		return
 	}
+	// the api server and the ingress must agree on the domain endpoints are served at by slug.
+	if edgeDomain := os.Getenv("EDGE_DOMAIN"); edgeDomain != "" {
+		settings.EdgeDomain = edgeDomain
+	}
 
 	// init mongo store
 	url := os.Getenv("MONGO_URL")
@@ -65,6 +71,7 @@ func main() {
 	st, err := store.NewMongoStore(db)
 	if err != nil {
 		slog.Error("cannot init store with given mongo client", "msg", err.Error())
+		return
 	}
 
 	logStore, err := store.NewMongoLogStore(db)
@@ -72,7 +79,27 @@ func main() {
 		slog.Error("failed to init log store", "msg", err.Error())
 	}
 
-	inMemoryCache := store.NewMemoryModCacher()
+	metricStore, err := store.NewMongoMetricStore(db)
+	if err != nil {
+		slog.Error("failed to init metric store", "msg", err.Error())
+		return
+	}
+
+	modCacheDir := os.Getenv("MOD_CACHE_DIR")
+	if modCacheDir == "" {
+		modCacheDir = settings.ModCacheDir
+	}
+	modCache, err := store.NewDiskModCacher(modCacheDir, settings.MaxModCacheSize)
+	if err != nil {
+		slog.Error("cannot init mod cache", "at", modCacheDir, "msg", err.Error())
+		return
+	}
+	metrics.RegisterModCacheSize(modCache.Len)
+
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go store.RunModCacheSweeper(sweeperCtx, st, modCache, settings.ModCacheSweepInterval)
+
 	creds := credentials.NewStaticV4(
 		os.Getenv("MINIO_USERNAME"),
 		os.Getenv("MINIO_PASSWORD"),
@@ -97,6 +124,13 @@ func main() {
 		slog.Error("cannot init blob store", "msg", err.Error())
 	}
 
+	// the admin endpoints are not authenticated, they are only served on their own address, which should not be
+	// exposed publicly.
+	adminAddr := ""
+	if port := os.Getenv("ADMIN_ADDR"); port != "" {
+		adminAddr = fmt.Sprintf(":%v", port)
+	}
+
 	system := actor.NewActorSystem()
 	defer system.Shutdown()
 	provider := automanaged.New()
@@ -114,22 +148,26 @@ func main() {
 		cluster.WithKinds(
 			actrs.NewServerKind(
 				&actrs.ServerConfig{
-					Addr:    fmt.Sprintf(":%v", os.Getenv("WASM_ADDR")),
-					Store:   st,
-					Version: version.Version,
+					Addr:      fmt.Sprintf(":%v", os.Getenv("WASM_ADDR")),
+					AdminAddr: adminAddr,
+					Store:     st,
+					Version:   version.Version,
+				}),
+			actrs.NewRuntimeManagerKind(
+				&actrs.RuntimeManagerConfig{
+					Store: st,
 				}),
-			actrs.NewRuntimeManagerKind(),
 			actrs.NewRuntimeKind(
 				&actrs.RuntimeConfig{
 					Store:     st,
-					Cache:     inMemoryCache,
+					Cache:     modCache,
 					LogStore:  logStore,
 					BlobStore: blobStore,
 				}),
 			actrs.NewMetricAggregatorKind(
 				&actrs.MetricAggregatorConfig{
 					Version:       version.Version,
-					MetricStore:   nil, // TODO: implement this
+					MetricStore:   metricStore,
 					MetadataStore: st,
 				},
 			),
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError is a response of the api server with a non 2xx status.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("api server responded %d: %s", e.Status, e.Message)
+}
+
+// client calls the routes of api.Server.
+type client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newClient(baseURL string) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (c *client) url(path string, query url.Values) string {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends the request and decodes the json response into out, if out is not nil.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rsp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rsp.Body.Close() }()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return &apiError{Status: rsp.StatusCode, Message: errorMessage(b)}
+	}
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// errorMessage extracts the message of utils.ErrorResponse, falling back to the raw body.
+func errorMessage(b []byte) string {
+	var rsp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(b, &rsp); err == nil && rsp.Error != "" {
+		return rsp.Error
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (c *client) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, "", out)
+}
+
+func (c *client) sendJSON(ctx context.Context, method, path string, in any, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, nil, bytes.NewReader(b), "application/json", out)
+}
+
+// formFile is a file part of a multipart form.
+type formFile struct {
+	name string
+	data io.Reader
+}
+
+// upload posts the files as parts of the field of a multipart form, along with the values as plain fields.
+func (c *client) upload(ctx context.Context, path string, field string, files []formFile, values url.Values, out any) error {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	for key := range values {
+		if err := form.WriteField(key, values.Get(key)); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile(field, file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.data); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, path, nil, body, form.FormDataContentType(), out)
+}
+
+// stream reads the server-sent events of the route and calls fn with the data of each event until ctx is done.
+func (c *client) stream(ctx context.Context, path string, query url.Values, fn func(data []byte) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(path, query), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// the stream is long lived, only the default client without timeout fits it.
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = rsp.Body.Close() }()
+	if rsp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(rsp.Body)
+		return &apiError{Status: rsp.StatusCode, Message: errorMessage(b)}
+	}
+
+	scanner := bufio.NewScanner(rsp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if err := fn([]byte(data)); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,797 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
+)
+
+var (
+	endpointColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"SLUG", "slug"}, {"RUNTIME", "runtime"}, {"ACTIVE DEPLOYMENT", "activeDeploymentID"}, {"CREATED AT", "createdAt"},
+	}
+	deploymentColumns = []column{
+		{"ID", "id"}, {"ENDPOINT", "endpointID"}, {"STATUS", "status"}, {"HASH", "hash"}, {"CREATED AT", "createdAt"},
+	}
+	activationColumns = []column{
+		{"ENDPOINT", "endpointID"}, {"ACTIVE DEPLOYMENT", "activeDeploymentID"}, {"PREVIOUS DEPLOYMENT", "previousDeploymentID"},
+	}
+	eventColumns = []column{
+		{"KIND", "kind"}, {"DEPLOYMENT", "deploymentID"}, {"ACTIVE DEPLOYMENT", "activeDeploymentID"}, {"REASON", "reason"}, {"CREATED AT", "createdAt"},
+	}
+	bucketColumns = []column{
+		{"START", "start"}, {"END", "end"}, {"REQUESTS", "numRequest"}, {"ERRORS", "numError"}, {"ERROR RATE", "errorRate"},
+		{"P50 MS", "p50Ms"}, {"P95 MS", "p95Ms"}, {"P99 MS", "p99Ms"},
+	}
+)
+
+var commands = []*command{
+	{
+		name:  "status",
+		short: "check that the api server is up",
+		run: func(e *env, _ *flag.FlagSet, args []string) error {
+			var rsp map[string]any
+			if err := e.client.getJSON(e.ctx, "/status", nil, &rsp); err != nil {
+				return err
+			}
+			return e.out.print(rsp, column{"STATUS", "status"})
+		},
+	},
+	{
+		name:  "endpoint",
+		short: "create and inspect endpoints",
+		sub: []*command{
+			{
+				name:  "create",
+				args:  "-name name -runtime go|python [-slug slug] [-env KEY=VALUE]...",
+				short: "create an endpoint",
+				flags: func(fs *flag.FlagSet) {
+					fs.String("name", "", "name of the endpoint")
+					fs.String("slug", "", "unique slug addressing the endpoint wherever its id does, derived from the name if unset")
+					fs.String("runtime", "", "runtime of the endpoint, go or python")
+					fs.Var(&keyValues{}, "env", "environment variable of the endpoint as KEY=VALUE, could be repeated")
+					fs.Bool("streaming", false, "stream request and response bodies, go runtime only")
+					fs.Int("warm-instances", 0, "initialized instances of reactor modules kept by each runtime")
+					fs.Int("instances", 0, "runtimes serving a deployment side by side")
+					fs.Int("max-queue-depth", 0, "requests queued on each runtime before requests are answered with 429")
+					fs.Uint("max-memory-pages", 0, "memory limit of a request in wasm pages of 64KiB")
+					fs.Duration("max-wall-time", 0, "wall time limit of a request")
+					fs.Int64("max-stdout-size", 0, "output limit of a request in bytes")
+					fs.Duration("retention-max-age", 0, "how long logs are kept, a negative one keeps them by request count only")
+					fs.Int("retention-max-requests", 0, "logs of the latest requests to keep")
+					fs.Var(&stringValues{}, "host", "custom domain served by the endpoint, could be repeated")
+					healthFlags(fs)
+					historyFlags(fs)
+				},
+				run: runEndpointCreate,
+			},
+			{
+				name:  "get",
+				args:  "<endpoint id|slug>",
+				short: "show an endpoint and its deploy history",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp map[string]any
+					if err := e.client.getJSON(e.ctx, "/endpoint/"+args[0], nil, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, endpointColumns...)
+				},
+			},
+			{
+				name:  "retention",
+				args:  "<endpoint id|slug> [-max-age duration] [-max-requests n]",
+				short: "replace the log retention of an endpoint",
+				flags: func(fs *flag.FlagSet) {
+					fs.Duration("max-age", 0, "how long logs are kept, the default retention if unset, a negative one keeps them by request count only")
+					fs.Int("max-requests", 0, "logs of the latest requests to keep, all of them if unset")
+				},
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					policy := types.RetentionPolicy{
+						MaxAge:      maxAge(durationFlag(fs, "max-age")),
+						MaxRequests: intFlag(fs, "max-requests"),
+					}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPut, "/endpoint/"+args[0]+"/retention", policy, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"RETENTION", "retention"}, column{"DELETED", "deleted"})
+				},
+			},
+			{
+				name:  "hosts",
+				args:  "<endpoint id|slug> [-host host]...",
+				short: "replace the custom domains of an endpoint",
+				flags: func(fs *flag.FlagSet) {
+					fs.Var(&stringValues{}, "host", "custom domain served by the endpoint, could be repeated, none removes them all")
+				},
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					params := map[string]any{"hosts": []string(*fs.Lookup("host").Value.(*stringValues))}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPut, "/endpoint/"+args[0]+"/hosts", params, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"HOST", "host"}, column{"HOSTS", "hosts"})
+				},
+			},
+			{
+				name:  "health",
+				args:  "<endpoint id|slug> [-max-error-rate rate] [-max-p95 duration] [-health-window duration] [-health-min-requests n]",
+				short: "replace the rules newly active deployments of an endpoint are rolled back by",
+				flags: healthFlags,
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPut, "/endpoint/"+args[0]+"/health", healthPolicy(fs), &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"HEALTH", "health"})
+				},
+			},
+			{
+				name:  "events",
+				args:  "<endpoint id|slug>",
+				short: "list what happened to an endpoint on its own, such as rollbacks of unhealthy deployments",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp []any
+					if err := e.client.getJSON(e.ctx, "/endpoint/"+args[0]+"/events", nil, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, eventColumns...)
+				},
+			},
+			{
+				name:  "activate",
+				args:  "<endpoint id|slug> <deployment id>",
+				short: "make a deployment the active one of an endpoint, rolling it back or forward",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 2 {
+						return usagef("expect endpoint id and deployment id")
+					}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPost, "/endpoint/"+args[0]+"/activate", map[string]any{"deploymentID": args[1]}, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, activationColumns...)
+				},
+			},
+			{
+				name:  "history",
+				args:  "<endpoint id|slug> [-history-keep n] [-history-max-age duration]",
+				short: "replace which deployments of an endpoint are kept when its history is pruned",
+				flags: historyFlags,
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPut, "/endpoint/"+args[0]+"/history", historyPolicy(fs), &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"HISTORY", "history"})
+				},
+			},
+			{
+				name:  "prune",
+				args:  "<endpoint id|slug>",
+				short: "remove the deployments of an endpoint its history policy does not keep, along with their blobs",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp map[string]any
+					if err := e.client.do(e.ctx, http.MethodPost, "/endpoint/"+args[0]+"/prune", nil, nil, "", &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"HISTORY", "history"}, column{"DELETED", "deleted"})
+				},
+			},
+			{
+				name:  "traffic",
+				args:  "<endpoint id|slug> [-split deploymentID=percent]...",
+				short: "split the live requests of an endpoint between its active deployment and canaries",
+				flags: func(fs *flag.FlagSet) {
+					fs.Var(&stringValues{}, "split", "percent of the requests served by the deployment, could be repeated, none sends all of them to the active deployment")
+				},
+				run: runEndpointTraffic,
+			},
+			{
+				name:  "promote",
+				args:  "<endpoint id|slug> [-deployment id]",
+				short: "make a canary the active deployment of an endpoint",
+				flags: func(fs *flag.FlagSet) {
+					fs.String("deployment", "", "canary to promote, the one serving the most requests if unset")
+				},
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					params := map[string]any{"deploymentID": stringFlag(fs, "deployment")}
+					var rsp map[string]any
+					if err := e.client.sendJSON(e.ctx, http.MethodPost, "/endpoint/"+args[0]+"/promote", params, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"ACTIVE DEPLOYMENT", "activeDeploymentID"}, column{"RETIRED", "retired"})
+				},
+			},
+			{
+				name:  "metrics",
+				args:  "<endpoint id|slug> [-from time] [-to time] [-step duration]",
+				short: "show request metrics of an endpoint",
+				flags: metricFlags,
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					return printMetrics(e, fs, "/endpoint/"+args[0]+"/metrics")
+				},
+			},
+		},
+	},
+	{
+		name:  "deploy",
+		args:  "<endpoint id|slug> <file.wasm> | -source <endpoint id|slug> <dir | file.tar.gz | file.go...> [-canary percent] [-wait]",
+		short: "deploy a wasm module, or go source built by the server, to an endpoint which activates it once deployed",
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("source", false, "deploy go source which the server builds to wasm, go runtime only")
+			fs.Int("canary", 0, "percent of the live requests served by the deployment next to the active one, all of them if unset")
+			fs.Bool("wait", false, "wait until the deployment is active or failed and print its build")
+		},
+		run: runDeploy,
+	},
+	{
+		name:  "deployment",
+		short: "list and inspect deployments",
+		sub: []*command{
+			{
+				name:  "list",
+				args:  "<endpoint id|slug>",
+				short: "list deployments of an endpoint",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect endpoint id")
+					}
+					var rsp []any
+					if err := e.client.getJSON(e.ctx, "/endpoint/"+args[0]+"/deploy", nil, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, deploymentColumns...)
+				},
+			},
+			{
+				name:  "get",
+				args:  "<deployment id>",
+				short: "show a deployment",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect deployment id")
+					}
+					var rsp map[string]any
+					if err := e.client.getJSON(e.ctx, "/deployment/"+args[0], nil, &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, deploymentColumns...)
+				},
+			},
+			{
+				name:  "build",
+				args:  "<deployment id>",
+				short: "show the status and build output of a deployment",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect deployment id")
+					}
+					return printBuild(e, args[0])
+				},
+			},
+			{
+				name:  "blob",
+				args:  "<deployment id>",
+				short: "show the blob of a deployment and what the inspection of its module found",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect deployment id")
+					}
+					return printBlob(e, args[0])
+				},
+			},
+			{
+				name:  "metrics",
+				args:  "<deployment id> [-from time] [-to time] [-step duration]",
+				short: "show request metrics of a deployment",
+				flags: metricFlags,
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect deployment id")
+					}
+					return printMetrics(e, fs, "/deployment/"+args[0]+"/metrics")
+				},
+			},
+		},
+	},
+	{
+		name:  "rollback",
+		args:  "<endpoint id|slug> [-deployment id]",
+		short: "roll an endpoint back to the given or the previous deployment, which keeps every deployment",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("deployment", "", "deployment to roll back to, the previous deployment if unset")
+		},
+		run: func(e *env, fs *flag.FlagSet, args []string) error {
+			if len(args) != 1 {
+				return usagef("expect endpoint id")
+			}
+			query := url.Values{}
+			if deployment := stringFlag(fs, "deployment"); deployment != "" {
+				query.Set("deploymentID", deployment)
+			}
+			var rsp map[string]any
+			if err := e.client.do(e.ctx, http.MethodPost, "/endpoint/"+args[0]+"/rollback", query, nil, "", &rsp); err != nil {
+				return err
+			}
+			return e.out.print(rsp, activationColumns...)
+		},
+	},
+	{
+		name:  "log",
+		short: "read, tail and purge request logs",
+		sub: []*command{
+			{
+				name:  "list",
+				args:  "<deployment id> [-since time] [-until time] [-q text] [-order asc|desc] [-limit n] [-level level] [-all]",
+				short: "list logs of a deployment",
+				flags: func(fs *flag.FlagSet) {
+					fs.String("since", "", "only logs created at or after, unix timestamp or RFC3339")
+					fs.String("until", "", "only logs created before, unix timestamp or RFC3339")
+					fs.String("q", "", "only logs containing the text")
+					fs.String("order", "", "asc or desc by creation time, desc if unset")
+					fs.Int("limit", 0, "logs per page")
+					fs.String("cursor", "", "cursor of the page to start from")
+					fs.String("level", "", "minimum level of log entries")
+					fs.Bool("all", false, "follow the cursors until the last page")
+				},
+				run: runLogList,
+			},
+			{
+				name:  "tail",
+				args:  "<deployment id> [-request id] [-status code|class] [-level level]",
+				short: "follow logs of a deployment as they are appended",
+				flags: func(fs *flag.FlagSet) {
+					fs.String("request", "", "only logs of the request")
+					fs.String("status", "", "only logs of requests answered with the status code or class, such as 5xx")
+					fs.String("level", "", "minimum level of log entries")
+				},
+				run: runLogTail,
+			},
+			{
+				name:  "get",
+				args:  "<request id> [-level level]",
+				short: "show the log of a request",
+				flags: func(fs *flag.FlagSet) {
+					fs.String("level", "", "minimum level of log entries")
+				},
+				run: func(e *env, fs *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect request id")
+					}
+					var rsp map[string]any
+					if err := e.client.getJSON(e.ctx, "/request/"+args[0]+"/log", queryOf(fs, "level"), &rsp); err != nil {
+						return err
+					}
+					return printLogs(e, []any{rsp})
+				},
+			},
+			{
+				name:  "purge",
+				args:  "<deployment id>",
+				short: "remove all logs of a deployment",
+				run: func(e *env, _ *flag.FlagSet, args []string) error {
+					if len(args) != 1 {
+						return usagef("expect deployment id")
+					}
+					var rsp map[string]any
+					if err := e.client.do(e.ctx, http.MethodDelete, "/deployment/"+args[0]+"/log", nil, nil, "", &rsp); err != nil {
+						return err
+					}
+					return e.out.print(rsp, column{"DEPLOYMENT", "deploymentID"}, column{"DELETED", "deleted"})
+				},
+			},
+		},
+	},
+}
+
+func runEndpointCreate(e *env, fs *flag.FlagSet, args []string) error {
+	if len(args) != 0 {
+		return usagef("unexpected arguments %v", args)
+	}
+	name, runtime := stringFlag(fs, "name"), stringFlag(fs, "runtime")
+	if name == "" || runtime == "" {
+		return usagef("-name and -runtime are required")
+	}
+	params := map[string]any{
+		"name":          name,
+		"slug":          stringFlag(fs, "slug"),
+		"runtime":       runtime,
+		"environment":   map[string]string(*fs.Lookup("env").Value.(*keyValues)),
+		"streaming":     fs.Lookup("streaming").Value.(flag.Getter).Get().(bool),
+		"warmInstances": intFlag(fs, "warm-instances"),
+		"hosts":         []string(*fs.Lookup("host").Value.(*stringValues)),
+		"limits": types.ResourceLimits{
+			MaxMemoryPages: uint32(fs.Lookup("max-memory-pages").Value.(flag.Getter).Get().(uint)),
+			MaxWallTime:    durationFlag(fs, "max-wall-time").Milliseconds(),
+			MaxStdoutSize:  fs.Lookup("max-stdout-size").Value.(flag.Getter).Get().(int64),
+		},
+		"concurrency": types.ConcurrencyPolicy{
+			Instances:     intFlag(fs, "instances"),
+			MaxQueueDepth: intFlag(fs, "max-queue-depth"),
+		},
+		"retention": types.RetentionPolicy{
+			MaxAge:      maxAge(durationFlag(fs, "retention-max-age")),
+			MaxRequests: intFlag(fs, "retention-max-requests"),
+		},
+		"health":  healthPolicy(fs),
+		"history": historyPolicy(fs),
+	}
+	var rsp map[string]any
+	if err := e.client.sendJSON(e.ctx, http.MethodPost, "/endpoint", params, &rsp); err != nil {
+		return err
+	}
+	return e.out.print(rsp, endpointColumns...)
+}
+
+func runEndpointTraffic(e *env, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return usagef("expect endpoint id")
+	}
+	// the split is kept in the given order, which decides what deployment each client is kept on.
+	traffic := []types.TrafficTarget{}
+	for _, raw := range *fs.Lookup("split").Value.(*stringValues) {
+		deploymentID, weight, ok := strings.Cut(raw, "=")
+		if !ok {
+			return usagef("expect deploymentID=percent, got %q", raw)
+		}
+		target := types.TrafficTarget{}
+		var err error
+		if target.DeploymentID, err = uuid.Parse(deploymentID); err != nil {
+			return usagef("invalid deployment id %q", deploymentID)
+		}
+		if target.Weight, err = strconv.Atoi(weight); err != nil {
+			return usagef("invalid percent %q", weight)
+		}
+		traffic = append(traffic, target)
+	}
+	var rsp map[string]any
+	if err := e.client.sendJSON(e.ctx, http.MethodPut, "/endpoint/"+args[0]+"/traffic", map[string]any{"traffic": traffic}, &rsp); err != nil {
+		return err
+	}
+	return e.out.print(rsp, column{"ENDPOINT", "endpointID"}, column{"TRAFFIC", "traffic"})
+}
+
+func runDeploy(e *env, fs *flag.FlagSet, args []string) error {
+	var (
+		field = "blob"
+		files []formFile
+	)
+	if boolFlag(fs, "source") {
+		if len(args) < 2 {
+			return usagef("expect endpoint id and source")
+		}
+		var err error
+		if files, err = sourceFiles(args[1:]); err != nil {
+			return err
+		}
+		field = "source"
+	} else {
+		if len(args) != 2 {
+			return usagef("expect endpoint id and wasm file")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		files = []formFile{{name: filepath.Base(args[1]), data: bytes.NewReader(data)}}
+	}
+
+	var rsp map[string]any
+	values := url.Values{}
+	if canary := intFlag(fs, "canary"); canary > 0 {
+		values.Set("canary", strconv.Itoa(canary))
+	}
+	if err := e.client.upload(e.ctx, "/endpoint/"+args[0]+"/deploy", field, files, values, &rsp); err != nil {
+		return err
+	}
+	if !boolFlag(fs, "wait") {
+		return e.out.print(rsp, deploymentColumns...)
+	}
+
+	deploymentID, _ := rsp["id"].(string)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		var deployment map[string]any
+		if err := e.client.getJSON(e.ctx, "/deployment/"+deploymentID, nil, &deployment); err != nil {
+			return err
+		}
+		status, _ := deployment["status"].(string)
+		if types.DeploymentStatus(status).IsTerminal() {
+			if err := printBuild(e, deploymentID); err != nil {
+				return err
+			}
+			if status == string(types.DeploymentStatusFailed) {
+				return fmt.Errorf("deploy failed: %v", deployment["error"])
+			}
+			return nil
+		}
+		select {
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// printBuild prints the build of the deployment, tables print its output as it is below the status.
+func printBuild(e *env, deploymentID string) error {
+	var rsp map[string]any
+	if err := e.client.getJSON(e.ctx, "/deployment/"+deploymentID+"/build", nil, &rsp); err != nil {
+		return err
+	}
+	if e.out.format == outputJSON {
+		return e.out.printJSON(rsp)
+	}
+	if err := e.out.print(rsp, column{"DEPLOYMENT", "id"}, column{"STATUS", "status"}, column{"ERROR", "error"}); err != nil {
+		return err
+	}
+	if log, _ := rsp["log"].(string); log != "" {
+		fmt.Fprintln(e.stdout)
+		fmt.Fprintln(e.stdout, strings.TrimRight(log, "\n"))
+	}
+	return nil
+}
+
+// printBlob prints the blob of the deployment, tables print what its module imports and exports below it.
+func printBlob(e *env, deploymentID string) error {
+	var rsp map[string]any
+	if err := e.client.getJSON(e.ctx, "/deployment/"+deploymentID+"/blob", nil, &rsp); err != nil {
+		return err
+	}
+	if e.out.format == outputJSON {
+		return e.out.printJSON(rsp)
+	}
+	module, _ := rsp["module"].(map[string]any)
+	if module != nil {
+		rsp["valid"] = module["valid"]
+	}
+	if err := e.out.print(rsp, column{"DEPLOYMENT", "deploymentID"}, column{"HASH", "hash"}, column{"VALID", "valid"}); err != nil {
+		return err
+	}
+	for _, section := range []string{"imports", "exports", "problems"} {
+		items, _ := module[section].([]any)
+		if len(items) == 0 {
+			continue
+		}
+		fmt.Fprintf(e.stdout, "\n%s:\n", section)
+		for _, item := range items {
+			fmt.Fprintf(e.stdout, "  %v\n", item)
+		}
+	}
+	return nil
+}
+
+func runLogList(e *env, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return usagef("expect deployment id")
+	}
+	query := queryOf(fs, "since", "until", "q", "order", "cursor", "level")
+	if limit := intFlag(fs, "limit"); limit > 0 {
+		query.Set("limit", fmt.Sprint(limit))
+	}
+	all := boolFlag(fs, "all")
+
+	for {
+		var page struct {
+			Logs       []any  `json:"logs"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := e.client.getJSON(e.ctx, "/deployment/"+args[0]+"/log", query, &page); err != nil {
+			return err
+		}
+		if e.out.format == outputJSON && !all {
+			return e.out.printJSON(page)
+		}
+		if err := printLogs(e, page.Logs); err != nil {
+			return err
+		}
+		if !all || page.NextCursor == "" {
+			if page.NextCursor != "" {
+				fmt.Fprintf(e.stdout, "next page: -cursor %s\n", page.NextCursor)
+			}
+			return nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+func runLogTail(e *env, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return usagef("expect deployment id")
+	}
+	query := queryOf(fs, "status", "level")
+	if request := stringFlag(fs, "request"); request != "" {
+		query.Set("requestID", request)
+	}
+	return e.client.stream(e.ctx, "/deployment/"+args[0]+"/log/stream", query, func(data []byte) error {
+		var log map[string]any
+		if err := json.Unmarshal(data, &log); err != nil {
+			return err
+		}
+		return printLogs(e, []any{log})
+	})
+}
+
+// printLogs prints request logs, tables print a line per log entry.
+func printLogs(e *env, logs []any) error {
+	if e.out.format == outputJSON {
+		for _, log := range logs {
+			b, err := json.Marshal(log)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(e.stdout, string(b))
+		}
+		return nil
+	}
+	for _, raw := range logs {
+		log, _ := raw.(map[string]any)
+		entries, _ := log["entries"].([]any)
+		for _, rawEntry := range entries {
+			entry, _ := rawEntry.(map[string]any)
+			millis, _ := entry["time"].(float64)
+			at := time.UnixMilli(int64(millis)).Format(time.RFC3339)
+			fmt.Fprintf(e.stdout, "%s  %-5s  %s  %v  %s\n", at, entry["level"], log["requestID"], formatValue(log["status"]), entry["message"])
+		}
+	}
+	return nil
+}
+
+func metricFlags(fs *flag.FlagSet) {
+	fs.String("from", "", "start of the range, unix timestamp or RFC3339, an hour before -to if unset")
+	fs.String("to", "", "end of the range, unix timestamp or RFC3339, now if unset")
+	fs.String("step", "", "size of the buckets, such as 1m")
+}
+
+func printMetrics(e *env, fs *flag.FlagSet, path string) error {
+	var rsp map[string]any
+	if err := e.client.getJSON(e.ctx, path, queryOf(fs, "from", "to", "step"), &rsp); err != nil {
+		return err
+	}
+	if e.out.format == outputJSON {
+		return e.out.printJSON(rsp)
+	}
+	return e.out.print(rsp["buckets"], bucketColumns...)
+}
+
+func healthFlags(fs *flag.FlagSet) {
+	fs.Float64("max-error-rate", 0, "fraction of requests answered with 5xx, such as 0.05, above which a newly active deployment is rolled back")
+	fs.Duration("max-p95", 0, "p95 latency above which a newly active deployment is rolled back")
+	fs.Duration("health-window", 0, "how long after its activation a deployment is checked, the default window if unset")
+	fs.Int("health-min-requests", 0, "requests served before a deployment is checked, the default if unset")
+}
+
+func healthPolicy(fs *flag.FlagSet) types.HealthPolicy {
+	return types.HealthPolicy{
+		MaxErrorRate: fs.Lookup("max-error-rate").Value.(flag.Getter).Get().(float64),
+		MaxP95:       durationFlag(fs, "max-p95").Milliseconds(),
+		Window:       int64(durationFlag(fs, "health-window") / time.Second),
+		MinRequests:  intFlag(fs, "health-min-requests"),
+	}
+}
+
+func historyFlags(fs *flag.FlagSet) {
+	fs.Int("history-keep", 0, "latest deployments kept when the history is pruned, the default if unset")
+	fs.Duration("history-max-age", 0, "age beyond which deployments are removed when the history is pruned, any age if unset")
+}
+
+func historyPolicy(fs *flag.FlagSet) types.HistoryPolicy {
+	return types.HistoryPolicy{
+		MaxDeployments: intFlag(fs, "history-keep"),
+		MaxAge:         int64(durationFlag(fs, "history-max-age") / time.Second),
+	}
+}
+
+// keyValues is a repeatable KEY=VALUE flag.
+type keyValues map[string]string
+
+func (kv *keyValues) String() string {
+	if kv == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*kv))
+	for key, value := range *kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (kv *keyValues) Set(raw string) error {
+	key, value, ok := strings.Cut(raw, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expect KEY=VALUE, got %q", raw)
+	}
+	(*kv)[key] = value
+	return nil
+}
+
+// stringValues is a repeatable string flag.
+type stringValues []string
+
+func (sv *stringValues) String() string {
+	if sv == nil {
+		return ""
+	}
+	return strings.Join(*sv, ",")
+}
+
+func (sv *stringValues) Set(raw string) error {
+	*sv = append(*sv, raw)
+	return nil
+}
+
+func stringFlag(fs *flag.FlagSet, name string) string {
+	return fs.Lookup(name).Value.String()
+}
+
+func boolFlag(fs *flag.FlagSet, name string) bool {
+	return fs.Lookup(name).Value.(flag.Getter).Get().(bool)
+}
+
+func intFlag(fs *flag.FlagSet, name string) int {
+	return fs.Lookup(name).Value.(flag.Getter).Get().(int)
+}
+
+func durationFlag(fs *flag.FlagSet, name string) time.Duration {
+	return fs.Lookup(name).Value.(flag.Getter).Get().(time.Duration)
+}
+
+// maxAge returns the max age of a retention policy in seconds, a negative duration keeps logs by request count only.
+func maxAge(d time.Duration) int64 {
+	if d < 0 {
+		return types.KeepByCount
+	}
+	return int64(d / time.Second)
+}
+
+// queryOf returns the query of the non-empty string flags, named the same as their query parameters.
+func queryOf(fs *flag.FlagSet, names ...string) url.Values {
+	query := url.Values{}
+	for _, name := range names {
+		if value := stringFlag(fs, name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/hnimtadd/run/internal/errors"
+)
+
+const defaultAPIURL = "http://localhost:3000"
+
+// Config is the profile file of the cli, located at $RUN_CONFIG or ~/.config/run/config.json:
+//
+//	{
+//		"current": "local",
+//		"profiles": {
+//			"local": {"url": "http://localhost:3000", "output": "table"}
+//		}
+//	}
+type Config struct {
+	Current  string             `json:"current"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile is the api server the cli talks to and how it prints the results.
+type Profile struct {
+	URL    string `json:"url"`
+	Output string `json:"output"` // json or table
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("RUN_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "run", "config.json"), nil
+}
+
+// loadProfile returns the named profile, or the current one if name is empty.
+// A missing config file is not an error, the default profile is used instead.
+func loadProfile(name string) (Profile, error) {
+	profile := Profile{URL: defaultAPIURL, Output: outputTable}
+	path, err := configPath()
+	if err != nil {
+		return profile, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if name != "" {
+			return profile, errors.Newf("profile %q not found, config file %s does not exist", name, path)
+		}
+		return profile, nil
+	}
+	if err != nil {
+		return profile, err
+	}
+
+	cfg := new(Config)
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return profile, errors.Newf("cannot parse config file %s, %v", path, err)
+	}
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		return profile, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile, errors.Newf("profile %q not found in %s", name, path)
+	}
+	if p.URL != "" {
+		profile.URL = p.URL
+	}
+	if p.Output != "" {
+		profile.Output = p.Output
+	}
+	return profile, nil
+}
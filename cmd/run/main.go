@@ -0,0 +1,218 @@
+/*
+run cmd is the command-line client of the api server.
+
+	run [global flags] <command> [flags] [args]
+
+The api server is read from the profile file, see Config, and could be overridden with the global flags.
+The exit code is 0 on success, 1 if the api server rejected the request, 2 on invalid usage,
+3 if the api server could not be reached, 4 if the requested resource was not found and 130 if the command was
+interrupted.
+*/
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitUnavailable = 3
+	exitNotFound    = 4
+	exitInterrupted = 130 // as shells report commands killed by SIGINT
+)
+
+// usageError is returned by commands invoked with invalid arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// env is what commands run with.
+type env struct {
+	ctx    context.Context
+	client *client
+	out    *printer
+	stdout io.Writer
+}
+
+// command is a node of the command tree, either runnable or a group of sub commands.
+type command struct {
+	name  string
+	args  string // synopsis of the arguments
+	short string
+	flags func(fs *flag.FlagSet) // defines the flags of the command
+	run   func(e *env, fs *flag.FlagSet, args []string) error
+	sub   []*command
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("run", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	profileName := global.String("profile", "", "profile of the config file to use")
+	apiURL := global.String("url", "", "url of the api server, overrides the profile")
+	output := global.String("o", "", "output format, json or table, overrides the profile")
+	global.Usage = func() { printUsage(stderr, commands, "") }
+	if err := global.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	profile, err := loadProfile(*profileName)
+	if err != nil {
+		fmt.Fprintln(stderr, "run:", err)
+		return exitUsage
+	}
+	if env := os.Getenv("RUN_API_URL"); env != "" {
+		profile.URL = env
+	}
+	if *apiURL != "" {
+		profile.URL = *apiURL
+	}
+	if *output != "" {
+		profile.Output = *output
+	}
+	if profile.Output != outputJSON && profile.Output != outputTable {
+		fmt.Fprintf(stderr, "run: unknown output format %q, expect json or table\n", profile.Output)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	e := &env{
+		ctx:    ctx,
+		client: newClient(profile.URL),
+		out:    &printer{w: stdout, format: profile.Output},
+		stdout: stdout,
+	}
+	return dispatch(e, commands, global.Args(), "", stderr)
+}
+
+// dispatch finds the command named by args in cmds and runs it.
+func dispatch(e *env, cmds []*command, args []string, prefix string, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr, cmds, prefix)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	var cmd *command
+	for _, c := range cmds {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "run: unknown command %q\n", strings.TrimSpace(prefix+" "+args[0]))
+		printUsage(stderr, cmds, prefix)
+		return exitUsage
+	}
+	name := strings.TrimSpace(prefix + " " + cmd.name)
+	if len(cmd.sub) > 0 {
+		return dispatch(e, cmd.sub, args[1:], name, stderr)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: run %s %s\n\n%s\n", name, cmd.args, cmd.short)
+		fs.PrintDefaults()
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	err = cmd.run(e, fs, positional)
+	if err == nil {
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "run %s: %v\n", name, err)
+	var usageErr *usageError
+	var apiErr *apiError
+	switch {
+	case stderrors.As(err, &usageErr):
+		fs.Usage()
+		return exitUsage
+	case stderrors.Is(err, context.Canceled):
+		return exitInterrupted
+	case stderrors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		return exitNotFound
+	case stderrors.As(err, &apiErr):
+		return exitError
+	case isUnavailable(err):
+		return exitUnavailable
+	}
+	return exitError
+}
+
+// parseInterspersed parses flags which could be given before, after or between positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// isUnavailable reports whether the api server could not be reached, either it could not be dialed or it did not
+// respond in time.
+func isUnavailable(err error) bool {
+	var opErr *net.OpError
+	if stderrors.As(err, &opErr) {
+		return true
+	}
+	var timeoutErr interface{ Timeout() bool }
+	return stderrors.As(err, &timeoutErr) && timeoutErr.Timeout()
+}
+
+func printUsage(w io.Writer, cmds []*command, prefix string) {
+	if prefix == "" {
+		fmt.Fprintln(w, "usage: run [-profile name] [-url url] [-o json|table] <command> [flags] [args]")
+	} else {
+		fmt.Fprintf(w, "usage: run %s <command> [flags] [args]\n", prefix)
+	}
+	fmt.Fprintln(w, "\ncommands:")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.short)
+	}
+}
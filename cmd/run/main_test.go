@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setupEnv isolates the cli from the profile file and environment of the host.
+func setupEnv(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("RUN_CONFIG", path)
+	t.Setenv("RUN_API_URL", "")
+	return path
+}
+
+// serve starts an api server answering every request with the status and body.
+func serve(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	setupEnv(t)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		url    string // overrides the url of the api server
+		args   []string
+		code   int
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+			body:   `{"status":"ok"}`,
+			args:   []string{"status"},
+			code:   exitOK,
+		},
+		{
+			name:   "help",
+			status: http.StatusOK,
+			args:   []string{"help"},
+			code:   exitOK,
+		},
+		{
+			name:   "rejected",
+			status: http.StatusBadRequest,
+			body:   `{"error":"invalid runtime"}`,
+			args:   []string{"endpoint", "create", "-name", "hello", "-runtime", "rust"},
+			code:   exitError,
+		},
+		{
+			name:   "no command",
+			status: http.StatusOK,
+			code:   exitUsage,
+		},
+		{
+			name:   "unknown command",
+			status: http.StatusOK,
+			args:   []string{"endpoint", "rename"},
+			code:   exitUsage,
+		},
+		{
+			name:   "missing arguments",
+			status: http.StatusOK,
+			args:   []string{"endpoint", "get"},
+			code:   exitUsage,
+		},
+		{
+			name:   "unknown output",
+			status: http.StatusOK,
+			args:   []string{"-o", "yaml", "status"},
+			code:   exitUsage,
+		},
+		{
+			name: "unavailable",
+			url:  closed.URL,
+			args: []string{"status"},
+			code: exitUnavailable,
+		},
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+			body:   `{"error":"endpoint not found"}`,
+			args:   []string{"endpoint", "get", "hello"},
+			code:   exitNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url := test.url
+			if url == "" {
+				url = serve(t, test.status, test.body).URL
+			}
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			code := run(append([]string{"-url", url}, test.args...), stdout, stderr)
+			require.Equal(t, test.code, code, stderr.String())
+		})
+	}
+}
+
+func TestRun_Interrupt(t *testing.T) {
+	setupEnv(t)
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	// the interrupt is sent once the request is in flight, which is when run is notified of it.
+	go func() {
+		<-received
+		_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	start := time.Now()
+	stderr := new(bytes.Buffer)
+	require.Equal(t, exitInterrupted, run([]string{"-url", server.URL, "status"}, io.Discard, stderr), stderr.String())
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestRun_Profile(t *testing.T) {
+	path := setupEnv(t)
+	var hit []string
+	newServer := func(name string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hit = append(hit, name)
+			_, _ = io.WriteString(w, `{"status":"ok"}`)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	cfg := Config{
+		Current: "local",
+		Profiles: map[string]Profile{
+			"local":   {URL: newServer("local"), Output: outputTable},
+			"staging": {URL: newServer("staging"), Output: outputJSON},
+		},
+	}
+	b, err := json.Marshal(cfg)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, b, 0o600))
+
+	tests := []struct {
+		name   string
+		env    string // RUN_API_URL
+		args   []string
+		server string
+		json   bool
+	}{
+		{name: "current profile", args: []string{"status"}, server: "local"},
+		{name: "named profile", args: []string{"-profile", "staging", "status"}, server: "staging", json: true},
+		{name: "env overrides profile", env: newServer("env"), args: []string{"-profile", "staging", "status"}, server: "env", json: true},
+		{name: "flag overrides env", env: newServer("env"), args: []string{"-url", newServer("flag"), "status"}, server: "flag"},
+		{name: "flag overrides output", args: []string{"-profile", "staging", "-o", "table", "status"}, server: "staging"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hit = nil
+			t.Setenv("RUN_API_URL", test.env)
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			require.Equal(t, exitOK, run(test.args, stdout, stderr), stderr.String())
+			require.Equal(t, []string{test.server}, hit)
+			require.Equal(t, test.json, json.Valid(stdout.Bytes()), stdout.String())
+		})
+	}
+
+	stderr := new(bytes.Buffer)
+	require.Equal(t, exitUsage, run([]string{"-profile", "prod", "status"}, io.Discard, stderr))
+	require.Contains(t, stderr.String(), `profile "prod" not found`)
+}
+
+// upload is a deploy request received by the api server.
+type upload struct {
+	path  string
+	field string
+	files map[string][]byte
+	query map[string]string
+}
+
+// serveDeploy starts an api server which records the deploy requests.
+func serveDeploy(t *testing.T) (string, *upload) {
+	received := new(upload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseMultipartForm(1<<20))
+		received.path = r.URL.Path
+		received.files = make(map[string][]byte)
+		received.query = make(map[string]string)
+		for key := range r.MultipartForm.Value {
+			received.query[key] = r.MultipartForm.Value[key][0]
+		}
+		for field, headers := range r.MultipartForm.File {
+			received.field = field
+			for _, header := range headers {
+				f, err := header.Open()
+				require.Nil(t, err)
+				b, err := io.ReadAll(f)
+				require.Nil(t, err)
+				received.files[header.Filename] = b
+			}
+		}
+		_, _ = io.WriteString(w, `{"id":"d1","endpointID":"hello","status":"pending"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func TestRun_DeployBlob(t *testing.T) {
+	setupEnv(t)
+	url, received := serveDeploy(t)
+	module := filepath.Join(t.TempDir(), "hello.wasm")
+	require.Nil(t, os.WriteFile(module, []byte("\x00asm"), 0o600))
+
+	stderr := new(bytes.Buffer)
+	code := run([]string{"-url", url, "deploy", "hello", module, "-canary", "10"}, io.Discard, stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	require.Equal(t, "/endpoint/hello/deploy", received.path)
+	require.Equal(t, "blob", received.field)
+	require.Equal(t, map[string][]byte{"hello.wasm": []byte("\x00asm")}, received.files)
+	require.Equal(t, map[string]string{"canary": "10"}, received.query)
+}
+
+func TestRun_DeploySource(t *testing.T) {
+	setupEnv(t)
+	url, received := serveDeploy(t)
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module hello\n"), 0o600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "handler"), 0o700))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "handler", "handler.go"), []byte("package handler\n"), 0o600))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o700))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o600))
+
+	stderr := new(bytes.Buffer)
+	code := run([]string{"-url", url, "deploy", "-source", "hello", dir}, io.Discard, stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	require.Equal(t, "source", received.field)
+	require.Empty(t, received.query)
+	require.Contains(t, received.files, "source.tar.gz")
+
+	gz, err := gzip.NewReader(bytes.NewReader(received.files["source.tar.gz"]))
+	require.Nil(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{"go.mod", "handler/handler.go", "main.go"}, names)
+
+	// files are sent as they are.
+	code = run([]string{"-url", url, "deploy", "-source", "hello", filepath.Join(dir, "main.go"), filepath.Join(dir, "go.mod")}, io.Discard, stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	require.Equal(t, map[string][]byte{"main.go": []byte("package main\n"), "go.mod": []byte("module hello\n")}, received.files)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// column is a column of table output, key is the json key of the value in the printed objects.
+type column struct {
+	title string
+	key   string
+}
+
+// printer prints results of the api server either as indented json or as a table.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print prints v, which is the decoded json response. Tables print objects, or lists of objects,
+// with given columns, any other value is printed as json.
+func (p *printer) print(v any, columns ...column) error {
+	if p.format == outputJSON || len(columns) == 0 {
+		return p.printJSON(v)
+	}
+
+	var rows []map[string]any
+	switch value := v.(type) {
+	case map[string]any:
+		rows = []map[string]any{value}
+	case []any:
+		for _, item := range value {
+			row, ok := item.(map[string]any)
+			if !ok {
+				return p.printJSON(v)
+			}
+			rows = append(rows, row)
+		}
+	case nil:
+	default:
+		return p.printJSON(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	titles := make([]string, 0, len(columns))
+	for _, c := range columns {
+		titles = append(titles, c.title)
+	}
+	fmt.Fprintln(tw, strings.Join(titles, "\t"))
+	for _, row := range rows {
+		values := make([]string, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, formatValue(row[c.key]))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) printJSON(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// formatValue formats a json value as a single table cell.
+func formatValue(v any) string {
+	switch value := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		if value == "" {
+			return "-"
+		}
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, formatValue(value[key])))
+		}
+		return strings.Join(pairs, ",")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
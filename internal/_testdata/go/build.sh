@@ -1 +1,4 @@
-GOOS=wasip1 GOARCH=wasm go build -o internal/_testdata/helloworld.wasm internal/_testdata/helloworld.go
\ No newline at end of file
+GOOS=wasip1 GOARCH=wasm go build -o internal/_testdata/go/helloworld.wasm internal/_testdata/go/helloworld.go
+GOOS=wasip1 GOARCH=wasm go build -o internal/_testdata/go/stream.wasm internal/_testdata/go/stream.go
+# reactors export their handler with go:wasmexport, which needs go1.24 or later.
+GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o internal/_testdata/go/reactor.wasm internal/_testdata/go/reactor.go
@@ -0,0 +1,25 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	sdk "github.com/hnimtadd/run/sdk/go"
+)
+
+// served counts the requests served by the instance, it is kept between requests of a warm instance.
+var served int
+
+func handle(w http.ResponseWriter, _ *http.Request) {
+	served++
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "served %d", served)
+}
+
+func init() {
+	sdk.Serve(http.HandlerFunc(handle))
+}
+
+func main() {}
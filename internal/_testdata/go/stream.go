@@ -0,0 +1,41 @@
+//go:build ignore
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	sdk "github.com/hnimtadd/run/sdk/go"
+)
+
+// handle echoes the request body in upper case, flushing every chunk as soon as it is read.
+func handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	buf := make([]byte, 4)
+	for {
+		n, err := r.Body.Read(buf)
+		if n > 0 {
+			_, _ = w.Write(bytes.ToUpper(buf[:n]))
+			w.(http.Flusher).Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Println("hello, this is a streamed request_log.go")
+	fmt.Fprintln(os.Stderr, `{"level":"warn","msg":"streamed to stderr"}`)
+}
+
+//export _start
+func main() {
+	sdk.Handle(http.HandlerFunc(handle))
+}
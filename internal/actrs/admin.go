@@ -0,0 +1,81 @@
+package actrs
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
+)
+
+// runtimeStatsTimeout bounds how long the runtimes are waited for when they are listed, busy runtimes answer once
+// they are done with their current request.
+const runtimeStatsTimeout = time.Second
+
+// RuntimeResponse is a live runtime of the ingress, listed by GET /admin/runtimes.
+type RuntimeResponse struct {
+	DeploymentID string                `json:"deploymentID"`
+	PID          string                `json:"pid"`
+	InFlight     int                   `json:"inFlight"`
+	Draining     bool                  `json:"draining"`
+	Stats        *message.RuntimeStats `json:"stats,omitempty"` // missing if the runtime did not answer in time
+}
+
+// handleAdminRuntimes lists the live runtimes on GET /admin/runtimes, and stops the runtimes of a deployment on
+// DELETE /admin/runtimes/{deploymentID}.
+func (s *Server) handleAdminRuntimes(w http.ResponseWriter, r *http.Request) {
+	deploymentID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/runtimes"), "/")
+	switch {
+	case r.Method == http.MethodGet && deploymentID == "":
+		s.handleListRuntimes(w, r)
+	case r.Method == http.MethodDelete && deploymentID != "":
+		s.handleRemoveRuntimes(w, deploymentID)
+	default:
+		_ = utils.WriteJSON(w, http.StatusMethodNotAllowed, utils.MakeErrorResponse(errors.New("method not allowed")))
+	}
+}
+
+func (s *Server) handleListRuntimes(w http.ResponseWriter, _ *http.Request) {
+	root := s.ctx.ActorSystem().Root
+	res, err := root.RequestFuture(s.runtimeManagerPID, &message.ListRuntimesMessage{}, time.Second*5).Result()
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusServiceUnavailable, utils.MakeErrorResponse(err))
+		return
+	}
+	runtimes, _ := res.([]message.RuntimeInfo)
+
+	rsp := make([]RuntimeResponse, len(runtimes))
+	for i, runtime := range runtimes {
+		rsp[i] = RuntimeResponse{
+			DeploymentID: runtime.DeploymentID,
+			PID:          runtime.PID.String(),
+			InFlight:     runtime.InFlight,
+			Draining:     runtime.Draining,
+		}
+	}
+	// runtimes are asked for their stats all at once so that the listing waits for the slowest of them only.
+	futures := make([]*actor.Future, len(runtimes))
+	for i, runtime := range runtimes {
+		futures[i] = root.RequestFuture(runtime.PID, &message.RuntimeStatsMessage{}, runtimeStatsTimeout)
+	}
+	for i, future := range futures {
+		if res, err := future.Result(); err == nil {
+			rsp[i].Stats, _ = res.(*message.RuntimeStats)
+		}
+	}
+	_ = utils.WriteJSON(w, http.StatusOK, rsp)
+}
+
+func (s *Server) handleRemoveRuntimes(w http.ResponseWriter, deploymentID string) {
+	if _, err := uuid.Parse(deploymentID); err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+		return
+	}
+	s.ctx.ActorSystem().Root.Send(s.runtimeManagerPID, &message.RemoveRuntimeMessage{DeploymentID: deploymentID})
+	_ = utils.WriteJSON(w, http.StatusAccepted, map[string]string{"deploymentID": deploymentID})
+}
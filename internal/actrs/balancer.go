@@ -0,0 +1,165 @@
+package actrs
+
+import (
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Balancer spreads the requests of deployments over their runtimes by the requests in flight on each of them, and
+// tells when runtimes could be stopped without dropping requests. It is owned by the runtime manager and is not safe
+// for concurrent use.
+type Balancer struct {
+	deployments map[string][]*balancedRuntime
+}
+
+type balancedRuntime struct {
+	pid      *actor.PID
+	index    int // of the runtime among the runtimes of its deployment, which is part of its identity
+	inFlight int
+	draining bool // no more requests are given to the runtime, it is stopped once they are served
+}
+
+func NewBalancer() *Balancer {
+	return &Balancer{deployments: make(map[string][]*balancedRuntime)}
+}
+
+// Acquire returns the least loaded runtime of the deployment and counts the request on it, until Release. A runtime
+// is spawned when all runtimes are busy and the deployment has fewer than the instances of the policy, and
+// errors.ErrDeploymentSaturated is returned when every runtime already queues the max queue depth of the policy.
+func (b *Balancer) Acquire(deploymentID string, policy types.ConcurrencyPolicy, spawn func(index int) *actor.PID) (*actor.PID, error) {
+	policy = policy.WithDefaults()
+	runtimes := b.deployments[deploymentID]
+
+	var (
+		least   *balancedRuntime
+		serving int
+		indexes = make(map[int]bool, len(runtimes))
+	)
+	for _, runtime := range runtimes {
+		indexes[runtime.index] = true
+		// runtimes beyond the instances of the policy are left to drain when the policy shrinks.
+		if runtime.draining || serving == policy.Instances {
+			continue
+		}
+		serving++
+		if least == nil || runtime.inFlight < least.inFlight {
+			least = runtime
+		}
+	}
+	if (least == nil || least.inFlight > 0) && serving < policy.Instances {
+		// the lowest free index is reused, the runtime which had it is stopped by now.
+		index := 0
+		for indexes[index] {
+			index++
+		}
+		least = &balancedRuntime{pid: spawn(index), index: index}
+		b.deployments[deploymentID] = append(runtimes, least)
+	}
+	if least.inFlight >= policy.MaxQueueDepth {
+		return nil, errors.ErrDeploymentSaturated
+	}
+	least.inFlight++
+	return least.pid, nil
+}
+
+// Release counts a request acquired on the runtime as done, it reports whether the runtime was draining and is now
+// idle, in which case it is forgotten and should be stopped.
+func (b *Balancer) Release(deploymentID string, pid *actor.PID) bool {
+	runtime := b.find(deploymentID, pid)
+	if runtime == nil {
+		return false
+	}
+	if runtime.inFlight > 0 {
+		runtime.inFlight--
+	}
+	if runtime.draining && runtime.inFlight == 0 {
+		b.remove(deploymentID, runtime)
+		return true
+	}
+	return false
+}
+
+// Passivate forgets the runtime if it is idle, it reports whether the runtime could be stopped.
+func (b *Balancer) Passivate(deploymentID string, pid *actor.PID) bool {
+	runtime := b.find(deploymentID, pid)
+	if runtime == nil || runtime.inFlight > 0 {
+		return false
+	}
+	b.remove(deploymentID, runtime)
+	return true
+}
+
+// Drain stops giving requests to the runtimes of the deployment. Idle runtimes are forgotten and returned to be
+// stopped, busy ones are returned by Release once they served their requests.
+func (b *Balancer) Drain(deploymentID string) []*actor.PID {
+	var idle []*actor.PID
+	for _, runtime := range b.deployments[deploymentID] {
+		runtime.draining = true
+		if runtime.inFlight == 0 {
+			idle = append(idle, runtime.pid)
+			b.remove(deploymentID, runtime)
+		}
+	}
+	return idle
+}
+
+// Deployments returns the deployments which have runtimes.
+func (b *Balancer) Deployments() []string {
+	deployments := make([]string, 0, len(b.deployments))
+	for deploymentID := range b.deployments {
+		deployments = append(deployments, deploymentID)
+	}
+	return deployments
+}
+
+// Runtimes returns the runtimes of every deployment.
+func (b *Balancer) Runtimes() []message.RuntimeInfo {
+	var runtimes []message.RuntimeInfo
+	for deploymentID, deploymentRuntimes := range b.deployments {
+		for _, runtime := range deploymentRuntimes {
+			runtimes = append(runtimes, message.RuntimeInfo{
+				DeploymentID: deploymentID,
+				PID:          runtime.pid,
+				InFlight:     runtime.inFlight,
+				Draining:     runtime.draining,
+			})
+		}
+	}
+	return runtimes
+}
+
+// InFlight returns the requests in flight on each runtime of the deployment.
+func (b *Balancer) InFlight(deploymentID string) []int {
+	var inFlight []int
+	for _, runtime := range b.deployments[deploymentID] {
+		inFlight = append(inFlight, runtime.inFlight)
+	}
+	return inFlight
+}
+
+func (b *Balancer) find(deploymentID string, pid *actor.PID) *balancedRuntime {
+	for _, runtime := range b.deployments[deploymentID] {
+		if runtime.pid.Equal(pid) {
+			return runtime
+		}
+	}
+	return nil
+}
+
+func (b *Balancer) remove(deploymentID string, runtime *balancedRuntime) {
+	runtimes := b.deployments[deploymentID]
+	for i, other := range runtimes {
+		if other == runtime {
+			runtimes = append(runtimes[:i:i], runtimes[i+1:]...)
+			break
+		}
+	}
+	if len(runtimes) == 0 {
+		delete(b.deployments, deploymentID)
+		return
+	}
+	b.deployments[deploymentID] = runtimes
+}
@@ -0,0 +1,102 @@
+package actrs_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hnimtadd/run/internal/actrs"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalancer(t *testing.T) {
+	balancer := actrs.NewBalancer()
+	var spawned []*actor.PID
+	spawn := func(index int) *actor.PID {
+		pid := actor.NewPID("nonhost", fmt.Sprintf("runtime/%d", index))
+		spawned = append(spawned, pid)
+		return pid
+	}
+	policy := types.ConcurrencyPolicy{Instances: 2, MaxQueueDepth: 2}
+
+	// a runtime is spawned only when the existing ones are busy.
+	first, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	balancer.Release("deployment", first)
+	again, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.Equal(t, first, again)
+	require.Len(t, spawned, 1)
+
+	second, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.NotEqual(t, first, second)
+	require.Len(t, spawned, 2)
+
+	// requests are queued on the least loaded runtime until every queue is full.
+	for i := 0; i < 2; i++ {
+		_, err := balancer.Acquire("deployment", policy, spawn)
+		require.Nil(t, err)
+	}
+	require.Equal(t, []int{2, 2}, balancer.InFlight("deployment"))
+	_, err = balancer.Acquire("deployment", policy, spawn)
+	require.ErrorIs(t, err, errors.ErrDeploymentSaturated)
+	require.Len(t, spawned, 2)
+
+	balancer.Release("deployment", second)
+	pid, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.Equal(t, second, pid)
+
+	// deployments are balanced on their own, with the defaults for unset bounds.
+	pid, err = balancer.Acquire("other", types.ConcurrencyPolicy{}, spawn)
+	require.Nil(t, err)
+	require.Equal(t, []int{1}, balancer.InFlight("other"))
+	balancer.Release("other", pid)
+	balancer.Release("other", pid)
+	require.Equal(t, []int{0}, balancer.InFlight("other"))
+}
+
+func TestBalancer_Drain(t *testing.T) {
+	balancer := actrs.NewBalancer()
+	spawn := func(index int) *actor.PID {
+		return actor.NewPID("nonhost", fmt.Sprintf("runtime/%d", index))
+	}
+	policy := types.ConcurrencyPolicy{Instances: 2, MaxQueueDepth: 1}
+
+	first, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	second, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+
+	// busy runtimes are not passivated.
+	require.False(t, balancer.Passivate("deployment", second))
+	require.False(t, balancer.Release("deployment", second))
+	require.True(t, balancer.Passivate("deployment", second))
+	require.Equal(t, []int{1}, balancer.InFlight("deployment"))
+
+	// the index of the passivated runtime is reused.
+	pid, err := balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.Equal(t, second, pid)
+	require.False(t, balancer.Release("deployment", second))
+
+	// idle runtimes are returned by Drain, busy ones by Release once they are done.
+	require.Equal(t, []*actor.PID{second}, balancer.Drain("deployment"))
+	require.Len(t, balancer.Runtimes(), 1)
+	require.True(t, balancer.Runtimes()[0].Draining)
+	require.True(t, balancer.Release("deployment", first))
+	require.Empty(t, balancer.Runtimes())
+	require.Empty(t, balancer.Deployments())
+
+	// draining runtimes are given no requests, new ones are spawned instead.
+	first, err = balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.Empty(t, balancer.Drain("deployment"))
+	pid, err = balancer.Acquire("deployment", policy, spawn)
+	require.Nil(t, err)
+	require.NotEqual(t, first, pid)
+}
@@ -0,0 +1,69 @@
+package actrs
+
+import (
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+)
+
+// Breaker fails the requests of deployments fast once their runtimes failed repeatedly in a row, rather than
+// initializing runtimes which are bound to fail again. The circuit of a deployment opens after threshold failures,
+// then a single request is let through every cooldown to probe whether the deployment recovered. It is owned by the
+// runtime manager and is not safe for concurrent use.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	circuits  map[string]*circuit
+}
+
+type circuit struct {
+	failures int       // consecutive failures of the runtimes of the deployment
+	openedAt time.Time // when the circuit opened or was last probed
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// Allow returns errors.ErrDeploymentUnavailable if the circuit of the deployment is open, unless the request is let
+// through to probe the deployment.
+func (b *Breaker) Allow(deploymentID string) error {
+	c, ok := b.circuits[deploymentID]
+	if !ok || c.failures < b.threshold {
+		return nil
+	}
+	if time.Since(c.openedAt) < b.cooldown {
+		return errors.ErrDeploymentUnavailable
+	}
+	c.openedAt = time.Now()
+	return nil
+}
+
+// Record counts the outcome of a request of the deployment, it reports whether the failure opened the circuit. A
+// success closes the circuit.
+func (b *Breaker) Record(deploymentID string, failed bool) bool {
+	if !failed {
+		delete(b.circuits, deploymentID)
+		return false
+	}
+	c, ok := b.circuits[deploymentID]
+	if !ok {
+		c = new(circuit)
+		b.circuits[deploymentID] = c
+	}
+	c.failures++
+	if c.failures < b.threshold {
+		return false
+	}
+	c.openedAt = time.Now()
+	return c.failures == b.threshold
+}
+
+// Forget drops the circuit of the deployment, whose runtimes are stopped.
+func (b *Breaker) Forget(deploymentID string) {
+	delete(b.circuits, deploymentID)
+}
@@ -0,0 +1,41 @@
+package actrs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/actrs"
+	"github.com/hnimtadd/run/internal/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	cooldown := time.Millisecond * 50
+	breaker := actrs.NewBreaker(2, cooldown)
+
+	// a success in between keeps the circuit closed.
+	require.False(t, breaker.Record("deployment", true))
+	require.False(t, breaker.Record("deployment", false))
+	require.False(t, breaker.Record("deployment", true))
+	require.Nil(t, breaker.Allow("deployment"))
+
+	// the circuit opens after failures in a row, other deployments are not affected.
+	require.True(t, breaker.Record("deployment", true))
+	require.ErrorIs(t, breaker.Allow("deployment"), errors.ErrDeploymentUnavailable)
+	require.Nil(t, breaker.Allow("other"))
+
+	// a single request probes the deployment once the cooldown elapsed.
+	time.Sleep(cooldown)
+	require.Nil(t, breaker.Allow("deployment"))
+	require.ErrorIs(t, breaker.Allow("deployment"), errors.ErrDeploymentUnavailable)
+
+	// a failed probe opens the circuit again, a successful one closes it.
+	require.False(t, breaker.Record("deployment", true))
+	require.ErrorIs(t, breaker.Allow("deployment"), errors.ErrDeploymentUnavailable)
+	time.Sleep(cooldown)
+	require.Nil(t, breaker.Allow("deployment"))
+	require.False(t, breaker.Record("deployment", false))
+	require.Nil(t, breaker.Allow("deployment"))
+	require.Nil(t, breaker.Allow("deployment"))
+}
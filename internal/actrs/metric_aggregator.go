@@ -32,7 +32,7 @@ func (m *MetricAggregator) Receive(ctx actor.Context) {
 		slog.Info("hello from handle metric message", "msg", msg)
 		if err := m.HandleMetricMessage(msg); err != nil {
 			// we could retries
-			slog.Info("cannoot handle new metric message")
+			slog.Info("cannot handle new metric message", "node", "metricAggregator", "msg", err.Error())
 		}
 	default:
 		slog.Info("message type not support", "node", "metricAggregator", "msg", msg)
@@ -51,7 +51,9 @@ func (m *MetricAggregator) HandleMetricMessage(msg *message.MetricMessage) error
 		return err
 	}
 
-	if err := m.store.AddEndpointMetric(deployment.EndpointID.String(), msg.Metric); err != nil {
+	metric := msg.Metric
+	metric.DeploymentID = deployment.ID
+	if err := m.store.AddEndpointMetric(deployment.EndpointID.String(), metric); err != nil {
 		return err
 	}
 
@@ -0,0 +1,96 @@
+package actrs
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// RoutingTable resolves the hosts claimed by endpoints, it is loaded from the store and reloaded once it is older
+// than settings.RoutingTableTTL. It is safe for concurrent use.
+type RoutingTable struct {
+	mu         sync.Mutex // guards hosts and loadedAt, it is not held while the table is loaded
+	loads      singleflight.Group
+	store      store.Store
+	hosts      map[string]string // map host with the endpointID claiming it
+	loadedAt   time.Time
+	ttl        time.Duration
+	missReload time.Duration
+}
+
+func NewRoutingTable(store store.Store) *RoutingTable {
+	return &RoutingTable{
+		store:      store,
+		ttl:        settings.RoutingTableTTL,
+		missReload: settings.RoutingTableMissRefresh,
+	}
+}
+
+// Resolve returns the endpoint claiming the host of a Host header. A host which is not claimed reloads the table if
+// it was not reloaded for a moment, so that hosts of new endpoints are routed without waiting for the table to expire.
+func (t *RoutingTable) Resolve(host string) (string, bool) {
+	host = types.NormalizeHost(host)
+	endpointID, ok, loadedAt := t.lookup(host)
+	if time.Since(loadedAt) >= t.ttl || !ok && time.Since(loadedAt) >= t.missReload {
+		t.reload()
+		endpointID, ok, _ = t.lookup(host)
+	}
+	return endpointID, ok
+}
+
+func (t *RoutingTable) lookup(host string) (string, bool, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	endpointID, ok := t.hosts[host]
+	return endpointID, ok, t.loadedAt
+}
+
+// reload loads the hosts of every endpoint. Custom hosts and slugs are unique, while the names which endpoints created
+// before slugs are served by are not, so such a host routes to the oldest endpoint of that name unless a slug claims it.
+// Concurrent reloads share a single load, and lookups meanwhile are served by the current table.
+func (t *RoutingTable) reload() {
+	_, _, _ = t.loads.Do("reload", func() (any, error) {
+		t.load()
+		return nil, nil
+	})
+}
+
+func (t *RoutingTable) load() {
+	// the table is kept on failure, and the next reload waits as usual so that a failing store is not hammered.
+	t.mu.Lock()
+	t.loadedAt = time.Now()
+	t.mu.Unlock()
+	endpoints, err := t.store.GetEndpoints()
+	if err != nil {
+		slog.Error("cannot load routing table", "node", "server", "msg", err.Error())
+		return
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if hasSlug := endpoints[i].Slug != ""; hasSlug != (endpoints[j].Slug != "") {
+			return hasSlug
+		}
+		if endpoints[i].CreatedAt != endpoints[j].CreatedAt {
+			return endpoints[i].CreatedAt < endpoints[j].CreatedAt
+		}
+		return endpoints[i].ID.String() < endpoints[j].ID.String()
+	})
+
+	hosts := make(map[string]string)
+	for _, endpoint := range endpoints {
+		for _, host := range endpoint.Hostnames() {
+			if _, claimed := hosts[host]; !claimed {
+				hosts[host] = endpoint.ID.String()
+			}
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hosts = hosts
+}
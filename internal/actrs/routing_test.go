@@ -0,0 +1,123 @@
+package actrs_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/actrs"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingTable(t *testing.T) {
+	missRefresh := settings.RoutingTableMissRefresh
+	settings.RoutingTableMissRefresh = 0
+	t.Cleanup(func() { settings.RoutingTableMissRefresh = missRefresh })
+
+	memoryStore := store.NewMemoryStore()
+	first, err := types.NewEndpoint("Hello", "go", nil)
+	require.Nil(t, err)
+	first.Slug = "hello"
+	first.Hosts = []string{"app.example.com"}
+	require.Nil(t, memoryStore.CreateEndpoint(first))
+	// the memory store keeps the endpoint it is given, which makes it the oldest one.
+	first.CreatedAt--
+	second, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	second.Slug = "hello-2"
+	require.Nil(t, memoryStore.CreateEndpoint(second))
+	// endpoints created before slugs are served by their name, unless a slug claims its host.
+	legacy, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	legacy.CreatedAt -= 10
+	require.Nil(t, memoryStore.CreateEndpoint(legacy))
+
+	routes := actrs.NewRoutingTable(memoryStore)
+	for _, host := range []string{"hello.edge.local", "HELLO.edge.local:8080", "app.example.com.", "App.Example.com:443"} {
+		endpointID, ok := routes.Resolve(host)
+		require.True(t, ok, host)
+		require.Equal(t, first.ID.String(), endpointID, host)
+	}
+	endpointID, ok := routes.Resolve("hello-2.edge.local")
+	require.True(t, ok)
+	require.Equal(t, second.ID.String(), endpointID)
+	_, ok = routes.Resolve("localhost:8080")
+	require.False(t, ok)
+
+	// hosts of new endpoints are routed without waiting for the table to expire.
+	third, err := types.NewEndpoint("not a label", "go", nil)
+	require.Nil(t, err)
+	third.Hosts = []string{"third.example.com"}
+	require.Nil(t, memoryStore.CreateEndpoint(third))
+	endpointID, ok = routes.Resolve("third.example.com")
+	require.True(t, ok)
+	require.Equal(t, third.ID.String(), endpointID)
+}
+
+// blockingStore counts the loads of the endpoints, which wait until release is closed once blocking is set.
+type blockingStore struct {
+	*store.MemoryStore
+	loads    *atomic.Int32
+	blocking *atomic.Bool
+	release  chan struct{}
+}
+
+func (s blockingStore) GetEndpoints() ([]*types.Endpoint, error) {
+	s.loads.Add(1)
+	if s.blocking.Load() {
+		<-s.release
+	}
+	return s.MemoryStore.GetEndpoints()
+}
+
+func TestRoutingTable_SlowReload(t *testing.T) {
+	missRefresh := settings.RoutingTableMissRefresh
+	settings.RoutingTableMissRefresh = 0
+	t.Cleanup(func() { settings.RoutingTableMissRefresh = missRefresh })
+
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	endpoint.Slug = "hello"
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+	slow := blockingStore{MemoryStore: memoryStore, loads: new(atomic.Int32), blocking: new(atomic.Bool), release: make(chan struct{})}
+	routes := actrs.NewRoutingTable(slow)
+	_, ok := routes.Resolve("hello.edge.local")
+	require.True(t, ok)
+
+	// unclaimed hosts reload the table, which takes a while.
+	slow.blocking.Store(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok := routes.Resolve("localhost:8080")
+			require.False(t, ok)
+		}()
+	}
+	require.Eventually(t, func() bool { return slow.loads.Load() == 2 }, time.Second, time.Millisecond)
+
+	// claimed hosts are resolved by the current table meanwhile.
+	resolved := make(chan bool)
+	go func() {
+		_, ok := routes.Resolve("hello.edge.local")
+		resolved <- ok
+	}()
+	select {
+	case ok := <-resolved:
+		require.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("expect claimed host to be resolved while the table is reloaded")
+	}
+
+	// the reloads of the unclaimed hosts share a single load.
+	require.Never(t, func() bool { return slow.loads.Load() > 2 }, 100*time.Millisecond, time.Millisecond)
+	close(slow.release)
+	wg.Wait()
+}
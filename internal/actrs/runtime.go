@@ -8,10 +8,14 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"runtime/debug"
 	"time"
 
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/metrics"
 	"github.com/hnimtadd/run/internal/runtime"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/shared"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/types"
@@ -26,6 +30,9 @@ import (
 
 type Runtime struct {
 	Started     time.Time
+	LastRequest time.Time // when the runtime was given its last request
+	Requests    int64     // served since the runtime started
+	Cluster     *cluster.Cluster
 	Store       store.Store
 	LogStore    store.LogStore
 	BlobStore   store.BlobStore
@@ -33,6 +40,11 @@ type Runtime struct {
 	Cache       store.ModCacher
 	Runtime     *runtime.Runtime
 	StdOut      *bytes.Buffer
+	StdErr      *bytes.Buffer
+	Limits      types.ResourceLimits  // limits of a single invocation, loaded from the endpoint on Initialize
+	Streaming   bool                  // whether the endpoint streams request and response bodies, loaded on Initialize
+	Retention   types.RetentionPolicy // retention of request logs, loaded from the endpoint on Initialize
+	Endpoint    uuid.UUID
 	ManagerPID  *actor.PID
 	Deployment  uuid.UUID
 	_format     types.LogFormat
@@ -43,22 +55,124 @@ func (r *Runtime) Receive(ctx actor.Context) {
 	case *actor.Started:
 		slog.Info("runtime started", "node", "runtime")
 		r.Started = time.Now()
+		metrics.LiveRuntimes.Inc()
+
+	case *cluster.ClusterInit:
+		r.Cluster = msg.Cluster
+
+	case *actor.ReceiveTimeout:
+		// the runtime is idle, the runtime manager stops it unless a request was given to it meanwhile.
+		slog.Info("runtime idle", "node", "runtime", "deployment", r.Deployment)
+		if r.Cluster == nil {
+			ctx.Poison(ctx.Self())
+			return
+		}
+		managerPID := r.Cluster.Get(RuntimeManagerIdentity, KindRuntimeManager)
+		ctx.Send(managerPID, &message.RemoveRuntimeMessage{
+			DeploymentID: r.Deployment.String(),
+			PID:          ctx.Self(),
+		})
 
 	case *actor.Stopped:
 		timeUsed := time.Since(r.Started)
-		slog.Info("runtime started", "node", "runtime", "online duration", timeUsed)
+		slog.Info("runtime stopped", "node", "runtime", "online duration", timeUsed, "requests", r.Requests)
+		metrics.LiveRuntimes.Dec()
+		r.closeRuntime()
+
+	case *message.RuntimeStatsMessage:
+		ctx.Respond(r.Stats())
 
 	case *pb.HTTPRequest:
 		slog.Info("incoming request", "request", msg.Id)
-		if r.Runtime == nil {
-			if err := r.Initialize(msg); err != nil {
-				slog.Info("cannot initialized runtime", "node", "runtime", "msg", err.Error())
-			}
-		}
+		defer r.recoverRequest(ctx, msg)
 		r.ManagerPID = ctx.Sender()
 		// Handle the HTTP request that is forwarded from the WASM server actor.
-		r.Handle(ctx, msg)
+		r.initialize(ctx, msg, func() { r.Handle(ctx, msg) })
+
+	case *message.InvokeMessage:
+		slog.Info("incoming request", "request", msg.Request.Id)
+		defer r.recoverRequest(ctx, msg.Request)
+		r.ManagerPID = ctx.Sender()
+		r.initialize(ctx, msg.Request, func() { r.HandleStream(ctx, msg.Request, msg.Stream) })
+	}
+}
+
+// initialize counts the request and handles it once the runtime of the deployment is loaded, which is done on its
+// first request.
+func (r *Runtime) initialize(ctx actor.Context, req *pb.HTTPRequest, handle func()) {
+	r.Requests++
+	r.LastRequest = time.Now()
+	if r.Runtime == nil {
+		// the runtime is stopped along with its module once it receives no request for a while, loaded or not.
+		r.Deployment, _ = uuid.Parse(req.DeploymentId)
+		ctx.SetReceiveTimeout(settings.RuntimeIdleTimeout)
+	}
+	r.load(ctx, req, handle, 1, settings.RuntimeInitBackoff)
+}
+
+// load loads the runtime unless it is loaded already, then handles the request. Loading is retried with backoff
+// since the stores may fail for a moment, the request is answered with errors.ErrRuntimeUnavailable if it keeps
+// failing. Retries are scheduled to the runtime after the backoff rather than waited for, so that it keeps receiving
+// messages meanwhile.
+func (r *Runtime) load(ctx actor.Context, req *pb.HTTPRequest, handle func(), attempt int, backoff time.Duration) {
+	if r.Runtime != nil {
+		handle()
+		return
+	}
+	err := r.Initialize(req)
+	if err == nil {
+		handle()
+		return
+	}
+	slog.Info("cannot initialized runtime", "node", "runtime", "attempt", attempt, "msg", err.Error())
+	if attempt >= settings.RuntimeInitAttempts || errors.Is(err, errors.ErrDeploymentNotExisted) {
+		responseFailure(ctx, req, errors.Newf("%w, %v", errors.ErrRuntimeUnavailable, err))
+		return
+	}
+	// the continuation is run with the request as the message of ctx, so that it is answered to its sender.
+	ctx.ReenterAfter(actor.NewFuture(ctx.ActorSystem(), backoff), func(any, error) {
+		defer r.recoverRequest(ctx, req)
+		r.load(ctx, req, handle, attempt+1, backoff*2)
+	})
+}
+
+// recoverRequest answers the request whose handling panicked and drops the module of the runtime, so that the
+// next request loads it again rather than using a module left in an unknown state.
+func (r *Runtime) recoverRequest(ctx actor.Context, req *pb.HTTPRequest) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	slog.Error("runtime crashed", "node", "runtime", "request", req.Id, "panic", v, "stack", string(debug.Stack()))
+	r.closeRuntime()
+	responseFailure(ctx, req, errors.ErrRuntimeCrashed)
+}
+
+func (r *Runtime) closeRuntime() {
+	if r.Runtime == nil {
+		return
 	}
+	if err := r.Runtime.Close(); err != nil {
+		slog.Error("cannot close runtime", "node", "runtime", "msg", err.Error())
+	}
+	r.Runtime = nil
+}
+
+// Stats returns the usage of the runtime since it started.
+func (r *Runtime) Stats() *message.RuntimeStats {
+	stats := &message.RuntimeStats{
+		DeploymentID: r.Deployment.String(),
+		StartedAt:    r.Started.UnixMilli(),
+		Requests:     r.Requests,
+	}
+	if !r.LastRequest.IsZero() {
+		stats.LastRequest = r.LastRequest.UnixMilli()
+	}
+	if r.Runtime != nil {
+		stats.Runtime = r.Runtime.GetRuntime()
+		stats.Memory = r.Runtime.Stats()
+	}
+	return stats
 }
 
 func (r *Runtime) Initialize(msg *pb.HTTPRequest) error {
@@ -80,34 +194,65 @@ func (r *Runtime) Initialize(msg *pb.HTTPRequest) error {
 		return err
 	}
 
+	endpoint, err := r.Store.GetEndpointByID(deploy.EndpointID.String())
+	if err != nil {
+		slog.Error("runtime: could not find endpoint of deployment", "msg", err.Error())
+		return err
+	}
+
 	r.Deployment = deploy.ID
 	r._format = deploy.Format
-	modCache, err := r.Cache.Get(deploy.ID)
+	r.Limits = endpoint.Limits.WithDefaults()
+	r.Streaming = endpoint.Streaming
+	r.Retention = endpoint.Retention
+	r.Endpoint = endpoint.ID
+	modKey := store.ModKey{DeploymentID: deploy.ID, Hash: blobMetadata.Hash}
+	modCache, err := r.Cache.Get(modKey)
 	if err != nil {
 		modCache = wazero.NewCompilationCache()
 	}
 	r.StdOut = new(bytes.Buffer)
+	r.StdErr = new(bytes.Buffer)
 
 	args := runtime.Args{
 		Stdout:       r.StdOut,
+		Stderr:       r.StdErr,
 		DeploymentID: deploy.ID,
 		Blob:         blob.Data,
 		Engine:       msg.Runtime,
 		Cache:        modCache,
+		Limits:       r.Limits,
+		PoolSize:     endpoint.WarmInstances,
 	}
 
+	compileStart := time.Now()
 	run, err := runtime.New(context.Background(), args)
 	if err != nil {
 		slog.Error("failed to create runtime", "msg", err.Error())
 		return err
 	}
+	metrics.ModuleCompileSeconds.
+		WithLabelValues(deploy.ID.String(), msg.Runtime).
+		Set(time.Since(compileStart).Seconds())
 
 	r.Runtime = run
 
-	err = r.Cache.Put(deploy.ID, modCache)
+	err = r.Cache.Put(modKey, modCache)
 	if err != nil {
 		log.Println("cannot put cache", err)
 	}
+
+	if run.IsReactor() && endpoint.WarmInstances > 0 {
+		env := msg.GetEnv()
+		if r.Streaming && msg.Runtime == "go" && run.SupportsStreaming() {
+			env = streamingEnv(msg)
+		}
+		go func() {
+			if err := run.Prewarm(env); err != nil {
+				slog.Info("cannot prewarm instances", "deployment", deploy.ID, "msg", err.Error())
+			}
+		}()
+	}
 	return nil
 }
 
@@ -130,12 +275,84 @@ func (r *Runtime) Handle(ctx actor.Context, req *pb.HTTPRequest) {
 	}
 }
 
+// HandleStream handles the request whose body is read from given stream, which only streaming endpoints are given.
+// The guest streams the response if it supports streaming, otherwise the body is read as a whole and the request
+// is handled as usual.
+func (r *Runtime) HandleStream(ctx actor.Context, req *pb.HTTPRequest, stream types.Stream) {
+	if stream == nil {
+		r.Handle(ctx, req)
+		return
+	}
+	if r.Runtime != nil && r.Streaming && req.Runtime == "go" && r.Runtime.SupportsStreaming() {
+		r.HandleGoStream(ctx, req, stream)
+		return
+	}
+
+	body, err := readBody(stream)
+	if errors.Is(err, errors.ErrRequestBodyTooLarge) {
+		responseError(ctx, req, http.StatusRequestEntityTooLarge, err.Error(), req.Id)
+		return
+	}
+	if err != nil {
+		responseError(ctx, req, http.StatusBadRequest, "cannot read request body "+err.Error(), req.Id)
+		return
+	}
+	req.Body = body
+	r.Handle(ctx, req)
+}
+
+// HandleGoStream invokes the guest with the request head only, the guest reads the body and writes the response
+// through the stream while the whole stdout is treated as log.
+func (r *Runtime) HandleGoStream(ctx actor.Context, req *pb.HTTPRequest, stream types.Stream) {
+	if r.Deployment != uuid.MustParse(req.DeploymentId) {
+		responseError(ctx, req, http.StatusInternalServerError, "deploymentID must match with runtime deployment ID", req.Id)
+		return
+	}
+
+	defer r.resetOutput()
+	start := time.Now()
+	bufBytes, err := proto.Marshal(req)
+	if err != nil {
+		responseError(ctx, req, http.StatusInternalServerError, "cannot marshal request", req.Id)
+		return
+	}
+
+	env := streamingEnv(req)
+	recorder := &codeRecorder{Stream: stream}
+	invokeCtx := runtime.WithStream(context.Background(), recorder)
+	if err := r.Runtime.Invoke(invokeCtx, bytes.NewReader(bufBytes), env); err != nil {
+		r.handleInvokeError(ctx, req, err, start)
+		return
+	}
+
+	// the guest always writes the head before it exits, an unset code means it wrote no response at all.
+	rsp := &pb.HTTPResponse{RequestId: req.Id, Code: int32(recorder.code)}
+	if recorder.code == 0 {
+		rsp.Code = http.StatusInternalServerError
+		rsp.Body = []byte("guest exited without response")
+	}
+	r.appendRequestLog(req, r.StdOut.Bytes(), start, int(rsp.Code), types.ErrorClassNone)
+	requestMetric := types.CreateRequestMetric(req.Id, int(rsp.Code), time.Since(start))
+	responseHTTPWithMetrics(ctx, req, rsp, &requestMetric)
+}
+
+// streamingEnv returns the environment of the guest for a streamed invocation of the request.
+func streamingEnv(req *pb.HTTPRequest) map[string]string {
+	env := make(map[string]string, len(req.GetEnv())+1)
+	for key, value := range req.GetEnv() {
+		env[key] = value
+	}
+	env[runtime.StreamingEnv] = "1"
+	return env
+}
+
 func (r *Runtime) HandleGoRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 	if r.Deployment != uuid.MustParse(req.DeploymentId) {
 		responseError(ctx, req, http.StatusInternalServerError, "deploymentID must match with runtime deployment ID", req.Id)
 		return
 	}
 
+	defer r.resetOutput()
 	start := time.Now()
 	bufBytes, err := proto.Marshal(req)
 	if err != nil {
@@ -143,9 +360,8 @@ func (r *Runtime) HandleGoRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 		return
 	}
 
-	if err := r.Runtime.Invoke(bytes.NewReader(bufBytes), req.GetEnv()); err != nil {
-		// request_log.go error
-		responseError(ctx, req, http.StatusInternalServerError, "invoke error: "+err.Error(), req.Id)
+	if err := r.Runtime.Invoke(context.Background(), bytes.NewReader(bufBytes), req.GetEnv()); err != nil {
+		r.handleInvokeError(ctx, req, err, start)
 		return
 	}
 
@@ -164,15 +380,7 @@ func (r *Runtime) HandleGoRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 	}
 	rsp.RequestId = req.Id
 
-	// TODO: runtime metrics, write request_log.go to metric server
-	lines, err := shared.ParseLog(logs)
-	if err == nil {
-		requestUID, _ := uuid.Parse(req.Id)
-		reqLogs := types.NewRequestLog(r.Deployment, requestUID, lines)
-		if err := r.LogStore.AppendLog(reqLogs); err != nil {
-			slog.Error("failed to add log to server", "request", req.Id, "msg", err.Error())
-		}
-	}
+	r.appendRequestLog(req, logs, start, int(rsp.Code), types.ErrorClassNone)
 	duration := time.Since(start)
 	// Calculate metric for current request
 	requestMetric := types.CreateRequestMetric(req.Id, int(rsp.Code), duration)
@@ -180,7 +388,6 @@ func (r *Runtime) HandleGoRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 	// update metric of this deployment
 
 	responseHTTPWithMetrics(ctx, req, rsp, &requestMetric)
-	r.StdOut.Reset()
 }
 
 func (r *Runtime) HandlePythonRuntime(ctx actor.Context, req *pb.HTTPRequest) {
@@ -191,6 +398,7 @@ func (r *Runtime) HandlePythonRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 		return
 	}
 
+	defer r.resetOutput()
 	start := time.Now()
 
 	// TODO: fix this json, currently we directly parse it into json
@@ -215,10 +423,8 @@ func (r *Runtime) HandlePythonRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 		return
 	}
 
-	if err := r.Runtime.Invoke(bytes.NewReader(bufBytes), req.GetEnv()); err != nil {
-		slog.Info("invoke error", "msg", err.Error(), "node", "runtime")
-		// request_log.go error
-		responseError(ctx, req, http.StatusInternalServerError, "invoke error: "+err.Error(), req.Id)
+	if err := r.Runtime.Invoke(context.Background(), bytes.NewReader(bufBytes), req.GetEnv()); err != nil {
+		r.handleInvokeError(ctx, req, err, start)
 		return
 	}
 
@@ -258,15 +464,7 @@ func (r *Runtime) HandlePythonRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 		Header:    protoHeaders,
 	}
 
-	// TODO: runtime metrics, write request_log.go to metric server
-	lines, err := shared.ParseLog(logs)
-	if err == nil {
-		requestUID, _ := uuid.Parse(req.Id)
-		reqLogs := types.NewRequestLog(r.Deployment, requestUID, lines)
-		if err := r.LogStore.AppendLog(reqLogs); err != nil {
-			slog.Error("failed to add log to server", "request", req.Id, "msg", err.Error())
-		}
-	}
+	r.appendRequestLog(req, logs, start, int(rsp.Code), types.ErrorClassNone)
 	duration := time.Since(start)
 	// Calculate metric for current request
 	requestMetric := types.CreateRequestMetric(req.Id, int(rsp.Code), duration)
@@ -276,21 +474,92 @@ func (r *Runtime) HandlePythonRuntime(ctx actor.Context, req *pb.HTTPRequest) {
 
 	// update metric of this deployment
 	responseHTTPWithMetrics(ctx, req, rsp, &requestMetric)
-	r.StdOut.Reset()
 	fmt.Println(rsp)
 }
 
+// handleInvokeError responds the failed invocation to the caller. Violations of the resource limits are
+// answered with their error class and recorded with the output the guest produced before it was stopped.
+func (r *Runtime) handleInvokeError(ctx actor.Context, req *pb.HTTPRequest, err error, start time.Time) {
+	slog.Info("invoke error", "request", req.Id, "msg", err.Error(), "node", "runtime")
+	code := http.StatusInternalServerError
+	rsp := &pb.HTTPResponse{
+		Body:      []byte("invoke error: " + err.Error()),
+		RequestId: req.Id,
+	}
+
+	if class := types.ErrorClassOf(err); class != types.ErrorClassNone {
+		if class == types.ErrorClassWallTime {
+			code = http.StatusGatewayTimeout
+		}
+		rsp.Header = map[string]*pb.HeaderFields{
+			ErrorClassHeader: {Fields: []string{string(class)}},
+		}
+
+		r.appendRequestLog(req, r.StdOut.Bytes(), start, code, class, fmt.Sprintf("run: %s", err.Error()))
+	}
+	rsp.Code = int32(code)
+	requestMetric := types.CreateRequestMetric(req.Id, code, time.Since(start))
+	responseHTTPWithMetrics(ctx, req, rsp, &requestMetric)
+}
+
+// appendRequestLog stores the log of the invocation started at start and answered with status, stdout is
+// the output of the guest without its response. Stderr is always appended after stdout, messages are appended as error entries of the host.
+func (r *Runtime) appendRequestLog(req *pb.HTTPRequest, stdout []byte, start time.Time, status int, class types.ErrorClass, messages ...string) {
+	entries := shared.ParseLogEntries(stdout, types.LogStreamStdout, start)
+	if r.StdErr != nil {
+		entries = append(entries, shared.ParseLogEntries(r.StdErr.Bytes(), types.LogStreamStderr, start)...)
+	}
+	for _, msg := range messages {
+		entries = append(entries, types.LogEntry{
+			Stream:  types.LogStreamStderr,
+			Level:   types.LogLevelError,
+			Time:    time.Now().UnixMilli(),
+			Message: msg,
+		})
+	}
+
+	requestUID, _ := uuid.Parse(req.Id)
+	reqLog := types.NewStructuredRequestLog(r.Deployment, requestUID, entries)
+	reqLog.ErrorClass = class
+	reqLog.Status = status
+	reqLog.EndpointID = r.Endpoint
+	reqLog.ExpireAt = r.Retention.ExpireAt(time.Now())
+	if err := r.LogStore.AppendLog(reqLog); err != nil {
+		slog.Error("failed to add log to server", "request", req.Id, "msg", err.Error())
+	}
+}
+
+func (r *Runtime) resetOutput() {
+	r.StdOut.Reset()
+	if r.StdErr != nil {
+		r.StdErr.Reset()
+	}
+}
+
 func responseHTTPWithMetrics(ctx actor.Context, request *pb.HTTPRequest, response *pb.HTTPResponse, metric *types.RequestMetric) {
 	if ctx == nil {
 		return
 	}
-	ctx.Respond(&message.ResponseWithMetric{
-		Response: response,
-		MetricMessage: &message.MetricMessage{
+	rsp := &message.ResponseWithMetric{Response: response}
+	if metric != nil {
+		rsp.MetricMessage = &message.MetricMessage{
 			DeploymentID: request.DeploymentId,
 			RequestID:    request.Id,
 			Metric:       *metric,
-		},
+		}
+	}
+	ctx.Respond(rsp)
+}
+
+// responseFailure answers the request the runtime failed with err, which counts towards opening the circuit of the
+// deployment unlike errors answered by the guest.
+func responseFailure(ctx actor.Context, request *pb.HTTPRequest, err error) {
+	if ctx == nil {
+		return
+	}
+	ctx.Respond(&message.ResponseWithMetric{
+		Response: runtimeErrorResponse(request.Id, err),
+		Failed:   true,
 	})
 }
 
@@ -316,6 +585,9 @@ func NewRuntime(cfg *RuntimeConfig) actor.Producer {
 
 var KindRuntime = "kind-runtime"
 
+// ErrorClassHeader is set on responses of invocations which violated one of the resource limits.
+var ErrorClassHeader = "X-Run-Error-Class"
+
 type RuntimeConfig struct {
 	Store     store.Store
 	LogStore  store.LogStore
@@ -3,56 +3,170 @@ package actrs
 import (
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/asynkron/protoactor-go/actor"
 	"github.com/asynkron/protoactor-go/cluster"
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/metrics"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
 )
 
+// RuntimeManagerIdentity is the identity of the runtime manager grain of the cluster.
+const RuntimeManagerIdentity = "localRuntimeManager"
+
 type RuntimeManager struct {
-	ctx    cluster.GrainContext
-	lookup map[string]*actor.PID // map pid with runtime
+	ctx        cluster.GrainContext
+	store      store.Store
+	balancer   *Balancer
+	breaker    *Breaker
+	stopSweep  chan struct{}
+	sweepEvery time.Duration
 }
 
+// sweepRuntimesMessage asks the runtime manager to stop the runtimes of deployments which are not served anymore.
+type sweepRuntimesMessage struct{}
+
 func (r *RuntimeManager) Receive(ctx actor.Context) {
 	switch msg := ctx.Message().(type) {
 	case *actor.Started:
 	case *cluster.ClusterInit:
 		slog.Info("receive cluster init message", "node", "runtime manager")
 		r.ctx = cluster.NewGrainContext(ctx, msg.Identity, msg.Cluster)
+		r.startSweeper(ctx)
 	case *actor.Stop:
 		return
 	case *actor.Stopping:
 		return
 	case *actor.Stopped:
+		if r.stopSweep != nil {
+			close(r.stopSweep)
+		}
 		return
 	case *message.RequestRuntimeMessage:
 		slog.Info("receive runtime request message", "runtime", msg.Runtime, "node", "runtime manager")
-		pid, ok := r.lookup[msg.DeploymentID]
-		if !ok {
-			pid = r.SpawnRuntime(msg)
-			r.lookup[msg.DeploymentID] = pid
+		if err := r.breaker.Allow(msg.DeploymentID); err != nil {
+			ctx.Respond(err)
+			return
+		}
+		pid, err := r.balancer.Acquire(msg.DeploymentID, msg.Concurrency, func(index int) *actor.PID {
+			return r.SpawnRuntime(msg, index)
+		})
+		if err != nil {
+			metrics.SaturatedRequestsTotal.WithLabelValues(msg.DeploymentID).Inc()
+			ctx.Respond(err)
+			return
 		}
+		metrics.RequestsInFlight.WithLabelValues(msg.DeploymentID).Inc()
 		ctx.Respond(pid)
+
+	case *message.ReleaseRuntimeMessage:
+		metrics.RequestsInFlight.WithLabelValues(msg.DeploymentID).Dec()
+		if r.breaker.Record(msg.DeploymentID, msg.Failed) {
+			slog.Info("runtimes failed repeatedly, refusing requests", "deployment", msg.DeploymentID, "node", "runtime manager")
+			metrics.CircuitOpenedTotal.WithLabelValues(msg.DeploymentID).Inc()
+		}
+		if r.balancer.Release(msg.DeploymentID, msg.PID) {
+			r.stopRuntime(ctx, msg.DeploymentID, msg.PID)
+		}
+
+	case *message.RemoveRuntimeMessage:
+		if msg.PID != nil {
+			// an idle runtime asks to be stopped, which is refused if a request was given to it meanwhile.
+			if r.balancer.Passivate(msg.DeploymentID, msg.PID) {
+				r.stopRuntime(ctx, msg.DeploymentID, msg.PID)
+			}
+			return
+		}
+		r.drain(ctx, msg.DeploymentID)
+
+	case *message.ListRuntimesMessage:
+		ctx.Respond(r.balancer.Runtimes())
+
+	case *sweepRuntimesMessage:
+		r.sweep(ctx)
 	}
 }
 
-func (r *RuntimeManager) SpawnRuntime(msg *message.RequestRuntimeMessage) *actor.PID {
-	pid := r.ctx.Cluster().Get(fmt.Sprintf("%s/%s", msg.Runtime, msg.DeploymentID), KindRuntime)
+// SpawnRuntime returns the runtime grain of the deployment at index, each of them serves requests on its own.
+func (r *RuntimeManager) SpawnRuntime(msg *message.RequestRuntimeMessage, index int) *actor.PID {
+	pid := r.ctx.Cluster().Get(fmt.Sprintf("%s/%s/%d", msg.Runtime, msg.DeploymentID, index), KindRuntime)
 	return pid
 }
 
-func NewRuntimeManager() actor.Producer {
+func (r *RuntimeManager) drain(ctx actor.Context, deploymentID string) {
+	r.breaker.Forget(deploymentID)
+	for _, pid := range r.balancer.Drain(deploymentID) {
+		r.stopRuntime(ctx, deploymentID, pid)
+	}
+}
+
+func (r *RuntimeManager) stopRuntime(ctx actor.Context, deploymentID string, pid *actor.PID) {
+	slog.Info("stopping runtime", "deployment", deploymentID, "pid", pid.Id, "node", "runtime manager")
+	ctx.Poison(pid)
+}
+
+// sweep drains the runtimes of deployments which were deleted, failed or retired. Deployments are managed by the
+// api server, so the ingress learns about them from the store.
+func (r *RuntimeManager) sweep(ctx actor.Context) {
+	if r.store == nil {
+		return
+	}
+	for _, deploymentID := range r.balancer.Deployments() {
+		deployment, err := r.store.GetDeploymentByID(deploymentID)
+		switch {
+		case errors.Is(err, errors.ErrDeploymentNotExisted):
+		case err != nil:
+			slog.Error("cannot get deployment of runtimes", "deployment", deploymentID, "msg", err.Error())
+			continue
+		case deployment.Status != types.DeploymentStatusRetired && deployment.Status != types.DeploymentStatusFailed:
+			continue
+		}
+		r.drain(ctx, deploymentID)
+	}
+}
+
+func (r *RuntimeManager) startSweeper(ctx actor.Context) {
+	if r.stopSweep != nil || r.sweepEvery <= 0 {
+		return
+	}
+	r.stopSweep = make(chan struct{})
+	root, self, stop := ctx.ActorSystem().Root, ctx.Self(), r.stopSweep
+	go func() {
+		ticker := time.NewTicker(r.sweepEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				root.Send(self, &sweepRuntimesMessage{})
+			}
+		}
+	}()
+}
+
+type RuntimeManagerConfig struct {
+	Store store.Store
+}
+
+func NewRuntimeManager(cfg *RuntimeManagerConfig) actor.Producer {
 	return func() actor.Actor {
 		return &RuntimeManager{
-			lookup: make(map[string]*actor.PID),
+			store:      cfg.Store,
+			balancer:   NewBalancer(),
+			breaker:    NewBreaker(settings.CircuitFailureThreshold, settings.CircuitCooldown),
+			sweepEvery: settings.RuntimeSweepInterval,
 		}
 	}
 }
 
 var KindRuntimeManager = "kind-runtime-manager"
 
-func NewRuntimeManagerKind(opts ...actor.PropsOption) *cluster.Kind {
-	props := actor.PropsFromProducer(NewRuntimeManager(), opts...)
+func NewRuntimeManagerKind(cfg *RuntimeManagerConfig, opts ...actor.PropsOption) *cluster.Kind {
+	props := actor.PropsFromProducer(NewRuntimeManager(cfg), opts...)
 	return cluster.NewKind(KindRuntimeManager, props)
 }
@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hnimtadd/run/internal/actrs"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/types"
 	"github.com/hnimtadd/run/internal/utils"
 	pb "github.com/hnimtadd/run/pbs/gopb/v1"
+
+	"github.com/asynkron/protoactor-go/actor"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,3 +65,38 @@ func TestRuntimeActrs(t *testing.T) {
 
 	runtime.Handle(nil, &req)
 }
+
+// unavailableStore fails to get any deployment.
+type unavailableStore struct {
+	*store.MemoryStore
+}
+
+func (s unavailableStore) GetDeploymentByID(string) (*types.Deployment, error) {
+	return nil, errors.New("metadata store is down")
+}
+
+func TestRuntime_InitializeRetry(t *testing.T) {
+	attempts, backoff := settings.RuntimeInitAttempts, settings.RuntimeInitBackoff
+	settings.RuntimeInitAttempts, settings.RuntimeInitBackoff = 3, 200*time.Millisecond
+	t.Cleanup(func() { settings.RuntimeInitAttempts, settings.RuntimeInitBackoff = attempts, backoff })
+
+	system := actor.NewActorSystem()
+	memoryStore := store.NewMemoryStore()
+	pid := system.Root.Spawn(actor.PropsFromProducer(func() actor.Actor {
+		return &actrs.Runtime{Store: unavailableStore{memoryStore}}
+	}))
+	t.Cleanup(func() { _ = system.Root.PoisonFuture(pid).Wait() })
+
+	req := &pb.HTTPRequest{Id: uuid.NewString(), DeploymentId: uuid.NewString()}
+	response := system.Root.RequestFuture(pid, req, 5*time.Second)
+
+	// the runtime keeps receiving messages while it waits to retry loading.
+	stats, err := system.Root.RequestFuture(pid, &message.RuntimeStatsMessage{}, 100*time.Millisecond).Result()
+	require.Nil(t, err)
+	require.Equal(t, int64(1), stats.(*message.RuntimeStats).Requests)
+
+	res, err := response.Result()
+	require.Nil(t, err)
+	require.True(t, res.(*message.ResponseWithMetric).Failed)
+	require.Contains(t, string(res.(*message.ResponseWithMetric).Response.Body), errors.ErrRuntimeUnavailable.Error())
+}
@@ -1,17 +1,20 @@
 package actrs
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/message"
+	"github.com/hnimtadd/run/internal/metrics"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/types"
 	"github.com/hnimtadd/run/internal/utils"
@@ -25,19 +28,25 @@ import (
 type (
 	Server struct {
 		httpServer          *http.Server
+		adminServer         *http.Server // nil unless ServerConfig.AdminAddr is set
 		self                *actor.PID
 		runtimeManagerPID   *actor.PID
 		metricAggregatorPID *actor.PID
 		ctx                 cluster.GrainContext
 		responses           map[string]chan<- *pb.HTTPResponse
+		leases              map[string]*message.ReleaseRuntimeMessage // map requestID with the runtime serving it
 		store               store.Store
+		routes              *RoutingTable
 		cache               store.ModCacher
 		version             string
 	}
 	ServerConfig struct {
-		Addr    string
-		Store   store.Store
-		Version string
+		Addr string
+		// AdminAddr is the address the admin endpoints are served at, apart from the ingress since they are not
+		// authenticated. The admin endpoints are not served if it is unset.
+		AdminAddr string
+		Store     store.Store
+		Version   string
 	}
 )
 
@@ -59,14 +68,26 @@ func (s *Server) Receive(ctx actor.Context) {
 		// initialized in time.
 		// In that case, we could spaw the runtime
 
-		runtimePID, err := s.RequestRuntime(msg.Request.DeploymentId, msg.Request.Runtime)
+		runtimePID, err := s.RequestRuntime(msg.Request.DeploymentId, msg.Request.Runtime, msg.Concurrency)
 		if err != nil {
 			slog.Info("cannot request runtime", "msg", err, "node", "server")
+			if msg.ResponseCh != nil {
+				msg.ResponseCh <- runtimeErrorResponse(msg.Request.Id, err)
+			}
 			return
 		}
 		slog.Info("request runtime success, redirecting user request", "pid", runtimePID.Id)
-
-		defer s.ctx.Request(runtimePID, msg.Request)
+		s.leases[msg.Request.Id] = &message.ReleaseRuntimeMessage{DeploymentID: msg.Request.DeploymentId, PID: runtimePID}
+
+		switch {
+		case msg.Stream == nil:
+			defer s.ctx.Request(runtimePID, msg.Request)
+		case runtimePID.Address == ctx.Self().Address:
+			defer s.ctx.Request(runtimePID, &message.InvokeMessage{Request: msg.Request, Stream: msg.Stream})
+		default:
+			// the stream could not leave this node, the body is read aside so that the server keeps receiving messages.
+			go s.sendWithBody(runtimePID, msg.Request, msg.Stream)
+		}
 		if msg.ResponseCh == nil {
 			return
 		}
@@ -78,29 +99,94 @@ func (s *Server) Receive(ctx actor.Context) {
 			responseCh <- rsp
 			delete(s.responses, rsp.RequestId)
 		}
+		s.releaseRuntime(ctx, rsp.RequestId, msg.Failed)
 		if msg.MetricMessage != nil {
 			ctx.Send(s.metricAggregatorPID, msg.MetricMessage)
 		}
+
+	case *message.RequestDoneMessage:
+		// the request timed out or its client went away before the runtime answered.
+		delete(s.responses, msg.RequestID)
+		s.releaseRuntime(ctx, msg.RequestID, false)
 	}
 }
 
-func (s *Server) RequestRuntime(deploymentID string, runtime string) (*actor.PID, error) {
+// RequestRuntime acquires the least loaded runtime of the deployment, which must be released once the request is done.
+func (s *Server) RequestRuntime(deploymentID string, runtime string, concurrency types.ConcurrencyPolicy) (*actor.PID, error) {
 	res, err := s.ctx.RequestFuture(
 		s.runtimeManagerPID,
 		&message.RequestRuntimeMessage{
 			DeploymentID: deploymentID,
 			Runtime:      runtime,
+			Concurrency:  concurrency,
 		},
 		time.Second*5,
 	).Result()
 	if err != nil {
 		return nil, err
 	}
-	return res.(*actor.PID), nil
+	switch res := res.(type) {
+	case *actor.PID:
+		return res, nil
+	case error:
+		return nil, res
+	default:
+		return nil, errors.Newf("unexpected answer of runtime manager %T", res)
+	}
+}
+
+// sendWithBody sends the request along with its body read from the stream to a runtime on another node, which
+// answers the server. The request is answered with an error instead if its body could not be read.
+func (s *Server) sendWithBody(runtimePID *actor.PID, req *pb.HTTPRequest, stream types.Stream) {
+	body, err := readBody(stream)
+	if err != nil {
+		s.ctx.Send(s.self, &message.ResponseWithMetric{Response: runtimeErrorResponse(req.Id, err)})
+		return
+	}
+	req.Body = body
+	s.ctx.RequestWithCustomSender(runtimePID, req, s.self)
+}
+
+func (s *Server) releaseRuntime(ctx actor.Context, requestID string, failed bool) {
+	if lease, ok := s.leases[requestID]; ok {
+		lease.Failed = failed
+		ctx.Send(s.runtimeManagerPID, lease)
+		delete(s.leases, requestID)
+	}
+}
+
+// runtimeErrorResponse answers the request which could not be given to a runtime or which the runtime failed.
+// Saturated deployments are answered with 429 and deployments whose circuit is open with 503, both with Retry-After
+// so that clients back off, runtimes which could not be initialized or crashed are answered with 502.
+func runtimeErrorResponse(requestID string, err error) *pb.HTTPResponse {
+	body, _ := json.Marshal(utils.MakeErrorResponse(err))
+	rsp := &pb.HTTPResponse{
+		RequestId: requestID,
+		Code:      http.StatusServiceUnavailable,
+		Body:      body,
+		Header:    map[string]*pb.HeaderFields{"Content-Type": {Fields: []string{"application/json"}}},
+	}
+	switch {
+	case errors.Is(err, errors.ErrDeploymentSaturated):
+		rsp.Code = http.StatusTooManyRequests
+		rsp.Header["Retry-After"] = &pb.HeaderFields{Fields: []string{retryAfter(settings.SaturatedRetryAfter)}}
+	case errors.Is(err, errors.ErrDeploymentUnavailable):
+		rsp.Header["Retry-After"] = &pb.HeaderFields{Fields: []string{retryAfter(settings.CircuitCooldown)}}
+	case errors.Is(err, errors.ErrRuntimeUnavailable), errors.Is(err, errors.ErrRuntimeCrashed):
+		rsp.Code = http.StatusBadGateway
+	case errors.Is(err, errors.ErrRequestBodyTooLarge):
+		rsp.Code = http.StatusRequestEntityTooLarge
+	}
+	return rsp
+}
+
+// retryAfter formats d as the seconds of a Retry-After header.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
 }
 
 func (s *Server) Initialize() {
-	s.runtimeManagerPID = s.ctx.Cluster().Get("localRuntimeManager", KindRuntimeManager)
+	s.runtimeManagerPID = s.ctx.Cluster().Get(RuntimeManagerIdentity, KindRuntimeManager)
 	slog.Info("initialized runtime manager", "pid", s.runtimeManagerPID.Id)
 
 	s.metricAggregatorPID = s.ctx.Cluster().Get("localMetricAggragator", KindMetricAggregator)
@@ -110,6 +196,12 @@ func (s *Server) Initialize() {
 		slog.Info("serving ingress...", "at", s.httpServer.Addr, "node", "Server", "version", s.version)
 		log.Panic(s.httpServer.ListenAndServe())
 	}()
+	if s.adminServer != nil {
+		go func() {
+			slog.Info("serving admin...", "at", s.adminServer.Addr, "node", "Server", "version", s.version)
+			log.Panic(s.adminServer.ListenAndServe())
+		}()
+	}
 }
 
 func (s *Server) Stop() {
@@ -118,9 +210,21 @@ func (s *Server) Stop() {
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		slog.Error("cannot shutdown server", "msg", err.Error())
 	}
+	if s.adminServer == nil {
+		return
+	}
+	if err := s.adminServer.Shutdown(ctx); err != nil {
+		slog.Error("cannot shutdown admin server", "msg", err.Error())
+	}
 }
 
+// ServeHTTP serves requests of hosts which are not claimed by an endpoint, under /{mode}/{endpoint id|slug}.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, "")
+}
+
+// serve serves the request, endpointID is the endpoint claiming the host of the request, or empty if none does.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, endpointID string) {
 	defer func() {
 		if err := r.Body.Close(); err != nil {
 			slog.Error("failed to close this request's body", "msg", err.Error())
@@ -141,9 +245,14 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		req      = utils.MakeProtoRequest(uuid.NewString())
 		mode     = pathParts[0]
 	)
-	slog.Info("new request", "node", "server", "environment", pathParts[0], "url", innerURL)
+	routed := endpointID != ""
+	if routed {
+		// the host is claimed by an endpoint, which is then served from / rather than under a path prefix.
+		mode, innerURL = "live", "/"+path
+	}
+	slog.Info("new request", "node", "server", "environment", mode, "host", r.Host, "url", innerURL)
 
-	// first param is mode
+	// first param is mode, unless the endpoint is routed by host
 	switch mode {
 	case "preview":
 		deploymentID := pathParts[1]
@@ -161,9 +270,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case "live":
-		// second param is endpointId
-		endpointID := pathParts[1]
-		endpoint, err = s.store.GetEndpointByID(endpointID)
+		// second param is endpointId or the slug of the endpoint
+		if !routed {
+			endpointID = pathParts[1]
+		}
+		endpoint, err = store.GetEndpoint(s.store, endpointID)
 		if err != nil {
 			_ = utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
 			return
@@ -174,7 +285,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		deploy, err = s.store.GetDeploymentByID(endpoint.ActiveDeploymentID.String())
+		deploy, err = s.liveDeployment(w, r, endpoint)
 		if err != nil {
 			_ = utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 			return
@@ -184,6 +295,12 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a deployment which is still being deployed or failed to deploy has no blob to serve.
+	if !deploy.IsServable() {
+		_ = utils.WriteJSON(w, http.StatusConflict, utils.MakeErrorResponse(errors.ErrDeploymentNotReady))
+		return
+	}
+
 	protoHeader := make(map[string]*pb.HeaderFields)
 	for k, v := range r.Header {
 		field := &pb.HeaderFields{
@@ -200,28 +317,66 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	req.Method = r.Method
 	req.Url = innerURL
 
-	bodyBuf := new(bytes.Buffer)
-	_, err = io.Copy(bodyBuf, r.Body)
-	if err != nil {
-		_ = utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
-		return
-	}
-	req.Body = bodyBuf.Bytes()
-
+	stream := newHTTPStream(w, r.Body)
 	rspCh := make(chan *pb.HTTPResponse, 1)
 	reqMessage := message.NewRequestMessage(req, rspCh)
+	reqMessage.Concurrency = endpoint.Concurrency
+	if endpoint.Streaming {
+		// the body is not buffered, the runtime reads it and possibly streams the response through the stream.
+		reqMessage.Stream = stream
+	} else {
+		// the body is buffered here rather than by the runtime, so that a client which is slow to send it holds back
+		// its own request only, rather than every request queued on the runtime.
+		body, err := readBody(r.Body)
+		if errors.Is(err, errors.ErrRequestBodyTooLarge) {
+			_ = utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.MakeErrorResponse(err))
+			return
+		} else if err != nil {
+			_ = utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+			return
+		}
+		req.Body = body
+	}
 
+	start := time.Now()
 	s.ctx.Send(s.self, reqMessage)
+	defer s.ctx.Send(s.self, &message.RequestDoneMessage{RequestID: req.Id})
 	slog.Info("waiting for response from sandbox...")
-	rsp := <-rspCh
 
-	w.WriteHeader(int(rsp.Code))
+	// the runtime answers timed out invocations itself, the timer here only guards against a runtime which never answers.
+	timer := time.NewTimer(endpoint.Limits.WallTime() + settings.RequestTimeoutGrace)
+	defer timer.Stop()
+
+	var rsp *pb.HTTPResponse
+	select {
+	case rsp = <-rspCh:
+	case <-timer.C:
+		slog.Info("runtime did not respond in time", "node", "server", "request", req.Id)
+		metrics.ObserveRequest(req.EndpointId, req.DeploymentId, req.Runtime, http.StatusGatewayTimeout, time.Since(start))
+		if stream.close() {
+			// the response is already streamed partially, the client only sees it being cut off.
+			return
+		}
+		w.Header().Set(ErrorClassHeader, string(types.ErrorClassWallTime))
+		_ = utils.WriteJSON(w, http.StatusGatewayTimeout, utils.MakeErrorResponse(errors.ErrInvokeTimeout))
+		return
+	case <-r.Context().Done():
+		slog.Info("client closed request before runtime responded", "node", "server", "request", req.Id)
+		stream.close()
+		return
+	}
+	metrics.ObserveRequest(req.EndpointId, req.DeploymentId, req.Runtime, int(rsp.Code), time.Since(start))
+	if stream.close() {
+		slog.Info("response streamed by sandbox", "request", req.Id)
+		return
+	}
+
 	for key, val := range rsp.Header {
 		for _, field := range val.Fields {
-			fmt.Println(key, field)
 			w.Header().Add(key, field)
 		}
 	}
+	w.WriteHeader(int(rsp.Code))
 
 	slog.Info("got response from sandbox, returning to user")
 	_, _ = w.Write(rsp.Body)
@@ -231,12 +386,32 @@ func NewServer(cfg *ServerConfig) actor.Producer {
 	return func() actor.Actor {
 		s := &Server{
 			responses: make(map[string]chan<- *pb.HTTPResponse),
+			leases:    make(map[string]*message.ReleaseRuntimeMessage),
 			store:     cfg.Store,
+			routes:    NewRoutingTable(cfg.Store),
 			cache:     store.NewMemoryModCacher(),
 			version:   cfg.Version,
 		}
-		server := &http.Server{Addr: cfg.Addr, Handler: s}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/", s)
+		// hosts claimed by endpoints are served by the endpoints as a whole, the ingress serves its own paths on
+		// other hosts only.
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if endpointID, routed := s.routes.Resolve(r.Host); routed {
+				s.serve(w, r, endpointID)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+		server := &http.Server{Addr: cfg.Addr, Handler: handler}
 		s.httpServer = server
+		if cfg.AdminAddr != "" {
+			adminMux := http.NewServeMux()
+			adminMux.HandleFunc("/admin/runtimes", s.handleAdminRuntimes)
+			adminMux.HandleFunc("/admin/runtimes/", s.handleAdminRuntimes)
+			s.adminServer = &http.Server{Addr: cfg.AdminAddr, Handler: adminMux}
+		}
 		return s
 	}
 }
@@ -0,0 +1,121 @@
+package actrs
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/types"
+)
+
+// httpStream streams the body of an ingress request to the runtime and the response of the runtime back to the client.
+// Once closed by the ingress, which happens when it stops waiting for the runtime, the stream is no longer usable.
+type httpStream struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	body        io.Reader
+	headWritten bool
+	closed      bool
+}
+
+var _ types.Stream = &httpStream{}
+
+func newHTTPStream(w http.ResponseWriter, body io.Reader) *httpStream {
+	return &httpStream{w: w, body: body}
+}
+
+// Read implements types.Stream.
+func (s *httpStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, errors.ErrStreamClosed
+	}
+	return s.body.Read(p)
+}
+
+// WriteHead implements types.Stream.
+func (s *httpStream) WriteHead(code int, header http.Header) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.ErrStreamClosed
+	}
+	if s.headWritten {
+		return errors.ErrHeadWritten
+	}
+	for key, values := range header {
+		for _, value := range values {
+			s.w.Header().Add(key, value)
+		}
+	}
+	s.writeHead(code)
+	return nil
+}
+
+// Write implements types.Stream.
+func (s *httpStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, errors.ErrStreamClosed
+	}
+	if !s.headWritten {
+		s.writeHead(http.StatusOK)
+	}
+	n, err := s.w.Write(p)
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func (s *httpStream) writeHead(code int) {
+	s.w.WriteHeader(code)
+	s.headWritten = true
+}
+
+// close closes the stream and reports whether the head of the response was written to the client.
+func (s *httpStream) close() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.headWritten
+}
+
+// readBody reads the whole request body from the stream, it fails with errors.ErrRequestBodyTooLarge rather than
+// reading more than settings.MaxRequestBodySize.
+func readBody(stream io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(stream, settings.MaxRequestBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > settings.MaxRequestBodySize {
+		return nil, errors.ErrRequestBodyTooLarge
+	}
+	return body, nil
+}
+
+// codeRecorder records the status code the guest wrote through the stream.
+type codeRecorder struct {
+	types.Stream
+	code int
+}
+
+func (s *codeRecorder) WriteHead(code int, header http.Header) error {
+	if err := s.Stream.WriteHead(code, header); err != nil {
+		return err
+	}
+	s.code = code
+	return nil
+}
+
+func (s *codeRecorder) Write(p []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.Stream.Write(p)
+}
@@ -0,0 +1,58 @@
+package actrs
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/hnimtadd/run/internal/metrics"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// liveDeployment returns the deployment which serves the live request to the endpoint. Endpoints which split their
+// traffic pick it by weight, keeping a client on the same deployment by its traffic key. A canary which cannot be
+// served falls back to the active deployment.
+func (s *Server) liveDeployment(w http.ResponseWriter, r *http.Request, endpoint *types.Endpoint) (*types.Deployment, error) {
+	if len(endpoint.Traffic) == 0 {
+		return s.store.GetDeploymentByID(endpoint.ActiveDeploymentID.String())
+	}
+	deploymentID := endpoint.PickDeployment(trafficKey(w, r))
+	if deploymentID != endpoint.ActiveDeploymentID {
+		deploy, err := s.store.GetDeploymentByID(deploymentID.String())
+		if err == nil && deploy.IsServable() {
+			metrics.TrafficRequestsTotal.WithLabelValues(endpoint.ID.String(), deploymentID.String(), trackCanary).Inc()
+			return deploy, nil
+		}
+		slog.Info("canary deployment cannot be served, falling back to the active one", "endpoint", endpoint.ID, "deployment", deploymentID)
+	}
+	metrics.TrafficRequestsTotal.WithLabelValues(endpoint.ID.String(), endpoint.ActiveDeploymentID.String(), trackStable).Inc()
+	return s.store.GetDeploymentByID(endpoint.ActiveDeploymentID.String())
+}
+
+// trafficKey returns the key which keeps the client of the request on the same deployment, taken from the traffic
+// header or cookie. Clients which send neither are given a new key by cookie.
+func trafficKey(w http.ResponseWriter, r *http.Request) string {
+	if key := r.Header.Get(settings.TrafficKeyHeader); key != "" {
+		return key
+	}
+	if cookie, err := r.Cookie(settings.TrafficCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	key := uuid.NewString()
+	http.SetCookie(w, &http.Cookie{
+		Name:     settings.TrafficCookie,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   int(settings.TrafficCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return key
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HandleUpdateHealth replaces the health policy of the endpoint, which applies to its active deployment right away
+// if it was activated within the window of the policy.
+func (s *Server) HandleUpdateHealth(w http.ResponseWriter, r *http.Request) error {
+	policy := new(types.HealthPolicy)
+	if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+	if err := policy.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	endpointID := endpoint.ID.String()
+	if err := s.metadataStore.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Health: policy}); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpointID,
+		"health":     policy.WithDefaults(),
+	})
+}
+
+// HandleGetEventsOfEndpoint lists the events of the endpoint newest first, such as the rollbacks of unhealthy
+// deployments.
+func (s *Server) HandleGetEventsOfEndpoint(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	events, err := s.metadataStore.GetEventsOfEndpoint(endpoint.ID.String())
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, events)
+}
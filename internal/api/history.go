@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HandleUpdateHistory replaces the history policy of the endpoint, deployments are only removed once the history is
+// pruned.
+func (s *Server) HandleUpdateHistory(w http.ResponseWriter, r *http.Request) error {
+	policy := new(types.HistoryPolicy)
+	if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+	if err := policy.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	endpointID := endpoint.ID.String()
+	if err := s.metadataStore.UpdateEndpoint(endpointID, store.UpdateEndpointParams{History: policy}); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpointID,
+		"history":    policy.WithDefaults(),
+	})
+}
+
+// HandlePruneHistory removes the deployments of the endpoint which its history policy does not keep, along with
+// their blobs. Rollbacks never remove deployments, this is the only way to.
+func (s *Server) HandlePruneHistory(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	removed, err := deploy.PruneHistory(s.metadataStore, s.blobStore, endpoint, time.Now())
+	deleted := make([]string, len(removed))
+	for i, deployment := range removed {
+		deleted[i] = deployment.ID.String()
+		go s.removeRuntimes(deleted[i])
+	}
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "deleted": deleted})
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpoint.ID.String(),
+		"history":    endpoint.History.WithDefaults(),
+		"deleted":    deleted,
+	})
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// parseLogQuery parses ?since=&until=&q=&order=&cursor=&limit= query parameters, since and until
+// accept either unix timestamp or RFC3339 formatted time.
+func parseLogQuery(r *http.Request) (*store.LogQueryParams, error) {
+	query := r.URL.Query()
+	params := &store.LogQueryParams{
+		Search: query.Get("q"),
+		Cursor: query.Get("cursor"),
+		Limit:  settings.DefaultLogPageSize,
+	}
+
+	if raw := query.Get("since"); raw != "" {
+		since, err := parseTime(raw)
+		if err != nil {
+			return nil, errors.Newf("invalid since parameter, %v", err)
+		}
+		params.Since = since.Unix()
+	}
+	if raw := query.Get("until"); raw != "" {
+		until, err := parseTime(raw)
+		if err != nil {
+			return nil, errors.Newf("invalid until parameter, %v", err)
+		}
+		params.Until = until.Unix()
+	}
+	if params.Since > 0 && params.Until > 0 && params.Until <= params.Since {
+		return nil, errors.ErrInvalidTimeRange
+	}
+
+	order, err := store.ParseLogOrder(query.Get("order"))
+	if err != nil {
+		return nil, err
+	}
+	params.Order = order
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > settings.MaxLogPageSize {
+			return nil, errors.ErrInvalidLimit
+		}
+		params.Limit = limit
+	}
+	return params, nil
+}
+
+// logFilter is the parsed form of ?requestID=&status=&level= query parameters of the log stream.
+type logFilter struct {
+	requestID string
+	status    string // exact status code such as 404, or status class such as 5xx
+	level     types.LogLevel
+}
+
+func parseLogFilter(r *http.Request) (*logFilter, error) {
+	query := r.URL.Query()
+	level, err := parseLogLevel(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &logFilter{
+		requestID: query.Get("requestID"),
+		status:    strings.ToLower(query.Get("status")),
+		level:     level,
+	}
+	if f.status != "" && !isValidStatusFilter(f.status) {
+		return nil, errors.ErrInvalidStatusFilter
+	}
+	return f, nil
+}
+
+func isValidStatusFilter(status string) bool {
+	if len(status) == 3 && strings.HasSuffix(status, "xx") {
+		return status[0] >= '1' && status[0] <= '5'
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 100 && code <= 599
+}
+
+func (f *logFilter) match(log *types.RequestLog) bool {
+	if f.requestID != "" && log.RequestID.String() != f.requestID {
+		return false
+	}
+	if f.status == "" {
+		return true
+	}
+	if strings.HasSuffix(f.status, "xx") {
+		return log.Status/100 == int(f.status[0]-'0')
+	}
+	return strconv.Itoa(log.Status) == f.status
+}
+
+// HandleTailLogOfDeployment streams logs of the deployment as server-sent events while they are appended.
+// Each log is sent as a "log" event whose data is the json of the request log, logs without entries at the
+// requested level are skipped.
+func (s *Server) HandleTailLogOfDeployment(w http.ResponseWriter, r *http.Request) error {
+	deploymentID := chi.URLParam(r, "id")
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if _, err := s.metadataStore.GetDeploymentByID(deploymentID); err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(errors.ErrStreamingUnsupported))
+	}
+
+	logCh, err := s.logStore.TailLogOfDeployment(r.Context(), deploymentID)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(settings.LogStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		case log, ok := <-logCh:
+			if !ok {
+				return nil
+			}
+			if !filter.match(log) {
+				continue
+			}
+			if filter.level != types.LogLevelDebug && len(types.FilterLogEntries(log.LogEntries(), filter.level)) == 0 {
+				continue
+			}
+			data, err := json.Marshal(FromInternalRequestLog(log, filter.level))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", log.RequestID, data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// HandleUpdateRetention replaces the retention policy of the endpoint and applies it to the existing logs right away.
+func (s *Server) HandleUpdateRetention(w http.ResponseWriter, r *http.Request) error {
+	endpointRef := chi.URLParam(r, "id")
+	policy := new(types.RetentionPolicy)
+	if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+	if err := policy.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, endpointRef)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	endpointID := endpoint.ID.String()
+	if err := s.metadataStore.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Retention: policy}); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+
+	deploymentIDs, err := store.GetDeploymentIDsOfEndpoint(s.metadataStore, endpointID)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	deleted, err := s.logStore.ApplyRetention(endpointID, deploymentIDs, *policy)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpointID,
+		"retention":  policy.WithDefaults(),
+		"deleted":    deleted,
+	})
+}
+
+// HandlePurgeLogOfDeployment removes all logs of the deployment.
+func (s *Server) HandlePurgeLogOfDeployment(w http.ResponseWriter, r *http.Request) error {
+	deploymentID := chi.URLParam(r, "id")
+	if _, err := s.metadataStore.GetDeploymentByID(deploymentID); err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+
+	deleted, err := s.logStore.PurgeLogOfDeployment(deploymentID)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"deploymentID": deploymentID,
+		"deleted":      deleted,
+	})
+}
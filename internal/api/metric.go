@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// metricQuery is the parsed form of ?from=&to=&step= query parameters.
+type metricQuery struct {
+	from time.Time
+	to   time.Time
+	step time.Duration
+}
+
+// parseTime accepts either unix timestamp or RFC3339 formatted time.
+func parseTime(raw string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func parseMetricQuery(r *http.Request) (*metricQuery, error) {
+	query := r.URL.Query()
+	q := &metricQuery{
+		to:   time.Now(),
+		step: settings.DefaultMetricStep,
+	}
+
+	if raw := query.Get("to"); raw != "" {
+		to, err := parseTime(raw)
+		if err != nil {
+			return nil, errors.Newf("invalid to parameter, %v", err)
+		}
+		q.to = to
+	}
+	q.from = q.to.Add(-settings.DefaultMetricWindow)
+	if raw := query.Get("from"); raw != "" {
+		from, err := parseTime(raw)
+		if err != nil {
+			return nil, errors.Newf("invalid from parameter, %v", err)
+		}
+		q.from = from
+	}
+	if raw := query.Get("step"); raw != "" {
+		step, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, errors.Newf("invalid step parameter, %v", err)
+		}
+		q.step = step
+	}
+
+	if !q.to.After(q.from) || q.step < time.Second {
+		return nil, errors.ErrInvalidTimeRange
+	}
+	if int(q.to.Sub(q.from)/q.step) > settings.MaxMetricBuckets {
+		return nil, errors.ErrTooManyBuckets
+	}
+	return q, nil
+}
+
+func (s *Server) HandleGetMetricsOfEndpoint(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	endpointID := endpoint.ID.String()
+
+	q, err := parseMetricQuery(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	metrics, err := s.metricStore.GetMetricsOfEndpoint(endpointID, store.MetricQueryParams{From: q.from.Unix(), To: q.to.Unix()})
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+
+	rsp := FromInternalMetrics(metrics, q.from, q.to, q.step)
+	rsp["endpointID"] = endpointID
+	return utils.WriteJSON(w, http.StatusOK, rsp)
+}
+
+func (s *Server) HandleGetMetricsOfDeployment(w http.ResponseWriter, r *http.Request) error {
+	deploymentID := chi.URLParam(r, "id")
+	deployment, err := s.metadataStore.GetDeploymentByID(deploymentID)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+
+	q, err := parseMetricQuery(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	metrics, err := s.metricStore.GetMetricsOfDeployment(deploymentID, store.MetricQueryParams{From: q.from.Unix(), To: q.to.Unix()})
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+
+	rsp := FromInternalMetrics(metrics, q.from, q.to, q.step)
+	rsp["endpointID"] = deployment.EndpointID.String()
+	rsp["deploymentID"] = deploymentID
+	return utils.WriteJSON(w, http.StatusOK, rsp)
+}
+
+func FromInternalMetrics(metrics []types.RequestMetric, from, to time.Time, step time.Duration) map[string]any {
+	buckets := types.BucketRequestMetrics(metrics, from, to, step)
+	rspBuckets := make([]map[string]any, 0, len(buckets))
+	for _, bucket := range buckets {
+		rspBuckets = append(rspBuckets, FromInternalMetricBucket(bucket))
+	}
+	return map[string]any{
+		"from":    from.Format(time.RFC3339),
+		"to":      to.Format(time.RFC3339),
+		"step":    step.String(),
+		"total":   fromInternalRuntimeMetric(types.NewRuntimeMetric(metrics)),
+		"buckets": rspBuckets,
+	}
+}
+
+func FromInternalMetricBucket(bucket types.MetricBucket) map[string]any {
+	rsp := fromInternalRuntimeMetric(bucket.RuntimeMetric)
+	rsp["start"] = time.Unix(bucket.Start, 0).Format(time.RFC3339)
+	rsp["end"] = time.Unix(bucket.End, 0).Format(time.RFC3339)
+	return rsp
+}
+
+func fromInternalRuntimeMetric(metric types.RuntimeMetric) map[string]any {
+	return map[string]any{
+		"numRequest": metric.NumRequest,
+		"numSuccess": metric.NumSuccess,
+		"numError":   metric.NumError,
+		"errorRate":  metric.ErrorRate,
+		"p50Ms":      durationToMs(metric.P50),
+		"p95Ms":      durationToMs(metric.P95),
+		"p99Ms":      durationToMs(metric.P99),
+	}
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMetricQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		from  time.Time
+		to    time.Time
+		step  time.Duration
+		err   error
+	}{
+		{
+			name:  "unix timestamps",
+			query: "from=1000&to=4600&step=5m",
+			from:  time.Unix(1000, 0),
+			to:    time.Unix(4600, 0),
+			step:  5 * time.Minute,
+		},
+		{
+			name:  "rfc3339 and default step",
+			query: "from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z",
+			from:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:    time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+			step:  settings.DefaultMetricStep,
+		},
+		{
+			name:  "default window before to",
+			query: "to=7200",
+			from:  time.Unix(7200, 0).Add(-settings.DefaultMetricWindow),
+			to:    time.Unix(7200, 0),
+			step:  settings.DefaultMetricStep,
+		},
+		{name: "invalid from", query: "from=yesterday", err: errors.New("invalid from parameter")},
+		{name: "invalid to", query: "to=now", err: errors.New("invalid to parameter")},
+		{name: "invalid step", query: "step=often", err: errors.New("invalid step parameter")},
+		{name: "from after to", query: "from=4600&to=1000", err: errors.ErrInvalidTimeRange},
+		{name: "step below a second", query: "from=1000&to=4600&step=500ms", err: errors.ErrInvalidTimeRange},
+		{name: "too many buckets", query: "from=0&to=1000000&step=1s", err: errors.ErrTooManyBuckets},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := parseMetricQuery(httptest.NewRequest("GET", "/endpoint/id/metrics?"+test.query, nil))
+			if test.err != nil {
+				require.ErrorContains(t, err, test.err.Error())
+				return
+			}
+			require.Nil(t, err)
+			require.True(t, test.from.Equal(q.from))
+			require.True(t, test.to.Equal(q.to))
+			require.Equal(t, test.step, q.step)
+		})
+	}
+}
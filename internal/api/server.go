@@ -5,9 +5,16 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/hnimtadd/run/internal/build"
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/types"
@@ -17,26 +24,33 @@ import (
 	"github.com/google/uuid"
 )
 
-// TODO: blob metadata related apis
 type (
 	Server struct {
 		metadataStore store.Store
 		blobStore     store.BlobStore
 		logStore      store.LogStore
+		metricStore   store.MetricStore
+		deployer      *deploy.Pipeline
 		router        *chi.Mux
 		ServerConfig
 	}
 	ServerConfig struct {
 		Addr    string
 		Version string
+		// IngressAdminURL is the base url of the admin endpoints of the ingress, served at its admin address rather
+		// than its ingress one, which are told to stop the runtimes of deleted deployments. The ingress stops them on
+		// its own sweep if it is unset.
+		IngressAdminURL string
 	}
 )
 
-func NewServer(store store.Store, logStore store.LogStore, blobStore store.BlobStore, config ServerConfig) *Server {
+func NewServer(store store.Store, logStore store.LogStore, blobStore store.BlobStore, metricStore store.MetricStore, deployer *deploy.Pipeline, config ServerConfig) *Server {
 	return &Server{
 		metadataStore: store,
 		logStore:      logStore,
 		blobStore:     blobStore,
+		metricStore:   metricStore,
+		deployer:      deployer,
 		ServerConfig:  config,
 	}
 }
@@ -48,10 +62,25 @@ func (s *Server) InitRoute() {
 	s.router.Get("/endpoint/{id}", makeAPIHandler(s.HandleGetEndpointByID))
 	s.router.Post("/endpoint/{id}/deploy", makeAPIHandler(s.HandlePostDeployment))
 	s.router.Get("/endpoint/{id}/deploy", makeAPIHandler(s.HandleGetDeploymentsOfEndpoint))
-	s.router.Options("/endpoint/{id}/rollback", makeAPIHandler(s.HandleRollback))
+	s.router.Post("/endpoint/{id}/rollback", makeAPIHandler(s.HandleRollback))
+	s.router.Post("/endpoint/{id}/activate", makeAPIHandler(s.HandleActivate))
+	s.router.Get("/endpoint/{id}/metrics", makeAPIHandler(s.HandleGetMetricsOfEndpoint))
+	s.router.Put("/endpoint/{id}/retention", makeAPIHandler(s.HandleUpdateRetention))
+	s.router.Put("/endpoint/{id}/hosts", makeAPIHandler(s.HandleUpdateHosts))
+	s.router.Put("/endpoint/{id}/traffic", makeAPIHandler(s.HandleUpdateTraffic))
+	s.router.Post("/endpoint/{id}/promote", makeAPIHandler(s.HandlePromote))
+	s.router.Put("/endpoint/{id}/health", makeAPIHandler(s.HandleUpdateHealth))
+	s.router.Get("/endpoint/{id}/events", makeAPIHandler(s.HandleGetEventsOfEndpoint))
+	s.router.Put("/endpoint/{id}/history", makeAPIHandler(s.HandleUpdateHistory))
+	s.router.Post("/endpoint/{id}/prune", makeAPIHandler(s.HandlePruneHistory))
 
 	s.router.Get("/deployment/{id}", makeAPIHandler(s.HandleGetDeployment))
+	s.router.Get("/deployment/{id}/build", makeAPIHandler(s.HandleGetBuildOfDeployment))
+	s.router.Get("/deployment/{id}/blob", makeAPIHandler(s.HandleGetBlobOfDeployment))
 	s.router.Get("/deployment/{id}/log", makeAPIHandler(s.HandleGetLogOfDeployment))
+	s.router.Get("/deployment/{id}/log/stream", makeAPIHandler(s.HandleTailLogOfDeployment))
+	s.router.Delete("/deployment/{id}/log", makeAPIHandler(s.HandlePurgeLogOfDeployment))
+	s.router.Get("/deployment/{id}/metrics", makeAPIHandler(s.HandleGetMetricsOfDeployment))
 
 	s.router.Get("/request/{id}/log", makeAPIHandler(s.HandleGetLogOfRequest))
 }
@@ -63,9 +92,22 @@ func (s *Server) ListenAndServe() error {
 }
 
 type CreateEndpointParams struct {
-	Name        string            `json:"name"`        // Name of the endpoint
-	Runtime     string            `json:"runtime"`     // Runtime on which the code will be invoked. (go or js for now)
-	Environment map[string]string `json:"environment"` // A map of environment variables
+	Name          string                  `json:"name"`          // Name of the endpoint
+	Slug          string                  `json:"slug"`          // Unique slug addressing the endpoint wherever its ID does, derived from the name if unset
+	Runtime       string                  `json:"runtime"`       // Runtime on which the code will be invoked. (go or js for now)
+	Environment   map[string]string       `json:"environment"`   // A map of environment variables
+	Limits        types.ResourceLimits    `json:"limits"`        // Resource limits of a single request, unset limits fall back to the defaults
+	Streaming     bool                    `json:"streaming"`     // Stream request and response bodies, only supported by go runtime
+	Retention     types.RetentionPolicy   `json:"retention"`     // Retention of request logs, unset bounds fall back to the defaults
+	WarmInstances int                     `json:"warmInstances"` // Initialized instances of reactor modules kept by each runtime
+	Concurrency   types.ConcurrencyPolicy `json:"concurrency"`   // Runtimes serving a deployment and requests queued on each, unset bounds fall back to the defaults
+	Hosts         []string                `json:"hosts"`         // Custom domains served by the endpoint, besides {slug}.{edge domain}
+	Health        types.HealthPolicy      `json:"health"`        // Rules newly active deployments are rolled back by, no rule is checked if unset
+	History       types.HistoryPolicy     `json:"history"`       // Deployments kept when the history is pruned, unset bounds fall back to the defaults
+
+	// Deprecated: use Limits.MaxWallTime, the timeout of a single request in milliseconds is only kept for the
+	// clients created before limits, it is ignored if Limits.MaxWallTime is set.
+	Timeout int64 `json:"timeout,omitempty"`
 }
 
 func (s *Server) HandleCreateEndpoint(w http.ResponseWriter, r *http.Request) error {
@@ -79,19 +121,129 @@ func (s *Server) HandleCreateEndpoint(w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
 	}
-	if err := s.metadataStore.CreateEndpoint(endpoint); err != nil {
+	if params.Limits.MaxWallTime == 0 {
+		params.Limits.MaxWallTime = params.Timeout
+	}
+	if err := params.Limits.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := params.Retention.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := types.ValidateWarmInstances(params.WarmInstances); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := params.Concurrency.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := params.Health.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := params.History.Validate(); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if params.Slug == "" {
+		params.Slug = types.Slugify(params.Name)
+	}
+	if err := types.ValidateSlug(params.Slug); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	hosts, err := types.NormalizeHosts(params.Hosts)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	if err := s.checkHostClaims(endpoint.ID, hosts); err != nil {
+		return utils.WriteJSON(w, statusOfHostClaims(err), utils.MakeErrorResponse(err))
+	}
+	endpoint.Slug = params.Slug
+	endpoint.Hosts = hosts
+	endpoint.Limits = params.Limits
+	endpoint.Retention = params.Retention
+	endpoint.Streaming = params.Streaming
+	endpoint.WarmInstances = params.WarmInstances
+	endpoint.Concurrency = params.Concurrency
+	endpoint.Health = params.Health
+	endpoint.History = params.History
+	if err := s.metadataStore.CreateEndpoint(endpoint); errors.Is(err, errors.ErrSlugExisted) {
+		return utils.WriteJSON(w, http.StatusConflict, utils.MakeErrorResponse(err))
+	} else if err != nil {
 		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 	}
 	return utils.WriteJSON(w, http.StatusOK, endpoint)
 }
 
+type UpdateHostsParams struct {
+	Hosts []string `json:"hosts"` // Custom domains served by the endpoint, replacing the current ones
+}
+
+// HandleUpdateHosts replaces the custom domains claimed by the endpoint, the ingress routes them once it reloads its
+// routing table.
+func (s *Server) HandleUpdateHosts(w http.ResponseWriter, r *http.Request) error {
+	params := new(UpdateHostsParams)
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+	hosts, err := types.NormalizeHosts(params.Hosts)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	endpointID := endpoint.ID.String()
+	if err := s.checkHostClaims(endpoint.ID, hosts); err != nil {
+		return utils.WriteJSON(w, statusOfHostClaims(err), utils.MakeErrorResponse(err))
+	}
+	if err := s.metadataStore.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Hosts: hosts}); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpointID,
+		"host":       endpoint.Host(),
+		"hosts":      hosts,
+	})
+}
+
+// checkHostClaims returns errors.ErrHostClaimed if one of the hosts is claimed by an endpoint other than endpointID.
+func (s *Server) checkHostClaims(endpointID uuid.UUID, hosts []string) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	endpoints, err := s.metadataStore.GetEndpoints()
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.ID == endpointID {
+			continue
+		}
+		for _, host := range hosts {
+			if slices.Contains(endpoint.Hosts, host) {
+				return errors.Newf("%w, %s is claimed by endpoint %s", errors.ErrHostClaimed, host, endpoint.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func statusOfHostClaims(err error) int {
+	if errors.Is(err, errors.ErrHostClaimed) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *Server) HandleGetEndpointByID(w http.ResponseWriter, r *http.Request) error {
-	endpointID := chi.URLParam(r, "id")
-	slog.Info("receive get endpoint by Id request", "endpointID", endpointID)
-	endpoint, err := s.metadataStore.GetEndpointByID(endpointID)
+	endpointRef := chi.URLParam(r, "id")
+	slog.Info("receive get endpoint by Id request", "endpoint", endpointRef)
+	endpoint, err := store.GetEndpoint(s.metadataStore, endpointRef)
 	if err != nil {
 		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
+	endpointID := endpoint.ID.String()
 
 	deployments, err := s.metadataStore.GetDeploymentsByEndpointID(endpointID)
 	if err != nil {
@@ -111,8 +263,7 @@ func (s *Server) HandleGetEndpoints(w http.ResponseWriter, _ *http.Request) erro
 }
 
 func (s *Server) HandlePostDeployment(w http.ResponseWriter, r *http.Request) error {
-	endpointID := chi.URLParam(r, "id")
-	endpoint, err := s.metadataStore.GetEndpointByID(endpointID)
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
 	if err != nil {
 		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
@@ -122,6 +273,15 @@ func (s *Server) HandlePostDeployment(w http.ResponseWriter, r *http.Request) er
 		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 	}
 
+	canary, err := parseCanary(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	if files := r.MultipartForm.File["source"]; len(files) > 0 {
+		return s.handlePostSourceDeployment(w, endpoint, files, canary)
+	}
+
 	f, _, err := r.FormFile("blob")
 	if err != nil {
 		slog.Info("cannot get file from form ", "msg", err.Error())
@@ -141,47 +301,93 @@ func (s *Server) HandlePostDeployment(w http.ResponseWriter, r *http.Request) er
 			map[string]any{"error": "given blob exceed maxsize", "accepted": settings.MaxBlobSize})
 	}
 
-	// TODO: fix, currently, if user need to update new environment value to the request, we must extract it from the body.
-	deployment, _ := types.NewDeployment(endpoint, endpoint.Environment)
+	return s.enqueueDeployment(w, endpoint, deploy.Job{Blob: buf.Bytes()}, canary)
+}
 
-	blobMetadata, _ := types.NewRawBlobMetadata(deployment, buf.Bytes())
+// handlePostSourceDeployment deploys go source which is built to the module, the source is either a single tarball
+// of the module or its files, which are put at the module root.
+func (s *Server) handlePostSourceDeployment(w http.ResponseWriter, endpoint *types.Endpoint, files []*multipart.FileHeader, canary int) error {
+	if endpoint.Runtime != "go" {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrBuildUnsupportedRuntime))
+	}
 
-	_, err = s.blobStore.AddDeploymentBlob(blobMetadata, buf.Bytes())
+	src, err := readSource(files)
+	if errors.Is(err, errors.ErrSourceTooLarge) {
+		return utils.WriteJSON(w,
+			http.StatusBadRequest,
+			map[string]any{"error": err.Error(), "accepted": settings.MaxSourceSize})
+	}
 	if err != nil {
-		slog.Info("failed to store deployment blob", "msg", err.Error(), "node", "api server")
-		return utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
-			"error": "failed to create deployment",
-		})
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
 	}
-	deployment.Hash = blobMetadata.Hash
+	if !src.HasGoFiles() {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrEmptySource))
+	}
+
+	return s.enqueueDeployment(w, endpoint, deploy.Job{Source: src}, canary)
+}
 
+// enqueueDeployment creates a pending deployment of the endpoint and queues the job which deploys it, the
+// deployment becomes active once the job is done, or serves canary percent of the live requests if it is set.
+func (s *Server) enqueueDeployment(w http.ResponseWriter, endpoint *types.Endpoint, job deploy.Job, canary int) error {
+	// TODO: fix, currently, if user need to update new environment value to the request, we must extract it from the body.
+	deployment, _ := types.NewDeployment(endpoint, endpoint.Environment)
+	deployment.Canary = canary
 	if err := s.metadataStore.CreateDeployment(deployment); err != nil {
 		slog.Info("cannot create deployment in store", "msg", err.Error())
 		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 	}
 
-	if err := s.metadataStore.UpdateActiveDeploymentOfEndpoint(endpoint.ID.String(), deployment.ID.String()); err != nil {
-		slog.Info("cannot update active deployment for given endpoint", "msg", err.Error())
-		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	job.Deployment = deployment
+	if err := s.deployer.Enqueue(job); err != nil {
+		params := store.UpdateDeploymentParams{Status: types.DeploymentStatusFailed, Error: err.Error()}
+		if err := s.metadataStore.UpdateDeployment(deployment.ID.String(), params); err != nil {
+			slog.Info("cannot mark deployment as failed", "msg", err.Error())
+		}
+		return utils.WriteJSON(w, http.StatusServiceUnavailable, utils.MakeErrorResponse(err))
 	}
 
-	err = s.metadataStore.CreateBlobMetadata(blobMetadata)
-	if err != nil {
-		slog.Info("cannot create blob metadata", "msg", err.Error())
-		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	return utils.WriteJSON(w, http.StatusAccepted, FromInternalDeployment(deployment))
+}
+
+func readSource(files []*multipart.FileHeader) (build.Source, error) {
+	if len(files) == 1 && build.IsTarball(files[0].Filename) {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		return build.ReadTarball(f, settings.MaxSourceSize)
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, FromInternalDeployment(deployment))
+	src := make(build.Source)
+	for _, file := range files {
+		if src.Size()+file.Size > settings.MaxSourceSize {
+			return nil, errors.ErrSourceTooLarge
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := src.Add(file.Filename, data); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
 }
 
 func (s *Server) HandleGetDeploymentsOfEndpoint(w http.ResponseWriter, r *http.Request) error {
-	endpointID := chi.URLParam(r, "id")
-
-	if _, err := s.metadataStore.GetEndpointByID(endpointID); err != nil {
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
 		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
 
-	deployments, err := s.metadataStore.GetDeploymentsByEndpointID(endpointID)
+	deployments, err := s.metadataStore.GetDeploymentsByEndpointID(endpoint.ID.String())
 	if err != nil {
 		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 	}
@@ -204,159 +410,257 @@ func (s *Server) HandleGetDeployment(w http.ResponseWriter, r *http.Request) err
 	return utils.WriteJSON(w, http.StatusOK, FromInternalDeployment(deployment))
 }
 
+func (s *Server) HandleGetBuildOfDeployment(w http.ResponseWriter, r *http.Request) error {
+	deploymentID := chi.URLParam(r, "id")
+
+	deployment, err := s.metadataStore.GetDeploymentByID(deploymentID)
+	if err != nil {
+		slog.Info("deployment not existed", "msg", err)
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"id":     deployment.ID.String(),
+		"status": string(deploymentStatus(deployment)),
+		"log":    deployment.BuildLog,
+		"error":  deployment.Error,
+	})
+}
+
+// HandleGetBlobOfDeployment returns the blob metadata of the deployment, along with what the inspection of its
+// module found.
+func (s *Server) HandleGetBlobOfDeployment(w http.ResponseWriter, r *http.Request) error {
+	deploymentID := chi.URLParam(r, "id")
+
+	if _, err := s.metadataStore.GetDeploymentByID(deploymentID); err != nil {
+		slog.Info("deployment not existed", "msg", err)
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+
+	blobMetadata, err := s.metadataStore.GetBlobMetadataByDeploymentID(deploymentID)
+	if err == nil && blobMetadata == nil {
+		err = errors.ErrDocumentNotFound
+	}
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, blobMetadata)
+}
+
 func (s *Server) HandleGetLogOfRequest(w http.ResponseWriter, r *http.Request) error {
 	requestID := chi.URLParam(r, "id")
+	level, err := parseLogLevel(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
 	log, err := s.logStore.GetLogByRequestID(requestID)
 	if err != nil {
 		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
-	return utils.WriteJSON(w, http.StatusOK, FromInternalRequestLog(log))
+	return utils.WriteJSON(w, http.StatusOK, FromInternalRequestLog(log, level))
 }
 
-func FromInternalRequestLog(log *types.RequestLog) map[string]any {
+// parseLogLevel parses the ?level= query parameter, which is the minimum level of returned log entries.
+func parseLogLevel(r *http.Request) (types.LogLevel, error) {
+	raw := r.URL.Query().Get("level")
+	if raw == "" {
+		return types.LogLevelDebug, nil
+	}
+	level, ok := types.ParseLogLevel(raw)
+	if !ok {
+		return "", errors.ErrInvalidLogLevel
+	}
+	return level, nil
+}
+
+// FromInternalRequestLog converts the log, only entries which are at least as severe as level are returned.
+func FromInternalRequestLog(log *types.RequestLog, level types.LogLevel) map[string]any {
+	entries := types.FilterLogEntries(log.LogEntries(), level)
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.Message)
+	}
 	return map[string]any{
 		"requestID":    log.RequestID.String(),
-		"deploymentID": log.RequestID.String(),
-		"logs":         log.Contents,
+		"deploymentID": log.DeploymentID.String(),
+		"logs":         lines,
+		"entries":      entries,
 		"createdAt":    time.Unix(log.CreatedAt, 0).String(),
+		"errorClass":   log.ErrorClass,
+		"status":       log.Status,
 	}
 }
 
 func (s *Server) HandleGetLogOfDeployment(w http.ResponseWriter, r *http.Request) error {
 	deploymentID := chi.URLParam(r, "id")
-	_, err := s.metadataStore.GetDeploymentByID(deploymentID)
+	level, err := parseLogLevel(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	_, err = s.metadataStore.GetDeploymentByID(deploymentID)
 	if err != nil {
 		slog.Info("deployment not existed", "msg", err)
 		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
 
-	logs, err := s.logStore.GetLogOfDeployment(deploymentID)
+	params, err := parseLogQuery(r)
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+
+	page, err := s.logStore.QueryLogOfDeployment(deploymentID, *params)
+	if errors.Is(err, errors.ErrInvalidCursor) {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
 	if err != nil {
 		slog.Info("log of deployment not existed", "msg", err)
 		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 	}
-	var rspLogs []map[string]any
-	for _, log := range logs {
-		rspLogs = append(rspLogs, FromInternalRequestLog(log))
+	rspLogs := make([]map[string]any, 0, len(page.Logs))
+	for _, log := range page.Logs {
+		rspLogs = append(rspLogs, FromInternalRequestLog(log, level))
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, rspLogs)
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"logs":       rspLogs,
+		"nextCursor": page.NextCursor,
+	})
 }
 
+// HandleRollback makes the given deployment, or the latest servable deployment created before the active one, the
+// active deployment of the endpoint. Deployments are kept, so that the endpoint could be rolled forward again.
 func (s *Server) HandleRollback(w http.ResponseWriter, r *http.Request) error {
-	endpointID := chi.URLParam(r, "id")
+	endpointRef := chi.URLParam(r, "id")
 	deploymentID := r.URL.Query().Get("deploymentID")
-	slog.Info("rollback for", "deploymentID", deploymentID, "endpoint", endpointID)
+	slog.Info("rollback for", "deploymentID", deploymentID, "endpoint", endpointRef)
 
-	endpoint, err := s.metadataStore.GetEndpointByID(endpointID)
+	endpoint, err := store.GetEndpoint(s.metadataStore, endpointRef)
 	if err != nil {
 		slog.Info("cannot get endpoint", "msg", err.Error())
-		return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "endpoint not existed"})
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
 	}
-
 	if !endpoint.HasActiveDeploy() {
 		return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot rollback on empty endpoint"})
 	}
 
-	deployments, err := s.metadataStore.GetDeploymentsByEndpointID(endpointID)
-	if err != nil {
-		slog.Info("cannot get deployments", "msg", err.Error())
-		return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot get deployments of given endpoint"})
-	}
-
-	switch deploymentID {
-	case "":
-		// default, rollback to latest deployment
-		// maybe if endpoint have only 1 deployment, we could set the endpoint activeDeploymentID to null
-		latestDeploymentUID := endpoint.ActiveDeploymentID
-		currentDeploymentUID := uuid.Nil
-		if len(deployments) >= 2 {
-			currentDeploymentUID = deployments[len(deployments)-2].ID
-		}
-
-		blobMetadata, err := s.metadataStore.GetBlobMetadataByDeploymentID(latestDeploymentUID.String())
-		if err != nil {
-			slog.Info("cannot get blob metadata", "endpoint", endpointID, "deployment", latestDeploymentUID.String(), "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-		}
-		deleted, err := s.blobStore.DeleteDeploymentBlob(blobMetadata.Location)
-		if err != nil {
-			slog.Info("cannot remove blob from blob storage", "endpoint", endpointID, "deployment", latestDeploymentUID.String(), "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-		}
-
-		if !deleted {
-			slog.Info("delete blob failed", "endpoint", endpointID, "deployment", latestDeploymentUID.String())
-		}
-
-		if err := s.metadataStore.DeleteDeployment(latestDeploymentUID.String()); err != nil {
-			slog.Info("cannot delete current deployment of endpoint", "endpoint", endpointID, "deployment", latestDeploymentUID.String(), "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-		}
-		if err := s.metadataStore.UpdateActiveDeploymentOfEndpoint(endpointID, currentDeploymentUID.String()); err != nil {
-			slog.Info("cannot update active deployment of endpoint", "endpoint", endpointID, "deployment", currentDeploymentUID.String(), "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-		}
-	default:
-		_, err := s.metadataStore.GetDeploymentByID(deploymentID)
+	if deploymentID == "" {
+		deployments, err := s.metadataStore.GetDeploymentsByEndpointID(endpoint.ID.String())
 		if err != nil {
-			slog.Info("cannot get given deploymentID", "endpoint", endpointID, "deployment", deploymentID, "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+			slog.Info("cannot get deployments", "msg", err.Error())
+			return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
 		}
-		// since deployments already in ascending order, we will loop from the beginning then check
-		// if we meet the deployment then, we will delete following deployments
-
-		sinceIdx := -1
-		for idx, deployment := range deployments {
-			if deployment.ID.String() == deploymentID {
-				sinceIdx = idx + 1
+		sort.SliceStable(deployments, func(i, j int) bool { return deployments[i].CreatedAt < deployments[j].CreatedAt })
+		// the previous deployment is the latest servable one before the active, builds which failed have nothing to serve.
+		for _, deployment := range deployments {
+			if deployment.ID == endpoint.ActiveDeploymentID {
 				break
 			}
+			if deployment.IsServable() {
+				deploymentID = deployment.ID.String()
+			}
 		}
-
-		if sinceIdx == -1 {
-			return utils.WriteJSON(
-				w,
-				http.StatusBadRequest,
-				map[string]any{
-					"error": "unexpected error, could not found deployment from endpoint's deployments",
-				})
+		if deploymentID == "" {
+			return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "endpoint has no previous deployment to roll back to"})
 		}
+	}
+	// the deployment rolled back to is restored rather than new, so it is not held to the health policy again.
+	return s.activate(w, endpoint, deploymentID, 0)
+}
 
-		for idx := sinceIdx; idx < len(deployments); idx++ {
-			deploymentUID := deployments[idx].ID.String()
-			blobMetadata, err := s.metadataStore.GetBlobMetadataByDeploymentID(deploymentUID)
-			if err != nil {
-				slog.Info("cannot get blob metadata", "endpoint", endpointID, "deployment", deploymentUID, "msg", err.Error())
-				return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-			}
-			deleted, err := s.blobStore.DeleteDeploymentBlob(blobMetadata.Location)
-			if err != nil {
-				slog.Info("cannot remove blob from blob storage", "endpoint", endpointID, "deployment", deploymentUID, "msg", err.Error())
-				return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-			}
+type ActivateParams struct {
+	DeploymentID string `json:"deploymentID"` // Deployment of the endpoint to make active, older or newer than the active one
+}
 
-			if !deleted {
-				slog.Info("delete blob failed", "endpoint", endpointID, "deployment", deploymentUID)
-			}
+// HandleActivate makes the deployment the active deployment of the endpoint, which rolls the endpoint back or
+// forward. Deployments and their blobs are kept.
+func (s *Server) HandleActivate(w http.ResponseWriter, r *http.Request) error {
+	params := new(ActivateParams)
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+	if params.DeploymentID == "" {
+		return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "deploymentID is required"})
+	}
 
-			if err := s.metadataStore.DeleteDeployment(deploymentUID); err != nil {
-				slog.Info("cannot delete given deployment of endpoint", "endpoint", endpointID, "deployment", deploymentUID, "msg", err.Error())
-				return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
-			}
-		}
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	return s.activate(w, endpoint, params.DeploymentID, time.Now().Unix())
+}
 
-		// rollback to specific deployment
+// activate switches the active deployment of the endpoint to the deployment, the previously active deployment is
+// retired along with the canaries of the endpoint. activatedAt is given as to markActive.
+func (s *Server) activate(w http.ResponseWriter, endpoint *types.Endpoint, deploymentID string, activatedAt int64) error {
+	endpointID := endpoint.ID.String()
+	deployment, err := s.metadataStore.GetDeploymentByID(deploymentID)
+	if err == nil && deployment.EndpointID != endpoint.ID {
+		err = errors.Newf("%w, %s is a deployment of another endpoint", errors.ErrDeploymentNotExisted, deploymentID)
+	}
+	if err != nil {
+		slog.Info("cannot get given deploymentID", "endpoint", endpointID, "deployment", deploymentID, "msg", err.Error())
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	if !deployment.IsServable() {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDeploymentNotReady))
+	}
+
+	previous := endpoint.ActiveDeploymentID
+	if previous != deployment.ID {
+		if err := s.dropCanaries(endpoint, uuid.Nil); err != nil {
+			return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+		}
 		if err := s.metadataStore.UpdateActiveDeploymentOfEndpoint(endpointID, deploymentID); err != nil {
 			slog.Info("cannot update active deployment of endpoint", "endpoint", endpointID, "deployment", deploymentID, "msg", err.Error())
-			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+			return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+		}
+		s.markActive(deploymentID, activatedAt)
+		if previous != uuid.Nil {
+			s.markStatus(previous.String(), types.DeploymentStatusRetired)
+			go s.removeRuntimes(previous.String())
 		}
 	}
 	return utils.WriteJSON(w, http.StatusOK, map[string]any{
-		"msg": "rollback operation successfully",
+		"endpointID":           endpointID,
+		"activeDeploymentID":   deploymentID,
+		"previousDeploymentID": previous.String(),
 	})
 }
 
+// removeRuntimes asks the ingress to stop the runtimes of the retired or deleted deployment, so that their modules are
+// freed without waiting for the ingress to notice. It is best effort since the ingress sweeps them anyway.
+func (s *Server) removeRuntimes(deploymentID string) {
+	if s.IngressAdminURL == "" {
+		return
+	}
+	url := strings.TrimSuffix(s.IngressAdminURL, "/") + "/admin/runtimes/" + deploymentID
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		slog.Info("cannot make request to remove runtimes", "deployment", deploymentID, "msg", err.Error())
+		return
+	}
+	client := http.Client{Timeout: settings.IngressAdminTimeout}
+	rsp, err := client.Do(req)
+	if err != nil {
+		slog.Info("cannot remove runtimes of deployment", "deployment", deploymentID, "msg", err.Error())
+		return
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusAccepted {
+		slog.Info("ingress refused to remove runtimes of deployment", "deployment", deploymentID, "status", rsp.StatusCode)
+	}
+}
+
+// markActive marks the deployment which an endpoint was rolled back or promoted to as active. activatedAt is only
+// given when the deployment is new to the endpoint, so that it is held to its health policy, rather than restored.
+func (s *Server) markActive(deploymentID string, activatedAt int64) {
+	params := store.UpdateDeploymentParams{Status: types.DeploymentStatusActive, ActivatedAt: activatedAt}
+	if err := s.metadataStore.UpdateDeployment(deploymentID, params); err != nil {
+		slog.Info("cannot mark deployment as active", "deployment", deploymentID, "msg", err.Error())
+	}
+}
+
 func handleStatus(w http.ResponseWriter, _ *http.Request) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -370,17 +674,38 @@ func FromInternalDeployment(d *types.Deployment) map[string]string {
 		"hash":       d.Hash,
 		"endpointID": d.EndpointID.String(),
 		"createdAt":  time.Unix(d.CreatedAt, 0).String(),
+		"status":     string(deploymentStatus(d)),
+		"error":      d.Error,
+	}
+}
+
+// deploymentStatus returns the status of the deployment, deployments stored before the status existed are ready.
+func deploymentStatus(d *types.Deployment) types.DeploymentStatus {
+	if d.Status == "" {
+		return types.DeploymentStatusReady
 	}
+	return d.Status
 }
 
 type Endpoint struct {
-	ID                 string              `json:"id,omitempty"`
-	Name               string              `json:"name,omitempty"`
-	Runtime            string              `json:"runtime,omitempty"`
-	Environment        map[string]string   `json:"environment,omitempty"`
-	ActiveDeploymentID string              `json:"activeDeploymentID,omitempty"`
-	DeployHistory      []map[string]string `json:"deployHistory,omitempty"`
-	CreatedAt          string              `json:"createdAt,omitempty"`
+	ID                 string                  `json:"id,omitempty"`
+	Name               string                  `json:"name,omitempty"`
+	Slug               string                  `json:"slug,omitempty"`
+	Runtime            string                  `json:"runtime,omitempty"`
+	Environment        map[string]string       `json:"environment,omitempty"`
+	ActiveDeploymentID string                  `json:"activeDeploymentID,omitempty"`
+	DeployHistory      []map[string]string     `json:"deployHistory,omitempty"`
+	CreatedAt          string                  `json:"createdAt,omitempty"`
+	Limits             types.ResourceLimits    `json:"limits"`
+	Streaming          bool                    `json:"streaming"`
+	Retention          types.RetentionPolicy   `json:"retention"`
+	WarmInstances      int                     `json:"warmInstances"`
+	Concurrency        types.ConcurrencyPolicy `json:"concurrency"`
+	Host               string                  `json:"host,omitempty"` // host the endpoint is served at by its slug
+	Hosts              []string                `json:"hosts,omitempty"`
+	Traffic            []types.TrafficTarget   `json:"traffic,omitempty"` // split of live requests, all of them go to the active deployment if empty
+	Health             types.HealthPolicy      `json:"health"`
+	History            types.HistoryPolicy     `json:"history"`
 }
 
 func FromInternalEndpoint(endpoint *types.Endpoint, deployments []*types.Deployment) Endpoint {
@@ -391,10 +716,21 @@ func FromInternalEndpoint(endpoint *types.Endpoint, deployments []*types.Deploym
 	return Endpoint{
 		ID:                 endpoint.ID.String(),
 		Name:               endpoint.Name,
+		Slug:               endpoint.Slug,
 		Runtime:            endpoint.Runtime,
 		Environment:        endpoint.Environment,
 		ActiveDeploymentID: endpoint.ActiveDeploymentID.String(),
 		DeployHistory:      deployHistory,
 		CreatedAt:          time.Unix(endpoint.CreatedAt, 0).String(),
+		Limits:             endpoint.Limits.WithDefaults(),
+		Streaming:          endpoint.Streaming,
+		Retention:          endpoint.Retention.WithDefaults(),
+		WarmInstances:      endpoint.WarmInstances,
+		Concurrency:        endpoint.Concurrency.WithDefaults(),
+		Host:               endpoint.Host(),
+		Hosts:              endpoint.Hosts,
+		Traffic:            endpoint.Traffic,
+		Health:             endpoint.Health.WithDefaults(),
+		History:            endpoint.History.WithDefaults(),
 	}
 }
@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hnimtadd/run/internal/api"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCreateEndpoint_Timeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		status      int
+		maxWallTime int64
+	}{
+		{
+			name:        "deprecated timeout",
+			body:        `{"name":"hello","runtime":"go","timeout":2500}`,
+			status:      http.StatusOK,
+			maxWallTime: 2500,
+		},
+		{
+			name:        "max wall time wins over timeout",
+			body:        `{"name":"hello","runtime":"go","timeout":2500,"limits":{"maxWallTime":1000}}`,
+			status:      http.StatusOK,
+			maxWallTime: 1000,
+		},
+		{
+			name:   "invalid timeout",
+			body:   `{"name":"hello","runtime":"go","timeout":-1}`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memoryStore := store.NewMemoryStore()
+			server := api.NewServer(memoryStore, memoryStore, memoryStore, memoryStore, nil, api.ServerConfig{})
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader(test.body))
+			require.Nil(t, server.HandleCreateEndpoint(rec, req))
+			require.Equal(t, test.status, rec.Code)
+			if test.status != http.StatusOK {
+				return
+			}
+
+			endpoint := new(types.Endpoint)
+			require.Nil(t, json.NewDecoder(rec.Body).Decode(endpoint))
+			require.Equal(t, test.maxWallTime, endpoint.Limits.MaxWallTime)
+		})
+	}
+}
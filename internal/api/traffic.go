@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// parseCanary returns the percent of the live requests a new deployment serves as a canary, given by the canary
+// form value, or 0 if the deployment is meant to take every request.
+func parseCanary(r *http.Request) (int, error) {
+	raw := r.FormValue("canary")
+	if raw == "" {
+		return 0, nil
+	}
+	canary, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Newf("%v, canary must be a percent", errors.ErrInvalidTraffic)
+	}
+	return canary, types.ValidateCanaryWeight(canary)
+}
+
+type UpdateTrafficParams struct {
+	Traffic []types.TrafficTarget `json:"traffic"` // Split of the live requests, including the active deployment, an empty split sends all of them to it
+}
+
+// HandleUpdateTraffic splits the live requests of the endpoint across its active deployment and its canaries, which
+// are the other deployments of the split. Canaries left out of the split are retired.
+func (s *Server) HandleUpdateTraffic(w http.ResponseWriter, r *http.Request) error {
+	params := new(UpdateTrafficParams)
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	if !endpoint.HasActiveDeploy() {
+		return utils.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot split traffic of endpoint without active deployment"})
+	}
+	if err := types.ValidateTraffic(params.Traffic, endpoint.ActiveDeploymentID); err != nil {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+	}
+	var canaries []*types.Deployment
+	for _, target := range params.Traffic {
+		if target.DeploymentID == endpoint.ActiveDeploymentID {
+			continue
+		}
+		deployment, err := s.metadataStore.GetDeploymentByID(target.DeploymentID.String())
+		if err != nil || deployment.EndpointID != endpoint.ID {
+			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(
+				errors.Newf("%v, deployment %s is not a deployment of the endpoint", errors.ErrInvalidTraffic, target.DeploymentID)))
+		}
+		if !deployment.IsServable() {
+			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDeploymentNotReady))
+		}
+		canaries = append(canaries, deployment)
+	}
+
+	endpointID := endpoint.ID.String()
+	traffic := append([]types.TrafficTarget{}, params.Traffic...)
+	if err := s.metadataStore.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Traffic: traffic}); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	for _, deployment := range canaries {
+		if deployment.Status != types.DeploymentStatusCanary {
+			s.markStatus(deployment.ID.String(), types.DeploymentStatusCanary)
+		}
+	}
+	s.retireCanaries(endpoint, func(deploymentID uuid.UUID) bool {
+		return slices.ContainsFunc(traffic, func(target types.TrafficTarget) bool { return target.DeploymentID == deploymentID })
+	})
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID": endpointID,
+		"traffic":    traffic,
+	})
+}
+
+type PromoteParams struct {
+	DeploymentID string `json:"deploymentID"` // Canary made active, the one serving the most requests if unset
+}
+
+// HandlePromote makes a canary of the endpoint its active deployment, which then serves every live request. The
+// previously active deployment and the other canaries are retired.
+func (s *Server) HandlePromote(w http.ResponseWriter, r *http.Request) error {
+	params := new(PromoteParams)
+	// the body is optional, the top canary is promoted without one.
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrDecodeRequestBody))
+		}
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	endpoint, err := store.GetEndpoint(s.metadataStore, chi.URLParam(r, "id"))
+	if err != nil {
+		return utils.WriteJSON(w, http.StatusNotFound, utils.MakeErrorResponse(err))
+	}
+	canary := endpoint.Canary()
+	if params.DeploymentID != "" {
+		canary, err = uuid.Parse(params.DeploymentID)
+		if err != nil {
+			return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(err))
+		}
+	}
+	isCanary := canary != endpoint.ActiveDeploymentID && slices.ContainsFunc(endpoint.Traffic, func(target types.TrafficTarget) bool {
+		return target.DeploymentID == canary
+	})
+	if !isCanary {
+		return utils.WriteJSON(w, http.StatusBadRequest, utils.MakeErrorResponse(errors.ErrNoCanary))
+	}
+
+	endpointID := endpoint.ID.String()
+	if err := s.metadataStore.UpdateActiveDeploymentOfEndpoint(endpointID, canary.String()); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	s.markActive(canary.String(), time.Now().Unix())
+	previous := endpoint.ActiveDeploymentID
+	s.markStatus(previous.String(), types.DeploymentStatusRetired)
+	go s.removeRuntimes(previous.String())
+	if err := s.dropCanaries(endpoint, canary); err != nil {
+		return utils.WriteJSON(w, http.StatusInternalServerError, utils.MakeErrorResponse(err))
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"endpointID":         endpointID,
+		"activeDeploymentID": canary.String(),
+		"retired":            previous.String(),
+	})
+}
+
+// dropCanaries sends every live request of the endpoint to its active deployment and retires its canaries, besides
+// keep.
+func (s *Server) dropCanaries(endpoint *types.Endpoint, keep uuid.UUID) error {
+	if len(endpoint.Traffic) == 0 {
+		return nil
+	}
+	params := store.UpdateEndpointParams{Traffic: []types.TrafficTarget{}}
+	if err := s.metadataStore.UpdateEndpoint(endpoint.ID.String(), params); err != nil {
+		return err
+	}
+	s.retireCanaries(endpoint, func(deploymentID uuid.UUID) bool { return deploymentID == keep })
+	return nil
+}
+
+// retireCanaries retires the canaries of the current split of the endpoint which are not kept, and stops their
+// runtimes.
+func (s *Server) retireCanaries(endpoint *types.Endpoint, kept func(deploymentID uuid.UUID) bool) {
+	for _, target := range endpoint.Traffic {
+		if target.DeploymentID == endpoint.ActiveDeploymentID || kept(target.DeploymentID) {
+			continue
+		}
+		s.markStatus(target.DeploymentID.String(), types.DeploymentStatusRetired)
+		go s.removeRuntimes(target.DeploymentID.String())
+	}
+}
+
+// markStatus moves the deployment to given status, which is best effort as the traffic is already routed by then.
+func (s *Server) markStatus(deploymentID string, status types.DeploymentStatus) {
+	params := store.UpdateDeploymentParams{Status: status}
+	if err := s.metadataStore.UpdateDeployment(deploymentID, params); err != nil {
+		slog.Info("cannot update status of deployment", "deployment", deploymentID, "status", status, "msg", err.Error())
+	}
+}
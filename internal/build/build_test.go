@@ -0,0 +1,85 @@
+package build_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/hnimtadd/run/internal/build"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const helloMain = `package main
+
+import "fmt"
+
+func main() { fmt.Println("hello") }
+`
+
+func makeTarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.Nil(t, err)
+	}
+	require.Nil(t, tw.Close())
+	require.Nil(t, gz.Close())
+	return buf
+}
+
+func TestReadTarball(t *testing.T) {
+	tarball := makeTarball(t, map[string]string{
+		"app/go.mod":      "module app\n",
+		"app/main.go":     helloMain,
+		"app/pkg/util.go": "package pkg\n",
+	})
+	src, err := build.ReadTarball(tarball, 1<<20)
+	require.Nil(t, err)
+	require.Len(t, src, 3)
+	require.Equal(t, helloMain, string(src["main.go"]))
+	require.Contains(t, src, "pkg/util.go")
+	require.True(t, src.HasGoFiles())
+
+	_, err = build.ReadTarball(makeTarball(t, map[string]string{"../main.go": helloMain}), 1<<20)
+	require.ErrorIs(t, err, errors.ErrInvalidSourcePath)
+
+	_, err = build.ReadTarball(makeTarball(t, map[string]string{"main.go": helloMain}), 8)
+	require.ErrorIs(t, err, errors.ErrSourceTooLarge)
+}
+
+func TestSource_Add(t *testing.T) {
+	src := make(build.Source)
+	require.Nil(t, src.Add("./main.go", []byte(helloMain)))
+	require.Contains(t, src, "main.go")
+	for _, name := range []string{"/etc/passwd", "..", "../main.go", "a/../../main.go", "."} {
+		require.ErrorIs(t, src.Add(name, nil), errors.ErrInvalidSourcePath, name)
+	}
+}
+
+func TestBuilder_Build(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain is not available")
+	}
+	builder := build.NewBuilder()
+	// go settings of the host do not leak into builds.
+	t.Setenv("GOFLAGS", "-mod=vendor")
+	t.Setenv("GOTOOLCHAIN", "go1.99.0")
+
+	wasm, _, err := builder.Build(context.Background(), build.Source{"main.go": []byte(helloMain)})
+	require.Nil(t, err)
+	require.Equal(t, []byte("\x00asm"), wasm[:4])
+
+	_, output, err := builder.Build(context.Background(), build.Source{"main.go": []byte("package main\n\nfunc main() { undefined() }\n")})
+	require.NotNil(t, err)
+	require.Contains(t, output, "undefined")
+
+	_, _, err = builder.Build(context.Background(), build.Source{"README.md": []byte("no go files")})
+	require.ErrorIs(t, err, errors.ErrEmptySource)
+}
@@ -0,0 +1,142 @@
+/*
+Package build compiles deployments uploaded as go source to wasip1 modules.
+*/
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// defaultGoMod is used for sources without go.mod, such as a single main.go.
+const defaultGoMod = "module main\n\ngo 1.21\n"
+
+// inheritedEnv are the variables of the environment which builds inherit, the ones telling how to reach modules.
+var inheritedEnv = []string{
+	"PATH", "HOME", "TMPDIR",
+	"GOPROXY", "GOSUMDB", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOINSECURE",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+}
+
+type Builder struct {
+	GoBinary    string
+	Timeout     time.Duration
+	MaxLogSize  int
+	CacheDir    string // build cache shared by builds
+	ModCacheDir string // module cache shared by builds
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		GoBinary:    settings.GoBinary,
+		Timeout:     settings.BuildTimeout,
+		MaxLogSize:  settings.MaxBuildLogSize,
+		CacheDir:    settings.BuildCacheDir,
+		ModCacheDir: settings.BuildModCacheDir,
+	}
+}
+
+// Build compiles the source with GOOS=wasip1 GOARCH=wasm in its own temporary directory. It returns the wasm module
+// and the output of the build, the output is also returned when the build fails. The build uses the local toolchain
+// whatever the source asks for, ignores the go settings of the host and has its own GOPATH, see env.
+func (b *Builder) Build(ctx context.Context, src Source) ([]byte, string, error) {
+	if !src.HasGoFiles() {
+		return nil, "", errors.ErrEmptySource
+	}
+
+	dir, err := os.MkdirTemp("", "run-build-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	moduleDir := filepath.Join(dir, "src")
+	for name, data := range src {
+		file := filepath.Join(moduleDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, "", err
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			return nil, "", err
+		}
+	}
+	if _, ok := src["go.mod"]; !ok {
+		if err := os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte(defaultGoMod), 0o644); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	out := filepath.Join(dir, "main.wasm")
+	output := &limitedBuffer{max: b.MaxLogSize}
+	cmd := exec.CommandContext(ctx, b.GoBinary, "build", "-trimpath", "-o", out, ".")
+	cmd.Dir = moduleDir
+	cmd.Env = b.env(dir)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, output.String(), fmt.Errorf("build timed out after %s", b.Timeout)
+		}
+		return nil, output.String(), fmt.Errorf("build failed: %w", err)
+	}
+
+	wasm, err := os.ReadFile(out)
+	if err != nil {
+		return nil, output.String(), err
+	}
+	return wasm, output.String(), nil
+}
+
+// env returns the environment of a build in dir. Only the variables telling how to reach modules are inherited from
+// the host, the go environment file of the host is ignored, and the caches are the ones of the builder.
+func (b *Builder) env(dir string) []string {
+	env := make([]string, 0, len(inheritedEnv)+12)
+	for _, key := range inheritedEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return append(env,
+		"GOOS=wasip1", "GOARCH=wasm", "CGO_ENABLED=0",
+		"GOTOOLCHAIN=local", "GOFLAGS=", "GOWORK=off", "GOENV=off",
+		"GOPATH="+filepath.Join(dir, "gopath"),
+		"GOCACHE="+b.CacheDir,
+		"GOMODCACHE="+b.ModCacheDir,
+	)
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.Buffer.String() + "\n... build output truncated"
+	}
+	return b.Buffer.String()
+}
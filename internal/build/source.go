@@ -0,0 +1,113 @@
+package build
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/hnimtadd/run/internal/errors"
+)
+
+// Source is a go module to build, it maps slash separated paths relative to the module root with file contents.
+type Source map[string][]byte
+
+// Add adds the file to the source, the path must stay inside the module root.
+func (s Source) Add(name string, data []byte) error {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return errors.ErrInvalidSourcePath
+	}
+	s[name] = data
+	return nil
+}
+
+// Size returns the total size of files in the source.
+func (s Source) Size() int64 {
+	var size int64
+	for _, data := range s {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// HasGoFiles reports whether the source contains any go file.
+func (s Source) HasGoFiles() bool {
+	for name := range s {
+		if strings.HasSuffix(name, ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTarball reports whether the file name is the one of a tar archive, gzipped or not.
+func IsTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// ReadTarball reads the source from a tar archive, which could be gzipped. Only regular files are kept, and a
+// directory shared by every file (as produced by `tar -czf src.tgz dir`) is taken as the module root.
+func ReadTarball(r io.Reader, maxSize int64) (Source, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	} else {
+		r = br
+	}
+
+	src := make(Source)
+	var size int64
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		size += header.Size
+		if size > maxSize {
+			return nil, errors.ErrSourceTooLarge
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if err := src.Add(header.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return src.trimRoot(), nil
+}
+
+// trimRoot strips the top directory of every file if they all share it.
+func (s Source) trimRoot() Source {
+	root := ""
+	for name := range s {
+		dir, _, found := strings.Cut(name, "/")
+		if !found || (root != "" && dir != root) {
+			return s
+		}
+		root = dir
+	}
+	if root == "" {
+		return s
+	}
+	trimmed := make(Source, len(s))
+	for name, data := range s {
+		trimmed[strings.TrimPrefix(name, root+"/")] = data
+	}
+	return trimmed
+}
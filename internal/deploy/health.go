@@ -0,0 +1,161 @@
+package deploy
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
+)
+
+// HealthMonitor rolls back active deployments which break the health policy of their endpoint within its window
+// after their activation, judged by the request metrics the ingress stores. Each rollback is recorded as an event
+// of the endpoint. It assumes a single api server runs the monitor.
+type HealthMonitor struct {
+	store       store.Store
+	metricStore store.MetricStore
+	interval    time.Duration
+	stuck       map[uuid.UUID]bool // unhealthy deployments without a previous deployment to roll back to
+}
+
+func NewHealthMonitor(store store.Store, metricStore store.MetricStore, interval time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		store:       store,
+		metricStore: metricStore,
+		interval:    interval,
+		stuck:       make(map[uuid.UUID]bool),
+	}
+}
+
+// Run checks the endpoints every interval until ctx is done.
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.Check(time.Now())
+	}
+}
+
+// Check checks the active deployment of every endpoint against its health policy at now, it returns the events of
+// the rollbacks it made.
+func (m *HealthMonitor) Check(now time.Time) []*types.Event {
+	endpoints, err := m.store.GetEndpoints()
+	if err != nil {
+		slog.Error("cannot get endpoints to check their health", "msg", err.Error())
+		return nil
+	}
+	var events []*types.Event
+	for _, endpoint := range endpoints {
+		event, err := m.check(endpoint, now)
+		if err != nil {
+			slog.Error("cannot check health of endpoint", "endpoint", endpoint.ID, "msg", err.Error())
+			continue
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (m *HealthMonitor) check(endpoint *types.Endpoint, now time.Time) (*types.Event, error) {
+	if !endpoint.HasActiveDeploy() || !endpoint.Health.Enabled() {
+		return nil, nil
+	}
+	deployment, err := m.store.GetDeploymentByID(endpoint.ActiveDeploymentID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !endpoint.Health.Watches(deployment.ActivatedAt, now) || m.stuck[deployment.ID] {
+		return nil, nil
+	}
+
+	params := store.MetricQueryParams{From: deployment.ActivatedAt, To: now.Unix() + 1}
+	metrics, err := m.metricStore.GetMetricsOfDeployment(deployment.ID.String(), params)
+	if err != nil {
+		return nil, err
+	}
+	reason := endpoint.Health.Check(types.NewRuntimeMetric(metrics))
+	if reason == "" {
+		return nil, nil
+	}
+	return m.rollback(endpoint, deployment, reason)
+}
+
+// rollback reactivates the deployment which was active before the unhealthy one, which is retired along with the
+// canaries of the endpoint.
+func (m *HealthMonitor) rollback(endpoint *types.Endpoint, unhealthy *types.Deployment, reason string) (*types.Event, error) {
+	endpointID := endpoint.ID.String()
+	deployments, err := m.store.GetDeploymentsByEndpointID(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	previous := previousDeployment(deployments, unhealthy.ID)
+	if previous == nil {
+		slog.Info("unhealthy deployment has no previous deployment to roll back to", "endpoint", endpointID, "deployment", unhealthy.ID, "reason", reason)
+		m.stuck[unhealthy.ID] = true
+		return nil, nil
+	}
+	slog.Info("rolling back unhealthy deployment", "endpoint", endpointID, "deployment", unhealthy.ID, "to", previous.ID, "reason", reason)
+
+	if len(endpoint.Traffic) > 0 {
+		if err := m.store.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Traffic: []types.TrafficTarget{}}); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.store.UpdateActiveDeploymentOfEndpoint(endpointID, previous.ID.String()); err != nil {
+		return nil, err
+	}
+	retire := func(deploymentID uuid.UUID, params store.UpdateDeploymentParams) {
+		params.Status = types.DeploymentStatusRetired
+		if err := m.store.UpdateDeployment(deploymentID.String(), params); err != nil {
+			slog.Info("cannot retire deployment", "deployment", deploymentID, "msg", err.Error())
+		}
+	}
+	if err := m.store.UpdateDeployment(previous.ID.String(), store.UpdateDeploymentParams{Status: types.DeploymentStatusActive}); err != nil {
+		slog.Info("cannot mark deployment as active", "deployment", previous.ID, "msg", err.Error())
+	}
+	retire(unhealthy.ID, store.UpdateDeploymentParams{Error: "rolled back, " + reason})
+	for _, target := range endpoint.Traffic {
+		if target.DeploymentID != unhealthy.ID && target.DeploymentID != previous.ID {
+			retire(target.DeploymentID, store.UpdateDeploymentParams{})
+		}
+	}
+
+	event := types.NewEvent(types.EventKindRollback, unhealthy, previous.ID, reason)
+	if err := m.store.AddEvent(event); err != nil {
+		slog.Error("cannot record rollback of endpoint", "endpoint", endpointID, "msg", err.Error())
+	}
+	return event, nil
+}
+
+// previousDeployment returns the retired deployment which was activated last before the active one, deployments
+// which were rolled back themselves are skipped. Deployments activated before activations were recorded are ordered
+// by creation.
+func previousDeployment(deployments []*types.Deployment, active uuid.UUID) *types.Deployment {
+	candidates := make([]*types.Deployment, 0, len(deployments))
+	for _, deployment := range deployments {
+		if deployment.ID != active && deployment.Status == types.DeploymentStatusRetired && deployment.Error == "" {
+			candidates = append(candidates, deployment)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].ActivatedAt != candidates[j].ActivatedAt {
+			return candidates[i].ActivatedAt < candidates[j].ActivatedAt
+		}
+		return candidates[i].CreatedAt < candidates[j].CreatedAt
+	})
+	return candidates[len(candidates)-1]
+}
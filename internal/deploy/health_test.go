@@ -0,0 +1,116 @@
+package deploy_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthMonitor_Rollback(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	now := time.Now()
+	endpoint, err := types.NewEndpoint("health", "go", nil)
+	require.Nil(t, err)
+	endpoint.Health = types.HealthPolicy{MaxErrorRate: 0.1, MinRequests: 10}
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	previous, _ := types.NewDeployment(endpoint)
+	previous.Status = types.DeploymentStatusRetired
+	previous.ActivatedAt = now.Add(-time.Hour).Unix()
+	require.Nil(t, memoryStore.CreateDeployment(previous))
+	active, _ := types.NewDeployment(endpoint)
+	active.Status = types.DeploymentStatusActive
+	active.ActivatedAt = now.Add(-time.Minute).Unix()
+	require.Nil(t, memoryStore.CreateDeployment(active))
+	require.Nil(t, memoryStore.UpdateActiveDeploymentOfEndpoint(endpoint.ID.String(), active.ID.String()))
+
+	addMetrics := func(deployment *types.Deployment, count int, status int) {
+		for i := 0; i < count; i++ {
+			metric := types.CreateRequestMetric(fmt.Sprintf("%s-%d-%d", deployment.ID, status, i), status, time.Millisecond)
+			metric.DeploymentID = deployment.ID
+			require.Nil(t, memoryStore.AddEndpointMetric(endpoint.ID.String(), metric))
+		}
+	}
+	monitor := deploy.NewHealthMonitor(memoryStore, memoryStore, time.Minute)
+
+	// too few requests were served to tell.
+	addMetrics(active, 5, http.StatusInternalServerError)
+	require.Empty(t, monitor.Check(now))
+
+	addMetrics(active, 15, http.StatusOK)
+	events := monitor.Check(now)
+	require.Len(t, events, 1)
+	require.Equal(t, types.EventKindRollback, events[0].Kind)
+	require.Equal(t, active.ID, events[0].DeploymentID)
+	require.Equal(t, previous.ID, events[0].ActiveDeploymentID)
+	require.Contains(t, events[0].Reason, "error rate 25.00% of 20 requests")
+
+	got, _ := memoryStore.GetEndpointByID(endpoint.ID.String())
+	require.Equal(t, previous.ID, got.ActiveDeploymentID)
+	restored, _ := memoryStore.GetDeploymentByID(previous.ID.String())
+	require.Equal(t, types.DeploymentStatusActive, restored.Status)
+	rolledBack, _ := memoryStore.GetDeploymentByID(active.ID.String())
+	require.Equal(t, types.DeploymentStatusRetired, rolledBack.Status)
+	require.Contains(t, rolledBack.Error, "rolled back")
+	recorded, err := memoryStore.GetEventsOfEndpoint(endpoint.ID.String())
+	require.Nil(t, err)
+	require.Equal(t, events, recorded)
+
+	// the restored deployment was activated before the window, so it is not rolled back itself.
+	addMetrics(previous, 20, http.StatusInternalServerError)
+	require.Empty(t, monitor.Check(now))
+}
+
+func TestHealthPolicy_Check(t *testing.T) {
+	policy := types.HealthPolicy{MaxP95: 100, MinRequests: 1}
+	require.Empty(t, policy.Check(types.RuntimeMetric{NumRequest: 1, P95: 100 * time.Millisecond}))
+	require.Contains(t, policy.Check(types.RuntimeMetric{NumRequest: 1, P95: 101 * time.Millisecond}), "p95 latency")
+
+	now := time.Now()
+	require.True(t, policy.Watches(now.Unix(), now))
+	require.False(t, policy.Watches(now.Add(-time.Hour).Unix(), now))
+	require.False(t, types.HealthPolicy{}.Watches(now.Unix(), now))
+}
+
+func TestHealthPolicy_Validate(t *testing.T) {
+	maxP95 := settings.MaxHealthP95.Milliseconds()
+	maxWindow := int64(settings.MaxHealthWindow / time.Second)
+	tests := []struct {
+		name   string
+		policy types.HealthPolicy
+		err    error
+	}{
+		{name: "defaults", policy: types.HealthPolicy{}},
+		{name: "max p95", policy: types.HealthPolicy{MaxP95: maxP95}},
+		{name: "above max p95", policy: types.HealthPolicy{MaxP95: maxP95 + 1}, err: errors.ErrInvalidHealthPolicy},
+		{
+			// the p95 overflows as a duration, which would break the rule by every latency.
+			name:   "overflowing max p95",
+			policy: types.HealthPolicy{MaxP95: 10000000000000},
+			err:    errors.ErrInvalidHealthPolicy,
+		},
+		{name: "max window", policy: types.HealthPolicy{Window: maxWindow}},
+		{name: "above max window", policy: types.HealthPolicy{Window: maxWindow + 1}, err: errors.ErrInvalidHealthPolicy},
+		{name: "overflowing window", policy: types.HealthPolicy{Window: 10000000000}, err: errors.ErrInvalidHealthPolicy},
+		{name: "negative min requests", policy: types.HealthPolicy{MinRequests: -1}, err: errors.ErrInvalidHealthPolicy},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate()
+			if test.err == nil {
+				require.Nil(t, err)
+				return
+			}
+			require.ErrorContains(t, err, test.err.Error())
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package deploy
+
+import (
+	"time"
+
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+)
+
+// PruneHistory removes the deployments of the endpoint which its history policy does not keep at now, along with
+// their blobs. It returns the removed deployments, which include the ones removed before an error.
+func PruneHistory(metadataStore store.Store, blobStore store.BlobStore, endpoint *types.Endpoint, now time.Time) ([]*types.Deployment, error) {
+	deployments, err := metadataStore.GetDeploymentsByEndpointID(endpoint.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	var removed []*types.Deployment
+	for _, deployment := range endpoint.History.Prunable(endpoint, deployments, now) {
+		deploymentID := deployment.ID.String()
+		// only deployments which became ready have a blob, failed deploys removed theirs already.
+		if deployment.IsServable() {
+			blobMetadata, err := metadataStore.GetBlobMetadataByDeploymentID(deploymentID)
+			if err != nil {
+				return removed, err
+			}
+			if blobMetadata != nil {
+				if _, err := blobStore.DeleteDeploymentBlob(blobMetadata.Location); err != nil {
+					return removed, err
+				}
+				if err := metadataStore.DeleteBlobMetadata(deploymentID); err != nil {
+					return removed, err
+				}
+			}
+		}
+		if err := metadataStore.DeleteDeployment(deploymentID); err != nil {
+			return removed, err
+		}
+		removed = append(removed, deployment)
+	}
+	return removed, nil
+}
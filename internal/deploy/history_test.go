@@ -0,0 +1,63 @@
+package deploy_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneHistory(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("history", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	newDeployment := func(status types.DeploymentStatus, createdAt int64) *types.Deployment {
+		deployment, _ := types.NewDeployment(endpoint)
+		deployment.Status = status
+		deployment.CreatedAt = createdAt
+		require.Nil(t, memoryStore.CreateDeployment(deployment))
+		if deployment.IsServable() {
+			blobMetadata, _ := types.NewRawBlobMetadata(deployment, startModule)
+			_, err := memoryStore.AddDeploymentBlob(blobMetadata, startModule)
+			require.Nil(t, err)
+			require.Nil(t, memoryStore.CreateBlobMetadata(blobMetadata))
+		}
+		return deployment
+	}
+	oldest := newDeployment(types.DeploymentStatusRetired, 100)
+	failed := newDeployment(types.DeploymentStatusFailed, 200)
+	active := newDeployment(types.DeploymentStatusActive, 300)
+	retired := newDeployment(types.DeploymentStatusRetired, 350)
+	canary := newDeployment(types.DeploymentStatusCanary, 400)
+	building := newDeployment(types.DeploymentStatusBuilding, 500)
+
+	endpoint.ActiveDeploymentID = active.ID
+	endpoint.Traffic = types.CanaryTraffic(active.ID, canary.ID, 10)
+	endpoint.History = types.HistoryPolicy{MaxDeployments: 2}
+
+	// the latest deployments, the ones serving requests and the ones still being deployed are kept.
+	removed, err := deploy.PruneHistory(memoryStore, memoryStore, endpoint, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, []*types.Deployment{retired, failed, oldest}, removed)
+	for _, deployment := range removed {
+		_, err := memoryStore.GetDeploymentByID(deployment.ID.String())
+		require.ErrorIs(t, err, errors.ErrDeploymentNotExisted)
+		blobMetadata, _ := memoryStore.GetBlobMetadataByDeploymentID(deployment.ID.String())
+		require.Nil(t, blobMetadata)
+		blob, _ := memoryStore.GetDeploymentBlobByURI(deployment.ID.String())
+		require.Nil(t, blob)
+	}
+	for _, deployment := range []*types.Deployment{active, canary, building} {
+		_, err := memoryStore.GetDeploymentByID(deployment.ID.String())
+		require.Nil(t, err)
+	}
+	blobMetadata, _ := memoryStore.GetBlobMetadataByDeploymentID(active.ID.String())
+	require.NotNil(t, blobMetadata)
+}
@@ -0,0 +1,398 @@
+/*
+Package deploy moves pending deployments through their lifecycle in the background, see types.DeploymentStatus.
+*/
+package deploy
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hnimtadd/run/internal/build"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/runtime"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
+)
+
+// Job deploys a pending deployment, either from Blob or from Source.
+type Job struct {
+	Deployment *types.Deployment
+	Blob       []byte       // wasm module
+	Source     build.Source // go source which is built to the module
+}
+
+// Pipeline deploys queued jobs in the background. Steps which talk to the stores are retried, and when a step
+// fails for good the steps done so far are undone before the deployment is marked as failed, so the endpoint keeps
+// serving its previous deployment. Jobs of the same endpoint are activated one at a time, since each one reads the
+// active deployment it replaces, while the steps before the activation, such as builds, run side by side.
+type Pipeline struct {
+	store     store.Store
+	blobStore store.BlobStore
+	builder   *build.Builder
+	jobs      chan Job
+	workers   int
+	attempts  int
+	backoff   time.Duration
+	mu        sync.Mutex
+	endpoints map[uuid.UUID]*endpointLock // endpoints with jobs being deployed
+}
+
+// endpointLock serializes the activations of an endpoint, it is dropped once no job holds or waits for it.
+type endpointLock struct {
+	sync.Mutex
+	jobs int
+}
+
+func NewPipeline(store store.Store, blobStore store.BlobStore, builder *build.Builder, workers int, queueSize int) *Pipeline {
+	return &Pipeline{
+		store:     store,
+		blobStore: blobStore,
+		builder:   builder,
+		jobs:      make(chan Job, queueSize),
+		workers:   workers,
+		attempts:  settings.DeployStepAttempts,
+		backoff:   settings.DeployRetryBackoff,
+		endpoints: make(map[uuid.UUID]*endpointLock),
+	}
+}
+
+// Enqueue queues the job, it fails with errors.ErrDeployQueueFull rather than waiting for room in the queue.
+func (p *Pipeline) Enqueue(job Job) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return errors.ErrDeployQueueFull
+	}
+}
+
+// Run recovers deployments left behind by a previous run, then deploys queued jobs until ctx is done.
+func (p *Pipeline) Run(ctx context.Context) {
+	p.recover(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					p.deploy(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pipeline) deploy(ctx context.Context, job Job) {
+	// the deployment is copied since the one of the job could be shared with the store.
+	deployment := *job.Deployment
+	r := &run{Pipeline: p, deployment: &deployment}
+	slog.Info("deploying", "deployment", r.id(), "endpoint", r.deployment.EndpointID)
+	if err := r.prepare(ctx, job); err != nil {
+		slog.Info("deploy failed", "deployment", r.id(), "status", r.deployment.Status, "msg", err.Error())
+		r.abort(err)
+		return
+	}
+
+	// the lock is held until the activation is undone on failure, which restores the active deployment it replaced.
+	unlock := p.lockEndpoint(r.deployment.EndpointID)
+	defer unlock()
+	if err := r.activate(ctx); err != nil {
+		slog.Info("deploy failed", "deployment", r.id(), "status", r.deployment.Status, "msg", err.Error())
+		r.abort(err)
+		return
+	}
+	slog.Info("deployed", "deployment", r.id(), "hash", r.deployment.Hash)
+}
+
+// lockEndpoint waits until no other job of the endpoint is being activated, it returns the function releasing the
+// endpoint.
+func (p *Pipeline) lockEndpoint(endpointID uuid.UUID) func() {
+	p.mu.Lock()
+	lock, ok := p.endpoints[endpointID]
+	if !ok {
+		lock = new(endpointLock)
+		p.endpoints[endpointID] = lock
+	}
+	lock.jobs++
+	p.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if lock.jobs--; lock.jobs == 0 {
+			delete(p.endpoints, endpointID)
+		}
+	}
+}
+
+// recover finishes the activation of deployments which are ready and fails the ones which were still in progress,
+// since their jobs were lost with the previous process. It assumes a single api server runs the pipeline.
+func (p *Pipeline) recover(ctx context.Context) {
+	deployments, err := p.store.GetDeployments()
+	if err != nil {
+		slog.Error("cannot get deployments to recover", "msg", err.Error())
+		return
+	}
+	sort.Slice(deployments, func(i, j int) bool { return deployments[i].CreatedAt < deployments[j].CreatedAt })
+
+	for _, deployment := range deployments {
+		if deployment.Status.IsTerminal() {
+			continue
+		}
+		deployment := *deployment
+		r := &run{Pipeline: p, deployment: &deployment}
+		if deployment.Status != types.DeploymentStatusReady {
+			slog.Info("failing interrupted deploy", "deployment", r.id(), "status", deployment.Status)
+			r.undo = append(r.undo, r.removeBlob)
+			r.abort(errors.ErrDeployInterrupted)
+			continue
+		}
+		slog.Info("resuming activation of deployment", "deployment", r.id())
+		r.undo = append(r.undo, r.removeBlob)
+		if err := r.activate(ctx); err != nil {
+			r.abort(err)
+		}
+	}
+}
+
+// retry calls fn until it succeeds, up to the attempts of the pipeline with a growing backoff in between.
+func (p *Pipeline) retry(ctx context.Context, step string, fn func() error) error {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.attempts || errors.Is(err, errors.ErrDeploymentNotExisted) {
+			return errors.Newf("%s: %w", step, err)
+		}
+		slog.Info("deploy step failed, retrying", "step", step, "attempt", attempt, "msg", err.Error())
+		select {
+		case <-ctx.Done():
+			return errors.Newf("%s: %w", step, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// run is a deploy of a single deployment, it keeps how to undo the steps done so far.
+type run struct {
+	*Pipeline
+	deployment *types.Deployment
+	buildLog   string
+	undo       []func()
+}
+
+func (r *run) id() string {
+	return r.deployment.ID.String()
+}
+
+// prepare builds the module of the deployment if needed, then validates and stores it, up to the deployment being
+// ready to be activated.
+func (r *run) prepare(ctx context.Context, job Job) error {
+	wasm := job.Blob
+	if job.Source != nil {
+		if err := r.transition(ctx, types.DeploymentStatusBuilding, store.UpdateDeploymentParams{}); err != nil {
+			return err
+		}
+		var err error
+		wasm, r.buildLog, err = r.builder.Build(ctx, job.Source)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := r.transition(ctx, types.DeploymentStatusValidating, store.UpdateDeploymentParams{BuildLog: r.buildLog}); err != nil {
+		return err
+	}
+	module, err := runtime.Inspect(ctx, wasm)
+	if err != nil {
+		return err
+	}
+	if err := r.transition(ctx, types.DeploymentStatusCompiled, store.UpdateDeploymentParams{}); err != nil {
+		return err
+	}
+
+	blobMetadata, _ := types.NewRawBlobMetadata(r.deployment, wasm)
+	blobMetadata.Module = module
+	if err := r.retry(ctx, "store blob", func() error {
+		_, err := r.blobStore.AddDeploymentBlob(blobMetadata, wasm)
+		return err
+	}); err != nil {
+		return err
+	}
+	r.undo = append(r.undo, func() {
+		if _, err := r.blobStore.DeleteDeploymentBlob(blobMetadata.Location); err != nil {
+			slog.Info("cannot remove blob of failed deployment", "deployment", r.id(), "msg", err.Error())
+		}
+	})
+	if err := r.retry(ctx, "create blob metadata", func() error {
+		return r.store.CreateBlobMetadata(blobMetadata)
+	}); err != nil {
+		return err
+	}
+	r.undo = append(r.undo, func() {
+		if err := r.store.DeleteBlobMetadata(r.id()); err != nil {
+			slog.Info("cannot remove blob metadata of failed deployment", "deployment", r.id(), "msg", err.Error())
+		}
+	})
+	r.deployment.Hash = blobMetadata.Hash
+	return r.transition(ctx, types.DeploymentStatusReady, store.UpdateDeploymentParams{Hash: blobMetadata.Hash})
+}
+
+// activate makes the deployment the active one of its endpoint and retires the previously active deployment, along
+// with the canaries of the endpoint. A canary deployment of an endpoint which already has an active deployment is
+// given its share of the live requests instead.
+func (r *run) activate(ctx context.Context) error {
+	endpointID := r.deployment.EndpointID.String()
+	var endpoint *types.Endpoint
+	if err := r.retry(ctx, "get endpoint", func() (err error) {
+		endpoint, err = r.store.GetEndpointByID(endpointID)
+		return err
+	}); err != nil {
+		return err
+	}
+	previous := endpoint.ActiveDeploymentID
+	if r.deployment.Canary > 0 && previous != uuid.Nil && previous != r.deployment.ID {
+		return r.canary(ctx, endpoint)
+	}
+	if err := r.updateTraffic(ctx, endpoint, []types.TrafficTarget{}); err != nil {
+		return err
+	}
+
+	if err := r.retry(ctx, "update active deployment", func() error {
+		return r.store.UpdateActiveDeploymentOfEndpoint(endpointID, r.id())
+	}); err != nil {
+		return err
+	}
+	r.undo = append(r.undo, func() {
+		if err := r.store.UpdateActiveDeploymentOfEndpoint(endpointID, previous.String()); err != nil {
+			slog.Error("cannot restore active deployment of endpoint", "endpoint", endpointID, "deployment", previous, "msg", err.Error())
+		}
+	})
+	// the activation starts the window in which the deployment is held to the health policy of its endpoint.
+	activation := store.UpdateDeploymentParams{ActivatedAt: time.Now().Unix()}
+	if err := r.transition(ctx, types.DeploymentStatusActive, activation); err != nil {
+		return err
+	}
+
+	if previous != uuid.Nil && previous != r.deployment.ID {
+		params := store.UpdateDeploymentParams{Status: types.DeploymentStatusRetired}
+		if err := r.store.UpdateDeployment(previous.String(), params); err != nil {
+			slog.Info("cannot retire previous deployment", "deployment", previous, "msg", err.Error())
+		}
+	}
+	r.retireCanaries(endpoint)
+	return nil
+}
+
+// canary splits the live requests of the endpoint between its active deployment and the deployment, by the canary
+// weight of the deployment. Canaries the endpoint had before are retired.
+func (r *run) canary(ctx context.Context, endpoint *types.Endpoint) error {
+	traffic := types.CanaryTraffic(endpoint.ActiveDeploymentID, r.deployment.ID, r.deployment.Canary)
+	if err := r.updateTraffic(ctx, endpoint, traffic); err != nil {
+		return err
+	}
+	if err := r.transition(ctx, types.DeploymentStatusCanary, store.UpdateDeploymentParams{}); err != nil {
+		return err
+	}
+	r.retireCanaries(endpoint)
+	return nil
+}
+
+// updateTraffic replaces the traffic split of the endpoint, it is restored if the deploy fails afterwards.
+func (r *run) updateTraffic(ctx context.Context, endpoint *types.Endpoint, traffic []types.TrafficTarget) error {
+	if len(endpoint.Traffic) == 0 && len(traffic) == 0 {
+		return nil
+	}
+	endpointID := endpoint.ID.String()
+	if err := r.retry(ctx, "update traffic", func() error {
+		return r.store.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Traffic: traffic})
+	}); err != nil {
+		return err
+	}
+	previous := append([]types.TrafficTarget{}, endpoint.Traffic...)
+	r.undo = append(r.undo, func() {
+		if err := r.store.UpdateEndpoint(endpointID, store.UpdateEndpointParams{Traffic: previous}); err != nil {
+			slog.Error("cannot restore traffic of endpoint", "endpoint", endpointID, "msg", err.Error())
+		}
+	})
+	return nil
+}
+
+// retireCanaries retires the deployments which served a share of the live requests of the endpoint, besides its
+// active deployment and the deployment.
+func (r *run) retireCanaries(endpoint *types.Endpoint) {
+	for _, target := range endpoint.Traffic {
+		if target.DeploymentID == endpoint.ActiveDeploymentID || target.DeploymentID == r.deployment.ID {
+			continue
+		}
+		params := store.UpdateDeploymentParams{Status: types.DeploymentStatusRetired}
+		if err := r.store.UpdateDeployment(target.DeploymentID.String(), params); err != nil {
+			slog.Info("cannot retire previous canary", "deployment", target.DeploymentID, "msg", err.Error())
+		}
+	}
+}
+
+// transition moves the deployment to next, along with given params.
+func (r *run) transition(ctx context.Context, next types.DeploymentStatus, params store.UpdateDeploymentParams) error {
+	if !r.deployment.Status.CanTransitionTo(next) {
+		return errors.Newf("%w: from %s to %s", errors.ErrInvalidTransition, r.deployment.Status, next)
+	}
+	params.Status = next
+	if err := r.retry(ctx, string(next), func() error {
+		return r.store.UpdateDeployment(r.id(), params)
+	}); err != nil {
+		return err
+	}
+	r.deployment.Status = next
+	return nil
+}
+
+// abort undoes the steps done so far in reverse and marks the deployment as failed.
+func (r *run) abort(cause error) {
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		r.undo[i]()
+	}
+	r.undo = nil
+
+	params := store.UpdateDeploymentParams{
+		Status:   types.DeploymentStatusFailed,
+		BuildLog: r.buildLog,
+		Error:    cause.Error(),
+	}
+	if err := r.store.UpdateDeployment(r.id(), params); err != nil {
+		slog.Info("cannot mark deployment as failed", "deployment", r.id(), "msg", err.Error())
+		return
+	}
+	r.deployment.Status = types.DeploymentStatusFailed
+}
+
+// removeBlob removes the blob of the deployment, if it was stored.
+func (r *run) removeBlob() {
+	blobMetadata, err := r.store.GetBlobMetadataByDeploymentID(r.id())
+	if err != nil || blobMetadata == nil {
+		return
+	}
+	if _, err := r.blobStore.DeleteDeploymentBlob(blobMetadata.Location); err != nil {
+		slog.Info("cannot remove blob of failed deployment", "deployment", r.id(), "msg", err.Error())
+	}
+	if err := r.store.DeleteBlobMetadata(r.id()); err != nil {
+		slog.Info("cannot remove blob metadata of failed deployment", "deployment", r.id(), "msg", err.Error())
+	}
+}
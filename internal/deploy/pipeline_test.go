@@ -0,0 +1,327 @@
+package deploy_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/build"
+	"github.com/hnimtadd/run/internal/deploy"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// startModule is the binary of (module (func (export "_start"))).
+var startModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export section
+	0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b, // code section
+}
+
+// failingBlobMetadataStore fails to create blob metadata.
+type failingBlobMetadataStore struct {
+	*store.MemoryStore
+}
+
+func (s failingBlobMetadataStore) CreateBlobMetadata(*types.BlobMetadata) error {
+	return errors.New("metadata store is down")
+}
+
+// slowStore has no deployments left behind by a previous run of the pipeline, and is slow to get endpoints, which
+// widens the window between reading the active deployment of an endpoint and replacing it.
+type slowStore struct {
+	*store.MemoryStore
+}
+
+func (s slowStore) GetDeployments() ([]*types.Deployment, error) {
+	return nil, nil
+}
+
+func (s slowStore) GetEndpointByID(id string) (*types.Endpoint, error) {
+	endpoint, err := s.MemoryStore.GetEndpointByID(id)
+	time.Sleep(10 * time.Millisecond)
+	return endpoint, err
+}
+
+// holdingStore holds the deployment in the steps before its activation until release is closed, as a long build does.
+type holdingStore struct {
+	slowStore
+	deploymentID string
+	release      chan struct{}
+}
+
+func (s holdingStore) UpdateDeployment(id string, params store.UpdateDeploymentParams) error {
+	if id == s.deploymentID && params.Status == types.DeploymentStatusValidating {
+		<-s.release
+	}
+	return s.slowStore.UpdateDeployment(id, params)
+}
+
+type fixture struct {
+	memoryStore *store.MemoryStore
+	endpoint    *types.Endpoint
+	pipeline    *deploy.Pipeline
+}
+
+func newFixture(t *testing.T, metadataStore store.Store, memoryStore *store.MemoryStore) *fixture {
+	backoff := settings.DeployRetryBackoff
+	settings.DeployRetryBackoff = time.Millisecond
+	t.Cleanup(func() { settings.DeployRetryBackoff = backoff })
+
+	endpoint, err := types.NewEndpoint("deploy", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	pipeline := deploy.NewPipeline(metadataStore, memoryStore, build.NewBuilder(), 1, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go pipeline.Run(ctx)
+	return &fixture{memoryStore: memoryStore, endpoint: endpoint, pipeline: pipeline}
+}
+
+func (f *fixture) deploy(t *testing.T, job deploy.Job) *types.Deployment {
+	if job.Deployment == nil {
+		job.Deployment, _ = types.NewDeployment(f.endpoint)
+	}
+	require.Nil(t, f.memoryStore.CreateDeployment(job.Deployment))
+	require.Nil(t, f.pipeline.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		deployment, err := f.memoryStore.GetDeploymentByID(job.Deployment.ID.String())
+		require.Nil(t, err)
+		return deployment.Status.IsTerminal()
+	}, time.Minute, 10*time.Millisecond)
+	deployment, err := f.memoryStore.GetDeploymentByID(job.Deployment.ID.String())
+	require.Nil(t, err)
+	return deployment
+}
+
+func (f *fixture) currentEndpoint(t *testing.T) types.Endpoint {
+	endpoint, err := f.memoryStore.GetEndpointByID(f.endpoint.ID.String())
+	require.Nil(t, err)
+	return *endpoint
+}
+
+func TestPipeline_Blob(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	f := newFixture(t, memoryStore, memoryStore)
+
+	first := f.deploy(t, deploy.Job{Blob: startModule})
+	require.Equal(t, types.DeploymentStatusActive, first.Status)
+	require.NotEmpty(t, first.Hash)
+	blobMetadata, err := memoryStore.GetBlobMetadataByDeploymentID(first.ID.String())
+	require.Nil(t, err)
+	require.True(t, blobMetadata.Module.Valid)
+	require.Equal(t, []string{"_start"}, blobMetadata.Module.Exports)
+	require.Equal(t, first.ID, f.currentEndpoint(t).ActiveDeploymentID)
+
+	second := f.deploy(t, deploy.Job{Blob: startModule})
+	require.Equal(t, types.DeploymentStatusActive, second.Status)
+	require.Equal(t, second.ID, f.currentEndpoint(t).ActiveDeploymentID)
+	first, _ = memoryStore.GetDeploymentByID(first.ID.String())
+	require.Equal(t, types.DeploymentStatusRetired, first.Status)
+
+	invalid := f.deploy(t, deploy.Job{Blob: []byte("not a wasm module")})
+	require.Equal(t, types.DeploymentStatusFailed, invalid.Status)
+	require.Contains(t, invalid.Error, errors.ErrInvalidModule.Error())
+	require.Equal(t, second.ID, f.currentEndpoint(t).ActiveDeploymentID)
+	blobMetadata, _ = memoryStore.GetBlobMetadataByDeploymentID(invalid.ID.String())
+	require.Nil(t, blobMetadata)
+}
+
+func TestPipeline_SameEndpoint(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("deploy", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+	pipeline := deploy.NewPipeline(slowStore{memoryStore}, memoryStore, build.NewBuilder(), 4, 8)
+
+	var deployments []*types.Deployment
+	for i := 0; i < 8; i++ {
+		deployment, _ := types.NewDeployment(endpoint)
+		require.Nil(t, memoryStore.CreateDeployment(deployment))
+		require.Nil(t, pipeline.Enqueue(deploy.Job{Deployment: deployment, Blob: startModule}))
+		deployments = append(deployments, deployment)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go pipeline.Run(ctx)
+
+	// the jobs are deployed one after another, so only the last one activated stays active.
+	require.Eventually(t, func() bool {
+		for _, deployment := range deployments {
+			deployment, _ := memoryStore.GetDeploymentByID(deployment.ID.String())
+			if !deployment.Status.IsTerminal() {
+				return false
+			}
+		}
+		return true
+	}, time.Minute, 10*time.Millisecond)
+	got, _ := memoryStore.GetEndpointByID(endpoint.ID.String())
+	for _, deployment := range deployments {
+		deployment, _ := memoryStore.GetDeploymentByID(deployment.ID.String())
+		if deployment.ID == got.ActiveDeploymentID {
+			require.Equal(t, types.DeploymentStatusActive, deployment.Status)
+			continue
+		}
+		require.Equal(t, types.DeploymentStatusRetired, deployment.Status)
+	}
+
+	// a job held before its activation does not hold back the other jobs of its endpoint, nor pin workers waiting for
+	// it which other endpoints are deployed by.
+	memoryStore = store.NewMemoryStore()
+	other, err := types.NewEndpoint("other", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+	require.Nil(t, memoryStore.CreateEndpoint(other))
+	held, _ := types.NewDeployment(endpoint)
+	next, _ := types.NewDeployment(endpoint)
+	otherDeployment, _ := types.NewDeployment(other)
+	holding := holdingStore{slowStore: slowStore{memoryStore}, deploymentID: held.ID.String(), release: make(chan struct{})}
+	pipeline = deploy.NewPipeline(holding, memoryStore, build.NewBuilder(), 2, 4)
+	for _, deployment := range []*types.Deployment{held, next, otherDeployment} {
+		require.Nil(t, memoryStore.CreateDeployment(deployment))
+		require.Nil(t, pipeline.Enqueue(deploy.Job{Deployment: deployment, Blob: startModule}))
+	}
+	go pipeline.Run(ctx)
+
+	isActive := func(deployment *types.Deployment) func() bool {
+		return func() bool {
+			deployment, _ := memoryStore.GetDeploymentByID(deployment.ID.String())
+			return deployment.Status == types.DeploymentStatusActive
+		}
+	}
+	require.Eventually(t, isActive(next), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, isActive(otherDeployment), 5*time.Second, 10*time.Millisecond)
+	close(holding.release)
+	require.Eventually(t, isActive(held), 5*time.Second, 10*time.Millisecond)
+	got, _ = memoryStore.GetEndpointByID(endpoint.ID.String())
+	require.Equal(t, held.ID, got.ActiveDeploymentID)
+}
+
+func TestPipeline_Canary(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	f := newFixture(t, memoryStore, memoryStore)
+	canaryJob := func(weight int) deploy.Job {
+		deployment, _ := types.NewDeployment(f.endpoint)
+		deployment.Canary = weight
+		return deploy.Job{Blob: startModule, Deployment: deployment}
+	}
+
+	// the first deployment of an endpoint is made active even if it is meant as a canary.
+	stable := f.deploy(t, canaryJob(10))
+	require.Equal(t, types.DeploymentStatusActive, stable.Status)
+	require.Empty(t, f.currentEndpoint(t).Traffic)
+
+	first := f.deploy(t, canaryJob(10))
+	require.Equal(t, types.DeploymentStatusCanary, first.Status)
+	endpoint := f.currentEndpoint(t)
+	require.Equal(t, stable.ID, endpoint.ActiveDeploymentID)
+	require.Equal(t, types.CanaryTraffic(stable.ID, first.ID, 10), endpoint.Traffic)
+	require.Equal(t, first.ID, endpoint.Canary())
+
+	// a client keeps being served by the same deployment, and the canary serves about its share of the clients.
+	picked := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		deploymentID := endpoint.PickDeployment(key)
+		require.Equal(t, deploymentID, endpoint.PickDeployment(key))
+		if deploymentID == first.ID {
+			picked++
+		}
+	}
+	require.InDelta(t, 100, picked, 40)
+
+	// a new canary replaces the previous one.
+	second := f.deploy(t, canaryJob(30))
+	require.Equal(t, types.DeploymentStatusCanary, second.Status)
+	require.Equal(t, types.CanaryTraffic(stable.ID, second.ID, 30), f.currentEndpoint(t).Traffic)
+	first, _ = memoryStore.GetDeploymentByID(first.ID.String())
+	require.Equal(t, types.DeploymentStatusRetired, first.Status)
+
+	// a deployment which is not a canary takes every request.
+	active := f.deploy(t, deploy.Job{Blob: startModule})
+	require.Equal(t, types.DeploymentStatusActive, active.Status)
+	endpoint = f.currentEndpoint(t)
+	require.Equal(t, active.ID, endpoint.ActiveDeploymentID)
+	require.Empty(t, endpoint.Traffic)
+	require.Equal(t, active.ID, endpoint.PickDeployment("client"))
+	for _, deployment := range []*types.Deployment{stable, second} {
+		deployment, _ = memoryStore.GetDeploymentByID(deployment.ID.String())
+		require.Equal(t, types.DeploymentStatusRetired, deployment.Status)
+	}
+}
+
+func TestPipeline_Compensate(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	f := newFixture(t, failingBlobMetadataStore{memoryStore}, memoryStore)
+
+	failed := f.deploy(t, deploy.Job{Blob: startModule})
+	require.Equal(t, types.DeploymentStatusFailed, failed.Status)
+	require.Contains(t, failed.Error, "metadata store is down")
+	require.False(t, f.currentEndpoint(t).HasActiveDeploy())
+
+	// the blob stored before the failed step is removed.
+	blob, err := memoryStore.GetDeploymentBlobByURI(failed.ID.String())
+	require.Nil(t, err)
+	require.Nil(t, blob)
+}
+
+func TestPipeline_Recover(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("deploy", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	interrupted, _ := types.NewDeployment(endpoint)
+	interrupted.Status = types.DeploymentStatusValidating
+	require.Nil(t, memoryStore.CreateDeployment(interrupted))
+
+	ready, _ := types.NewDeployment(endpoint)
+	ready.Status = types.DeploymentStatusReady
+	require.Nil(t, memoryStore.CreateDeployment(ready))
+
+	pipeline := deploy.NewPipeline(memoryStore, memoryStore, build.NewBuilder(), 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pipeline.Run(ctx)
+
+	got, _ := memoryStore.GetDeploymentByID(interrupted.ID.String())
+	require.Equal(t, types.DeploymentStatusFailed, got.Status)
+	require.Equal(t, errors.ErrDeployInterrupted.Error(), got.Error)
+
+	got, _ = memoryStore.GetDeploymentByID(ready.ID.String())
+	require.Equal(t, types.DeploymentStatusActive, got.Status)
+	endpoint, _ = memoryStore.GetEndpointByID(endpoint.ID.String())
+	require.Equal(t, ready.ID, endpoint.ActiveDeploymentID)
+}
+
+func TestPipeline_Source(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain is not available")
+	}
+	memoryStore := store.NewMemoryStore()
+	f := newFixture(t, memoryStore, memoryStore)
+
+	failed := f.deploy(t, deploy.Job{Source: build.Source{"main.go": []byte("package main\n\nfunc main() { undefined() }\n")}})
+	require.Equal(t, types.DeploymentStatusFailed, failed.Status)
+	require.Contains(t, failed.BuildLog, "undefined")
+	require.False(t, f.currentEndpoint(t).HasActiveDeploy())
+
+	built := f.deploy(t, deploy.Job{Source: build.Source{"main.go": []byte("package main\n\nfunc main() {}\n")}})
+	require.Equal(t, types.DeploymentStatusActive, built.Status)
+	require.Equal(t, built.ID, f.currentEndpoint(t).ActiveDeploymentID)
+
+	blobMetadata, err := memoryStore.GetBlobMetadataByDeploymentID(built.ID.String())
+	require.Nil(t, err)
+	blob, err := memoryStore.GetDeploymentBlobByURI(blobMetadata.Location)
+	require.Nil(t, err)
+	require.Equal(t, startModule[:4], blob.Data[:4])
+}
@@ -2,4 +2,14 @@ package errors
 
 import "errors"
 
-var ErrDecodeRequestBody = errors.New("could not decode the request body")
+var (
+	ErrDecodeRequestBody    = errors.New("could not decode the request body")
+	ErrInvalidTimeRange     = errors.New("given time range is invalid")
+	ErrTooManyBuckets       = errors.New("given time range and step produce too many buckets")
+	ErrInvalidLogLevel      = errors.New("given log level is not one of debug, info, warn or error")
+	ErrInvalidStatusFilter  = errors.New("given status must be a status code or a status class such as 5xx")
+	ErrStreamingUnsupported = errors.New("streaming is not supported by the connection")
+	ErrInvalidCursor        = errors.New("given cursor is not valid")
+	ErrInvalidOrder         = errors.New("given order is not one of asc or desc")
+	ErrInvalidLimit         = errors.New("given limit is out of range")
+)
@@ -0,0 +1,15 @@
+package errors
+
+import "errors"
+
+var (
+	ErrInvalidSourcePath       = errors.New("given source contains a file path outside of the module")
+	ErrSourceTooLarge          = errors.New("given source exceed max size")
+	ErrEmptySource             = errors.New("given source does not contain any go file")
+	ErrBuildUnsupportedRuntime = errors.New("only endpoints of go runtime could be built from source")
+	ErrInvalidModule           = errors.New("given blob is not a valid wasm module")
+	ErrDeployQueueFull         = errors.New("deploy queue is full, try again later")
+	ErrDeployInterrupted       = errors.New("deploy was interrupted by a restart of the api server")
+	ErrInvalidTransition       = errors.New("deployment could not move to given status")
+	ErrDeploymentNotReady      = errors.New("given deployment is not ready")
+)
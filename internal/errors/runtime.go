@@ -5,7 +5,31 @@ import (
 	"fmt"
 )
 
-var ErrInvalidRuntime = errors.New("given runtime is not valid")
+var (
+	ErrInvalidRuntime        = errors.New("given runtime is not valid")
+	ErrInvalidLimits         = errors.New("given resource limits are not valid")
+	ErrInvalidRetention      = errors.New("given retention policy is not valid")
+	ErrInvalidWarmInstances  = errors.New("given number of warm instances is not valid")
+	ErrInvalidConcurrency    = errors.New("given concurrency policy is not valid")
+	ErrInvalidSlug           = errors.New("given slug is not valid")
+	ErrInvalidTraffic        = errors.New("given traffic split is not valid")
+	ErrNoCanary              = errors.New("endpoint has no canary deployment")
+	ErrInvalidHealthPolicy   = errors.New("given health policy is not valid")
+	ErrInvalidHistoryPolicy  = errors.New("given history policy is not valid")
+	ErrInvalidHost           = errors.New("given host is not valid")
+	ErrHostClaimed           = errors.New("given host is claimed by another endpoint")
+	ErrDeploymentSaturated   = errors.New("deployment is queueing as many requests as its runtimes allow")
+	ErrDeploymentUnavailable = errors.New("runtimes of the deployment failed repeatedly, try again later")
+	ErrRuntimeUnavailable    = errors.New("runtime of the deployment could not be initialized")
+	ErrRuntimeCrashed        = errors.New("runtime crashed while handling the request")
+	ErrInvokeTimeout         = errors.New("invocation exceeded its wall time limit")
+	ErrInvokeCanceled        = errors.New("invocation was canceled")
+	ErrMemoryLimitExceeded   = errors.New("invocation exceeded its memory limit")
+	ErrStdoutLimitExceeded   = errors.New("invocation exceeded its stdout size limit")
+	ErrStreamClosed          = errors.New("stream of the request is closed")
+	ErrHeadWritten           = errors.New("head of the response is already written")
+	ErrRequestBodyTooLarge   = errors.New("body of the request exceeds max size")
+)
 
 func New(msg string) error {
 	return errors.New(msg)
@@ -14,3 +38,11 @@ func New(msg string) error {
 func Newf(msg string, args ...any) error {
 	return fmt.Errorf(msg, args...)
 }
+
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
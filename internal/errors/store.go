@@ -5,6 +5,7 @@ import "errors"
 var (
 	ErrEndpointExisted      = errors.New("given endpoint is existed")
 	ErrEndpointNotExisted   = errors.New("given endpoint is not existed")
+	ErrSlugExisted          = errors.New("given slug is used by another endpoint")
 	ErrDeploymentExisted    = errors.New("given deployment is existed")
 	ErrDeploymentNotExisted = errors.New("given deployment is not existed")
 	ErrDocumentNotFound     = errors.New("given document is not existed")
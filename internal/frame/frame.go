@@ -0,0 +1,106 @@
+/*
+Package frame is the codec of the output of guests, which frames the response apart from the logs. It is imported by
+the guest sdk as well, so it depends on nothing besides the standard library.
+*/
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Kind tells which channel the payload of a frame belongs to.
+type Kind byte
+
+const (
+	// Log carries log output of the guest.
+	Log Kind = iota + 1
+	// Response carries the bytes of the response, pb.HTTPResponse for go guests.
+	Response
+)
+
+// Version is the version of the framing protocol written by Write.
+const Version byte = 1
+
+// Magic starts every frame, it could not be mistaken for text output of the guest.
+var Magic = [4]byte{0x00, 'R', 'U', 'N'}
+
+// headerLen is the length of the frame header:
+//
+//	magic [4]byte | version byte | kind byte | reserved [2]byte | payload length uint64 little endian
+const headerLen = 16
+
+// Write writes the payload to w as a single frame of given kind.
+func Write(w io.Writer, kind Kind, payload []byte) error {
+	header := make([]byte, headerLen)
+	copy(header, Magic[:])
+	header[4] = Version
+	header[5] = byte(kind)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(payload)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// IsFramed reports whether the output holds a complete response frame.
+func IsFramed(out []byte) bool {
+	_, _, err := Parse(out)
+	return err == nil
+}
+
+// Parse splits the framed output into logs and the response. Log frames and any output
+// written outside of frames are logs, the last response frame is the response. Frames are only
+// recognized where a complete header of a known kind is followed by its whole payload, so magic
+// bytes written by the guest outside of frames are kept as logs.
+func Parse(out []byte) (logs []byte, body []byte, err error) {
+	hasResponse := false
+	for len(out) > 0 {
+		idx := bytes.Index(out, Magic[:])
+		if idx < 0 {
+			logs = append(logs, out...)
+			break
+		}
+		kind, payload, ok := decode(out[idx:])
+		if !ok {
+			logs = append(logs, out[:idx+1]...)
+			out = out[idx+1:]
+			continue
+		}
+		logs = append(logs, out[:idx]...)
+		out = out[idx+headerLen+len(payload):]
+
+		switch kind {
+		case Log:
+			logs = append(logs, payload...)
+		case Response:
+			body = payload
+			hasResponse = true
+		}
+	}
+	if !hasResponse {
+		return nil, nil, fmt.Errorf("expect output to have a complete response frame")
+	}
+	return logs, body, nil
+}
+
+// decode decodes the frame which out starts with, ok is false unless out starts with the header
+// of a known kind of frame followed by its whole payload.
+func decode(out []byte) (kind Kind, payload []byte, ok bool) {
+	if len(out) < headerLen || !bytes.HasPrefix(out, Magic[:]) || out[4] != Version || out[6] != 0 || out[7] != 0 {
+		return 0, nil, false
+	}
+	kind = Kind(out[5])
+	if kind != Log && kind != Response {
+		return 0, nil, false
+	}
+	payloadLen := binary.LittleEndian.Uint64(out[8:headerLen])
+	if payloadLen > uint64(len(out)-headerLen) {
+		return 0, nil, false
+	}
+	return kind, out[headerLen : headerLen+payloadLen], true
+}
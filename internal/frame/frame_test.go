@@ -0,0 +1,38 @@
+package frame_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hnimtadd/run/internal/frame"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	out := new(bytes.Buffer)
+	require.Nil(t, frame.Write(out, frame.Log, []byte("first\n")))
+	require.Nil(t, frame.Write(out, frame.Response, []byte("superseded")))
+	out.WriteString("second\n")
+	require.Nil(t, frame.Write(out, frame.Response, []byte("response")))
+
+	logs, body, err := frame.Parse(out.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, "response", string(body))
+	require.Equal(t, "first\nsecond\n", string(logs))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	out := new(bytes.Buffer)
+	require.Nil(t, frame.Write(out, frame.Response, []byte("response")))
+
+	_, _, err := frame.Parse(out.Bytes()[:out.Len()-1])
+	require.NotNil(t, err, "truncated payload")
+
+	unsupported := bytes.Clone(out.Bytes())
+	unsupported[4] = frame.Version + 1
+	_, _, err = frame.Parse(unsupported)
+	require.NotNil(t, err, "unsupported version")
+
+	_, _, err = frame.Parse([]byte("only logs\n"))
+	require.NotNil(t, err, "missing response")
+}
@@ -3,6 +3,8 @@ package message
 import (
 	"github.com/hnimtadd/run/internal/types"
 	pb "github.com/hnimtadd/run/pbs/gopb/v1"
+
+	"github.com/asynkron/protoactor-go/actor"
 )
 
 type (
@@ -23,18 +25,66 @@ type Message struct {
 	Header Type
 }
 
+// RequestRuntimeMessage asks the runtime manager for the least loaded runtime of the deployment, which is answered
+// with its pid or errors.ErrDeploymentSaturated. The request is counted on the runtime until ReleaseRuntimeMessage.
 type RequestRuntimeMessage struct {
 	DeploymentID string
 	Runtime      string
+	Concurrency  types.ConcurrencyPolicy
+}
+
+// ReleaseRuntimeMessage tells the runtime manager that a request acquired on the runtime is done.
+type ReleaseRuntimeMessage struct {
+	DeploymentID string
+	PID          *actor.PID
+	Failed       bool // the runtime failed the request, which counts towards opening the circuit of the deployment
 }
 
+// RemoveRuntimeMessage asks the runtime manager to stop the idle runtime, or every runtime of the deployment if PID
+// is nil. Runtimes still serving requests are stopped once they are done.
 type RemoveRuntimeMessage struct {
 	DeploymentID string
+	PID          *actor.PID
+}
+
+// ListRuntimesMessage asks the runtime manager for its runtimes, which is answered with []RuntimeInfo.
+type ListRuntimesMessage struct{}
+
+// RuntimeInfo is a runtime known by the runtime manager.
+type RuntimeInfo struct {
+	DeploymentID string
+	PID          *actor.PID
+	InFlight     int  // requests queued on or served by the runtime
+	Draining     bool // the runtime is stopped once it served its requests
 }
 
+// RuntimeStatsMessage asks a runtime for its RuntimeStats, it does not count as activity of the runtime.
+type RuntimeStatsMessage struct{}
+
+func (RuntimeStatsMessage) NotInfluenceReceiveTimeout() {}
+
+// RuntimeStats is the usage of a runtime since it started.
+type RuntimeStats struct {
+	DeploymentID string            `json:"deploymentID"`
+	Runtime      string            `json:"runtime"`
+	StartedAt    int64             `json:"startedAt"`     // unix milliseconds
+	LastRequest  int64             `json:"lastRequestAt"` // unix milliseconds, 0 if it served no request yet
+	Requests     int64             `json:"requests"`
+	Memory       types.MemoryStats `json:"memory"`
+}
+
+// RequestMessage is sent by the ingress to the server actor of its own node, so it could carry the channel and the
+// stream of the request.
 type RequestMessage struct {
-	Request    *pb.HTTPRequest
-	ResponseCh chan<- *pb.HTTPResponse
+	Request     *pb.HTTPRequest
+	ResponseCh  chan<- *pb.HTTPResponse
+	Stream      types.Stream            // body of the request and writer of the response of streaming endpoints, nil if the body is in the request
+	Concurrency types.ConcurrencyPolicy // of the endpoint, which bounds the runtimes serving the deployment
+}
+
+// RequestDoneMessage tells the server that the ingress is done with the request, whether it was answered or not.
+type RequestDoneMessage struct {
+	RequestID string
 }
 
 func NewRequestMessage(req *pb.HTTPRequest, rspCh chan<- *pb.HTTPResponse) *RequestMessage {
@@ -44,6 +94,14 @@ func NewRequestMessage(req *pb.HTTPRequest, rspCh chan<- *pb.HTTPResponse) *Requ
 	}
 }
 
+// InvokeMessage asks the runtime to serve the request, reading the body from and writing the response to given stream.
+// The stream wraps the connection of the client, so it is only sent to runtimes on the node which accepted the
+// request, remote runtimes are sent the request with its body instead.
+type InvokeMessage struct {
+	Request *pb.HTTPRequest
+	Stream  types.Stream
+}
+
 type StartMessage struct{}
 
 type MetricMessage struct {
@@ -55,4 +113,5 @@ type MetricMessage struct {
 type ResponseWithMetric struct {
 	Response      *pb.HTTPResponse
 	MetricMessage *MetricMessage
+	Failed        bool // the runtime could not be initialized or crashed, rather than the guest answering an error
 }
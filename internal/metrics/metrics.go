@@ -0,0 +1,138 @@
+/*
+Package metrics holds the prometheus collectors exposed by the ingress at /metrics.
+*/
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "run"
+
+var (
+	requestLabels = []string{"endpoint_id", "deployment_id", "runtime", "status_class"}
+
+	// Registry is the registry served by Handler, collectors registered here are exposed at /metrics.
+	Registry = prometheus.NewRegistry()
+
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingress",
+		Name:      "requests_total",
+		Help:      "Number of requests served by the ingress.",
+	}, requestLabels)
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ingress",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of requests served by the ingress.",
+		Buckets:   prometheus.DefBuckets,
+	}, requestLabels)
+
+	LiveRuntimes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "live",
+		Help:      "Number of live runtime actors.",
+	})
+
+	ModuleCompileSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "module_compile_seconds",
+		Help:      "Time spent compiling the module of the deployment the last time its runtime was initialized.",
+	}, []string{"deployment_id", "runtime"})
+
+	InstancePoolTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "instance_pool_total",
+		Help:      "Number of invocations of reactor modules, by whether a warm instance was taken from the pool (hit) or initialized for it (miss).",
+	}, []string{"deployment_id", "result"})
+
+	RequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "requests_in_flight",
+		Help:      "Number of requests queued on or served by the runtimes of the deployment.",
+	}, []string{"deployment_id"})
+
+	SaturatedRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "saturated_requests_total",
+		Help:      "Number of requests answered with 429 since every runtime of the deployment queued as many requests as allowed.",
+	}, []string{"deployment_id"})
+
+	CircuitOpenedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "circuit_opened_total",
+		Help:      "Number of times the circuit of the deployment opened after its runtimes failed repeatedly, its requests are then refused with 503.",
+	}, []string{"deployment_id"})
+
+	TrafficRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingress",
+		Name:      "traffic_requests_total",
+		Help:      "Number of live requests of endpoints which split their traffic, by the deployment picked and whether it is the active deployment (stable) or not (canary).",
+	}, []string{"endpoint_id", "deployment_id", "track"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestsTotal,
+		RequestDuration,
+		LiveRuntimes,
+		ModuleCompileSeconds,
+		InstancePoolTotal,
+		RequestsInFlight,
+		SaturatedRequestsTotal,
+		CircuitOpenedTotal,
+		TrafficRequestsTotal,
+	)
+}
+
+// Handler returns the http handler which serves the registry in prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a request served by the ingress.
+func ObserveRequest(endpointID, deploymentID, runtime string, status int, duration time.Duration) {
+	labels := prometheus.Labels{
+		"endpoint_id":   endpointID,
+		"deployment_id": deploymentID,
+		"runtime":       runtime,
+		"status_class":  StatusClass(status),
+	}
+	RequestsTotal.With(labels).Inc()
+	RequestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// RegisterModCacheSize exposes the size of the module cache through given size function.
+func RegisterModCacheSize(size func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "mod_cache_size",
+		Help:      "Number of compiled modules held by the module cache.",
+	}, func() float64 { return float64(size()) }))
+}
+
+// StatusClass returns the class of given http status, such as 2xx.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
@@ -0,0 +1,32 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/metrics"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusClass(t *testing.T) {
+	require.Equal(t, "2xx", metrics.StatusClass(http.StatusOK))
+	require.Equal(t, "4xx", metrics.StatusClass(http.StatusNotFound))
+	require.Equal(t, "5xx", metrics.StatusClass(http.StatusGatewayTimeout))
+	require.Equal(t, "unknown", metrics.StatusClass(0))
+}
+
+func TestHandler(t *testing.T) {
+	metrics.ObserveRequest("endpoint", "deployment", "go", http.StatusOK, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	require.True(t, strings.Contains(body, `run_ingress_requests_total{deployment_id="deployment",endpoint_id="endpoint",runtime="go",status_class="2xx"} 1`))
+	require.True(t, strings.Contains(body, "run_ingress_request_duration_seconds_bucket"))
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// AllowedHostModules are the host modules which a guest could import from, they are instantiated by New.
+var AllowedHostModules = []string{wasi_snapshot_preview1.ModuleName, HostModuleName}
+
+// startFunction is run by the runtime for each request.
+const startFunction = "_start"
+
+// Inspect compiles the module the way New does and checks that it could be run: it must only import functions
+// provided by the allowed host modules, with matching signatures, and export _start, or HandleFunction for reactor
+// modules. The returned info lists what the module imports and exports along with the problems found, the error
+// reports all of them at once.
+func Inspect(ctx context.Context, blob []byte) (*types.ModuleInfo, error) {
+	r := wazero.NewRuntime(ctx)
+	defer func() { _ = r.Close(ctx) }()
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	if err := instantiateHostModule(ctx, r); err != nil {
+		return nil, fmt.Errorf("runtime: failed to instantiate host module, err: %v", err)
+	}
+
+	info := &types.ModuleInfo{InspectedAt: time.Now().Unix()}
+	mod, err := r.CompileModule(ctx, blob)
+	if err != nil {
+		info.Problems = append(info.Problems, err.Error())
+		return info, invalidModule(info)
+	}
+	defer func() { _ = mod.Close(ctx) }()
+
+	for _, def := range mod.ImportedFunctions() {
+		moduleName, name, _ := def.Import()
+		info.Imports = append(info.Imports, moduleName+"."+name)
+		if !slices.Contains(AllowedHostModules, moduleName) {
+			info.Problems = append(info.Problems,
+				fmt.Sprintf("imports function %s.%s of host module %s which is not one of %s",
+					moduleName, name, moduleName, strings.Join(AllowedHostModules, ", ")))
+			continue
+		}
+		fn := r.Module(moduleName).ExportedFunction(name)
+		if fn == nil {
+			info.Problems = append(info.Problems,
+				fmt.Sprintf("imports function %s.%s which host module %s does not provide", moduleName, name, moduleName))
+			continue
+		}
+		want, got := signature(fn.Definition()), signature(def)
+		if want != got {
+			info.Problems = append(info.Problems,
+				fmt.Sprintf("imports function %s.%s as %s but it is %s", moduleName, name, got, want))
+		}
+	}
+	for _, def := range mod.ImportedMemories() {
+		moduleName, name, _ := def.Import()
+		info.Imports = append(info.Imports, moduleName+"."+name)
+		info.Problems = append(info.Problems,
+			fmt.Sprintf("imports memory %s.%s but host modules do not provide memories", moduleName, name))
+	}
+
+	exports := mod.ExportedFunctions()
+	for name := range exports {
+		info.Exports = append(info.Exports, name)
+	}
+	sort.Strings(info.Exports)
+	entry, name := exports[startFunction], startFunction
+	if entry == nil {
+		entry, name = exports[HandleFunction], HandleFunction
+	}
+	if entry == nil {
+		info.Problems = append(info.Problems, fmt.Sprintf("does not export %s or %s", startFunction, HandleFunction))
+	} else if len(entry.ParamTypes()) != 0 || len(entry.ResultTypes()) != 0 {
+		info.Problems = append(info.Problems, fmt.Sprintf("exports %s as %s but it must be () -> ()", name, signature(entry)))
+	}
+
+	if len(info.Problems) > 0 {
+		return info, invalidModule(info)
+	}
+	info.Valid = true
+	return info, nil
+}
+
+func invalidModule(info *types.ModuleInfo) error {
+	return errors.Newf("%w: %s", errors.ErrInvalidModule, strings.Join(info.Problems, "; "))
+}
+
+// signature formats the function type as (params) -> (results).
+func signature(def api.FunctionDefinition) string {
+	names := func(types []api.ValueType) string {
+		var parts []string
+		for _, t := range types {
+			parts = append(parts, api.ValueTypeName(t))
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return names(def.ParamTypes()) + " -> " + names(def.ResultTypes())
+}
@@ -0,0 +1,30 @@
+package runtime
+
+import (
+	"io"
+)
+
+const (
+	pageSize = 65536
+	// memoryGrowSlackPages is how close to the memory limit the guest must be to consider the limit hit,
+	// the go runtime grows its heap by arenas of 4MiB.
+	memoryGrowSlackPages = 64
+)
+
+// limitedWriter writes to w until limit bytes were written, writes beyond the limit fail.
+type limitedWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	exceeded bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.written+int64(len(p)) > l.limit {
+		l.exceeded = true
+		return 0, io.ErrShortWrite
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
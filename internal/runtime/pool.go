@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/hnimtadd/run/internal/metrics"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	// HandleFunction is exported by reactor modules, which are initialized once by _initialize rather than run by
+	// _start for each request. It handles the request read from stdin and writes the response to stdout the way
+	// _start of a command module does, the instance then handles further requests.
+	HandleFunction     = "handle"
+	initializeFunction = "_initialize"
+)
+
+// instance is an initialized instance of a reactor module, its stdio is redirected to the current invocation.
+type instance struct {
+	mod    api.Module
+	handle api.Function
+	env    map[string]string
+	args   []string
+	stdin  *switchReader
+	stdout *switchWriter
+	stderr *switchWriter
+}
+
+func (i *instance) attach(stdin io.Reader, stdout, stderr io.Writer) {
+	i.stdin.r, i.stdout.w, i.stderr.w = stdin, stdout, stderr
+}
+
+func (i *instance) detach() {
+	i.stdin.r, i.stdout.w, i.stderr.w = nil, nil, nil
+}
+
+// IsReactor reports whether the module is a reactor, whose instances are kept warm in the pool of the runtime.
+func (r *Runtime) IsReactor() bool {
+	return r.reactor
+}
+
+// Prewarm fills the pool with instances initialized with env, so that the first requests do not pay for the
+// initialization. It does nothing for command modules.
+func (r *Runtime) Prewarm(env map[string]string) error {
+	for r.reactor && len(r.pool) < cap(r.pool) {
+		ctx, cancel := context.WithTimeout(r.ctx, r.limits.WallTime())
+		inst, err := r.instantiate(ctx, env, nil)
+		cancel()
+		if err != nil {
+			return err
+		}
+		r.release(inst)
+	}
+	return nil
+}
+
+// acquire takes an instance initialized with the same env and args from the pool, or initializes a new one.
+// Instances initialized for other env or args are dropped.
+func (r *Runtime) acquire(ctx context.Context, env map[string]string, args []string) (*instance, error) {
+	for {
+		select {
+		case inst := <-r.pool:
+			r.warmMemory.Add(-int64(memorySize(inst.mod)))
+			if maps.Equal(inst.env, env) && slices.Equal(inst.args, args) {
+				metrics.InstancePoolTotal.WithLabelValues(r.deploymentID.String(), "hit").Inc()
+				return inst, nil
+			}
+			_ = inst.mod.Close(r.ctx)
+			continue
+		default:
+		}
+		metrics.InstancePoolTotal.WithLabelValues(r.deploymentID.String(), "miss").Inc()
+		return r.instantiate(ctx, env, args)
+	}
+}
+
+// release puts the instance back to the pool, unless the pool is full or the instance is no longer usable.
+func (r *Runtime) release(inst *instance) {
+	if !inst.mod.IsClosed() && !r.memoryExhausted(inst.mod.Memory()) {
+		size := int64(memorySize(inst.mod))
+		r.warmMemory.Add(size)
+		select {
+		case r.pool <- inst:
+			return
+		default:
+		}
+		r.warmMemory.Add(-size)
+	}
+	_ = inst.mod.Close(r.ctx)
+}
+
+func (r *Runtime) instantiate(ctx context.Context, env map[string]string, args []string) (*instance, error) {
+	inst := &instance{
+		env:    env,
+		args:   args,
+		stdin:  new(switchReader),
+		stdout: new(switchWriter),
+		stderr: new(switchWriter),
+	}
+	modConf := r.moduleConfig(inst.stdin, inst.stdout, inst.stderr, env, args).
+		// instances of the pool live side by side, which requires them to be anonymous.
+		WithName("").
+		WithStartFunctions(initializeFunction)
+	mod, err := r.runtime.InstantiateModule(ctx, r.mod, modConf)
+	if err != nil {
+		if mod != nil {
+			_ = mod.Close(r.ctx)
+		}
+		return nil, err
+	}
+	inst.mod = mod
+	inst.handle = mod.ExportedFunction(HandleFunction)
+	return inst, nil
+}
+
+func (r *Runtime) moduleConfig(stdin io.Reader, stdout, stderr io.Writer, env map[string]string, args []string) wazero.ModuleConfig {
+	modConf := wazero.
+		NewModuleConfig().
+		WithStdin(stdin).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithArgs(args...)
+	for key, value := range env {
+		modConf = modConf.WithEnv(key, value)
+	}
+	return modConf
+}
+
+// switchReader reads from r, which is at its end when unset.
+type switchReader struct {
+	r io.Reader
+}
+
+func (s *switchReader) Read(p []byte) (int, error) {
+	if s.r == nil {
+		return 0, io.EOF
+	}
+	return s.r.Read(p)
+}
+
+// switchWriter writes to w, writes are discarded when unset.
+type switchWriter struct {
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	if s.w == nil {
+		return len(p), nil
+	}
+	return s.w.Write(p)
+}
@@ -4,18 +4,27 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync/atomic"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/types"
 
 	"github.com/google/uuid"
 	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
 )
 
 type Args struct {
 	Stdout       io.Writer
+	Stderr       io.Writer // output of the guest written to stderr, discarded if nil
 	Cache        wazero.CompilationCache
 	Engine       string
 	Blob         []byte
 	DeploymentID uuid.UUID
+	Limits       types.ResourceLimits
+	PoolSize     int // warm instances kept for reactor modules, see HandleFunction
 }
 
 type Runtime struct {
@@ -23,49 +32,173 @@ type Runtime struct {
 	mod          wazero.CompiledModule
 	runtime      wazero.Runtime
 	stdout       io.Writer
+	stderr       io.Writer
 	engine       string
 	blob         []byte
 	deploymentID uuid.UUID
+	limits       types.ResourceLimits
+	reactor      bool
+	pool         chan *instance
+	warmMemory   atomic.Int64  // bytes of linear memory held by the instances of the pool
+	peakMemory   atomic.Uint64 // bytes of linear memory of the largest instance so far
 }
 
 func New(ctx context.Context, args Args) (*Runtime, error) {
+	limits := args.Limits.WithDefaults()
 	config := wazero.NewRuntimeConfig().
 		WithCompilationCache(args.Cache).
+		WithMemoryLimitPages(limits.MaxMemoryPages).
 		WithCloseOnContextDone(true)
 	r := wazero.NewRuntimeWithConfig(ctx, config)
 	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	if err := instantiateHostModule(ctx, r); err != nil {
+		return nil, fmt.Errorf("runtime: failed to instantiate host module, err: %v", err)
+	}
 
 	mod, err := r.CompileModule(ctx, args.Blob)
 	if err != nil {
 		return nil, fmt.Errorf("runtime: failed to compile module, err: %v", err)
 	}
 
+	stderr := args.Stderr
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	exports := mod.ExportedFunctions()
+	_, isCommand := exports[startFunction]
+	_, handles := exports[HandleFunction]
+
 	return &Runtime{
 		engine:       args.Engine,
 		stdout:       args.Stdout,
+		stderr:       stderr,
 		runtime:      r,
 		mod:          mod,
 		blob:         args.Blob,
 		ctx:          ctx,
 		deploymentID: args.DeploymentID,
+		limits:       limits,
+		reactor:      !isCommand && handles,
+		pool:         make(chan *instance, args.PoolSize),
 	}, nil
 }
 
-func (r *Runtime) Invoke(stdin io.Reader, env map[string]string, args ...string) error {
-	modConf := wazero.
-		NewModuleConfig().
-		WithStdin(stdin).
-		WithStdout(r.stdout).
-		WithArgs(args...)
+// Invoke instantiates the module and runs it until it exits, given ctx is done or one of the resource limits
+// is violated, in which case the error tells which limit. Reactor modules are not instantiated but handle the
+// request with a warm instance of the pool instead. The runtime could be invoked again afterward.
+func (r *Runtime) Invoke(ctx context.Context, stdin io.Reader, env map[string]string, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.limits.WallTime())
+	defer cancel()
+
+	stdout := &limitedWriter{w: r.stdout, limit: r.limits.MaxStdoutSize}
+	stderr := &limitedWriter{w: r.stderr, limit: r.limits.MaxStdoutSize}
+	if r.reactor {
+		return r.invokeReactor(ctx, stdin, stdout, stderr, env, args)
+	}
+
+	mod, err := r.runtime.InstantiateModule(ctx, r.mod, r.moduleConfig(stdin, stdout, stderr, env, args))
+	if mod != nil {
+		r.observeMemory(mod)
+		_ = mod.Close(r.ctx)
+	}
+	return r.invokeError(ctx, mod, stdout, stderr, err)
+}
+
+func (r *Runtime) invokeReactor(ctx context.Context, stdin io.Reader, stdout, stderr *limitedWriter, env map[string]string, args []string) error {
+	inst, err := r.acquire(ctx, env, args)
+	if err != nil {
+		return r.invokeError(ctx, nil, stdout, stderr, err)
+	}
+	inst.attach(stdin, stdout, stderr)
+	_, err = inst.handle.Call(ctx)
+	inst.detach()
+	r.observeMemory(inst.mod)
 
-	for key, value := range env {
-		modConf = modConf.WithEnv(key, value)
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		// the instance exited on its own, it is closed and not put back to the pool.
+		err = nil
 	}
+	if err = r.invokeError(ctx, inst.mod, stdout, stderr, err); err != nil {
+		_ = inst.mod.Close(r.ctx)
+		return err
+	}
+	r.release(inst)
+	return nil
+}
 
-	_, err := r.runtime.InstantiateModule(r.ctx, r.mod, modConf)
-	return err
+// invokeError tells which resource limit the failed invocation violated, if any.
+func (r *Runtime) invokeError(ctx context.Context, mod api.Module, stdout, stderr *limitedWriter, err error) error {
+	switch {
+	case stdout.exceeded || stderr.exceeded:
+		// the guest could ignore the failed writes and exit normally, but its output is truncated anyway.
+		return errors.ErrStdoutLimitExceeded
+	case err == nil:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return errors.ErrInvokeTimeout
+	case ctx.Err() == context.Canceled:
+		return errors.ErrInvokeCanceled
+	case mod != nil && r.memoryExhausted(mod.Memory()):
+		return errors.ErrMemoryLimitExceeded
+	default:
+		return err
+	}
+}
+
+// memoryExhausted reports whether the memory is too close to the limit to grow further.
+// wazero fails memory.grow silently at the limit, so a guest failing in this state most likely died of it.
+func (r *Runtime) memoryExhausted(mem api.Memory) bool {
+	if mem == nil {
+		return false
+	}
+	slack := uint32(memoryGrowSlackPages)
+	if slack > r.limits.MaxMemoryPages/8 {
+		slack = r.limits.MaxMemoryPages / 8
+	}
+	pages := mem.Size() / pageSize
+	return pages+slack >= r.limits.MaxMemoryPages
+}
+
+// Stats returns the resources currently held by the runtime.
+func (r *Runtime) Stats() types.MemoryStats {
+	return types.MemoryStats{
+		WarmInstances: len(r.pool),
+		WarmMemory:    uint64(r.warmMemory.Load()),
+		PeakMemory:    r.peakMemory.Load(),
+	}
+}
+
+func (r *Runtime) observeMemory(mod api.Module) {
+	size := memorySize(mod)
+	for {
+		peak := r.peakMemory.Load()
+		if size <= peak || r.peakMemory.CompareAndSwap(peak, size) {
+			return
+		}
+	}
+}
+
+func memorySize(mod api.Module) uint64 {
+	// the memory of a closed module is gone, which is the case of modules stopped by the limits.
+	if mod == nil || mod.IsClosed() || mod.Memory() == nil {
+		return 0
+	}
+	return uint64(mod.Memory().Size())
+}
+
+// SupportsStreaming reports whether the module imports the host module, which means it was built
+// with an sdk able to stream request and response bodies.
+func (r *Runtime) SupportsStreaming() bool {
+	for _, fn := range r.mod.ImportedFunctions() {
+		if moduleName, _, _ := fn.Import(); moduleName == HostModuleName {
+			return true
+		}
+	}
+	return false
 }
 
+// Close closes the runtime along with the instances of its pool.
 func (r *Runtime) Close() error {
 	return r.runtime.Close(r.ctx)
 }
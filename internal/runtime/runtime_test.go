@@ -7,9 +7,12 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/runtime"
 	"github.com/hnimtadd/run/internal/shared"
+	"github.com/hnimtadd/run/internal/types"
 	pb "github.com/hnimtadd/run/pbs/gopb/v1"
 
 	"github.com/google/uuid"
@@ -40,7 +43,7 @@ func TestRuntime_InvokeGoCode(t *testing.T) {
 	}
 	r, err := runtime.New(context.Background(), args)
 	require.Nil(t, err)
-	require.Nil(t, r.Invoke(bytes.NewReader(breq), nil))
+	require.Nil(t, r.Invoke(context.Background(), bytes.NewReader(breq), nil))
 
 	log, body, err := shared.ParseStdout(out)
 	require.Nil(t, err)
@@ -111,7 +114,7 @@ func TestRuntime_InvokeGoCodeExample(t *testing.T) {
 
 	r, err := runtime.New(context.Background(), args)
 	require.Nil(t, err)
-	require.Nil(t, r.Invoke(bytes.NewReader(breq), nil))
+	require.Nil(t, r.Invoke(context.Background(), bytes.NewReader(breq), nil))
 
 	log, body, err := shared.ParseStdout(out)
 	require.Nil(t, err)
@@ -127,3 +130,267 @@ func TestRuntime_InvokeGoCodeExample(t *testing.T) {
 	require.Equal(t, 1, len(lines))
 	require.Equal(t, lines[0], "enter index")
 }
+
+// loopWasm is the binary of (module (func (export "_start") (loop (br 0)))).
+var loopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export section
+	0x0a, 0x09, 0x01, 0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, // code section
+}
+
+func TestRuntime_InvokeTimeout(t *testing.T) {
+	args := runtime.Args{
+		Stdout:       new(bytes.Buffer),
+		DeploymentID: uuid.New(),
+		Blob:         loopWasm,
+		Engine:       "go",
+		Cache:        wazero.NewCompilationCache(),
+	}
+	r, err := runtime.New(context.Background(), args)
+	require.Nil(t, err)
+
+	// runtime must stay usable after a timed out invocation
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		err = r.Invoke(ctx, bytes.NewReader(nil), nil)
+		cancel()
+		require.Equal(t, errors.ErrInvokeTimeout, err)
+	}
+	require.Nil(t, r.Close())
+}
+
+// growWasm is the binary of
+// (module (memory 1) (func (export "_start") (loop (br_if 0 (i32.ne (memory.grow (i32.const 1)) (i32.const -1)))) unreachable)).
+var growWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory section: 1 page
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export section
+	0x0a, 0x11, 0x01, 0x0f, 0x00, 0x03, 0x40, 0x41, 0x01, 0x40, 0x00, 0x41, 0x7f, 0x47, 0x0d, 0x00, 0x0b, 0x00, 0x0b, // code section
+}
+
+func TestRuntime_InvokeMemoryLimit(t *testing.T) {
+	args := runtime.Args{
+		Stdout:       new(bytes.Buffer),
+		DeploymentID: uuid.New(),
+		Blob:         growWasm,
+		Engine:       "go",
+		Cache:        wazero.NewCompilationCache(),
+		Limits:       types.ResourceLimits{MaxMemoryPages: 16},
+	}
+	r, err := runtime.New(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, errors.ErrMemoryLimitExceeded, r.Invoke(context.Background(), bytes.NewReader(nil), nil))
+	require.Nil(t, r.Close())
+}
+
+func TestRuntime_InvokeStdoutLimit(t *testing.T) {
+	b, err := os.ReadFile("./../_testdata/go/helloworld.wasm")
+	require.Nil(t, err)
+
+	req := &pb.HTTPRequest{
+		Method: "GET",
+		Url:    "/",
+	}
+	breq, err := proto.Marshal(req)
+	require.Nil(t, err)
+
+	args := runtime.Args{
+		Stdout:       new(bytes.Buffer),
+		DeploymentID: uuid.New(),
+		Blob:         b,
+		Engine:       "go",
+		Cache:        wazero.NewCompilationCache(),
+		Limits:       types.ResourceLimits{MaxStdoutSize: 8},
+	}
+	r, err := runtime.New(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, errors.ErrStdoutLimitExceeded, r.Invoke(context.Background(), bytes.NewReader(breq), nil))
+	require.Nil(t, r.Close())
+}
+
+// fakeStream serves the body from a reader and records the streamed response.
+type fakeStream struct {
+	body   *bytes.Reader
+	code   int
+	header http.Header
+	chunks []string
+}
+
+func (s *fakeStream) Read(p []byte) (int, error) {
+	return s.body.Read(p)
+}
+
+func (s *fakeStream) WriteHead(code int, header http.Header) error {
+	s.code = code
+	s.header = header
+	return nil
+}
+
+func (s *fakeStream) Write(p []byte) (int, error) {
+	s.chunks = append(s.chunks, string(p))
+	return len(p), nil
+}
+
+func TestRuntime_InvokeStream(t *testing.T) {
+	b, err := os.ReadFile("./../_testdata/go/stream.wasm")
+	require.Nil(t, err)
+
+	breq, err := proto.Marshal(&pb.HTTPRequest{Method: "POST", Url: "/"})
+	require.Nil(t, err)
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	args := runtime.Args{
+		Stdout:       out,
+		Stderr:       errOut,
+		DeploymentID: uuid.New(),
+		Blob:         b,
+		Engine:       "go",
+		Cache:        wazero.NewCompilationCache(),
+	}
+	r, err := runtime.New(context.Background(), args)
+	require.Nil(t, err)
+	require.True(t, r.SupportsStreaming())
+
+	stream := &fakeStream{body: bytes.NewReader([]byte("hello streaming"))}
+	ctx := runtime.WithStream(context.Background(), stream)
+	env := map[string]string{runtime.StreamingEnv: "1"}
+	require.Nil(t, r.Invoke(ctx, bytes.NewReader(breq), env))
+
+	require.Equal(t, http.StatusCreated, stream.code)
+	require.Equal(t, "text/plain", stream.header.Get("Content-Type"))
+	require.Equal(t, []string{"HELL", "O ST", "REAM", "ING"}, stream.chunks)
+
+	lines, err := shared.ParseLog(out.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, []string{"hello, this is a streamed request_log.go"}, lines)
+	require.Equal(t, "{\"level\":\"warn\",\"msg\":\"streamed to stderr\"}\n", errOut.String())
+	require.Nil(t, r.Close())
+}
+
+func TestRuntime_SupportsStreaming(t *testing.T) {
+	args := runtime.Args{
+		Stdout:       new(bytes.Buffer),
+		DeploymentID: uuid.New(),
+		Blob:         loopWasm,
+		Engine:       "go",
+		Cache:        wazero.NewCompilationCache(),
+	}
+	r, err := runtime.New(context.Background(), args)
+	require.Nil(t, err)
+	require.False(t, r.SupportsStreaming())
+	require.Nil(t, r.Close())
+}
+
+func TestInspect(t *testing.T) {
+	helloworld, err := os.ReadFile("./../_testdata/go/helloworld.wasm")
+	require.Nil(t, err)
+	info, err := runtime.Inspect(context.Background(), helloworld)
+	require.Nil(t, err)
+	require.True(t, info.Valid)
+	require.Contains(t, info.Imports, "wasi_snapshot_preview1.fd_write")
+	require.Contains(t, info.Exports, "_start")
+
+	stream, err := os.ReadFile("./../_testdata/go/stream.wasm")
+	require.Nil(t, err)
+	info, err = runtime.Inspect(context.Background(), stream)
+	require.Nil(t, err)
+	require.Contains(t, info.Imports, "run.write_body")
+
+	info, err = runtime.Inspect(context.Background(), loopWasm)
+	require.Nil(t, err)
+	require.Empty(t, info.Imports)
+	require.Equal(t, []string{"_start"}, info.Exports)
+
+	// (module (import "env" "foo" (func)) (import "wasi_snapshot_preview1" "fd_write" (func (param i32))))
+	name := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	imports := []byte{0x02}
+	imports = append(append(append(imports, name("env")...), name("foo")...), 0x00, 0x00)
+	imports = append(append(append(imports, name("wasi_snapshot_preview1")...), name("fd_write")...), 0x00, 0x01)
+	bad := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+		0x01, 0x08, 0x02, 0x60, 0x00, 0x00, 0x60, 0x01, 0x7f, 0x00, // type section: func() -> (), func(i32) -> ()
+		0x02, byte(len(imports)), // import section
+	}
+	bad = append(bad, imports...)
+	info, err = runtime.Inspect(context.Background(), bad)
+	require.ErrorIs(t, err, errors.ErrInvalidModule)
+	require.False(t, info.Valid)
+	require.Equal(t, []string{"env.foo", "wasi_snapshot_preview1.fd_write"}, info.Imports)
+	require.Len(t, info.Problems, 3)
+	require.Contains(t, err.Error(), "host module env which is not one of")
+	require.Contains(t, err.Error(), "imports function wasi_snapshot_preview1.fd_write as (i32) -> () but it is (i32, i32, i32, i32) -> (i32)")
+	require.Contains(t, err.Error(), "does not export _start")
+
+	info, err = runtime.Inspect(context.Background(), []byte("not a wasm module"))
+	require.ErrorIs(t, err, errors.ErrInvalidModule)
+	require.Len(t, info.Problems, 1)
+}
+
+func TestRuntime_InvokeReactor(t *testing.T) {
+	// the reactor is built apart from the other examples, since go:wasmexport needs go1.24 or later.
+	b, err := os.ReadFile("./../_testdata/go/reactor.wasm")
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("reactor.wasm is not built, run make build_reactor_example with go1.24 or later")
+	}
+	require.Nil(t, err)
+	info, err := runtime.Inspect(context.Background(), b)
+	require.Nil(t, err)
+	require.Contains(t, info.Exports, runtime.HandleFunction)
+
+	breq, err := proto.Marshal(&pb.HTTPRequest{Method: "GET", Url: "/"})
+	require.Nil(t, err)
+	cache := wazero.NewCompilationCache()
+	newRuntime := func(poolSize int) (*runtime.Runtime, *bytes.Buffer) {
+		out := new(bytes.Buffer)
+		r, err := runtime.New(context.Background(), runtime.Args{
+			Stdout:       out,
+			DeploymentID: uuid.New(),
+			Blob:         b,
+			Engine:       "go",
+			Cache:        cache,
+			PoolSize:     poolSize,
+		})
+		require.Nil(t, err)
+		require.True(t, r.IsReactor())
+		t.Cleanup(func() { _ = r.Close() })
+		return r, out
+	}
+	invoke := func(r *runtime.Runtime, out *bytes.Buffer) string {
+		defer out.Reset()
+		require.Nil(t, r.Invoke(context.Background(), bytes.NewReader(breq), nil))
+		_, body, err := shared.ParseStdout(out)
+		require.Nil(t, err)
+		rsp := new(pb.HTTPResponse)
+		require.Nil(t, proto.Unmarshal(body, rsp))
+		require.Equal(t, http.StatusOK, int(rsp.Code))
+		return string(rsp.Body)
+	}
+
+	// the warm instance keeps its state between requests.
+	r, out := newRuntime(1)
+	require.Equal(t, "served 1", invoke(r, out))
+	require.Equal(t, "served 2", invoke(r, out))
+
+	// instances are initialized for each request without a pool.
+	r, out = newRuntime(0)
+	require.Equal(t, "served 1", invoke(r, out))
+	require.Equal(t, "served 1", invoke(r, out))
+
+	// prewarmed instances are initialized but did not serve yet.
+	r, out = newRuntime(2)
+	require.Nil(t, r.Prewarm(nil))
+	require.Equal(t, "served 1", invoke(r, out))
+
+	helloworld, err := os.ReadFile("./../_testdata/go/helloworld.wasm")
+	require.Nil(t, err)
+	command, err := runtime.New(context.Background(), runtime.Args{Stdout: out, Blob: helloworld, Cache: wazero.NewCompilationCache(), PoolSize: 1})
+	require.Nil(t, err)
+	require.False(t, command.IsReactor())
+	require.Nil(t, command.Prewarm(nil))
+	require.Nil(t, command.Close())
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/hnimtadd/run/internal/types"
+	pb "github.com/hnimtadd/run/pbs/gopb/v1"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// HostModuleName is the name of the host module which streams request and response bodies.
+	HostModuleName = "run"
+	// StreamingEnv is set to "1" in the guest environment when the invocation is streamed,
+	// the sdk then reads the request body and writes the response through the host module.
+	StreamingEnv = "RUN_STREAMING"
+)
+
+type streamKey struct{}
+
+// WithStream returns a copy of ctx which streams the invocation through the given stream.
+func WithStream(ctx context.Context, stream types.Stream) context.Context {
+	return context.WithValue(ctx, streamKey{}, stream)
+}
+
+func streamFrom(ctx context.Context) types.Stream {
+	stream, _ := ctx.Value(streamKey{}).(types.Stream)
+	return stream
+}
+
+// instantiateHostModule exports the streaming functions to the guest:
+//
+//	read_body(ptr, len) -> n: reads at most len bytes of the request body, 0 at the end of the body, -1 on error.
+//	write_head(ptr, len) -> errno: writes the proto encoded pb.HTTPResponse without body as the response head.
+//	write_body(ptr, len) -> errno: writes a chunk of the response body.
+func instantiateHostModule(ctx context.Context, r wazero.Runtime) error {
+	_, err := r.NewHostModuleBuilder(HostModuleName).
+		NewFunctionBuilder().WithFunc(readBody).Export("read_body").
+		NewFunctionBuilder().WithFunc(writeHead).Export("write_head").
+		NewFunctionBuilder().WithFunc(writeBody).Export("write_body").
+		Instantiate(ctx)
+	return err
+}
+
+func readBody(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+	stream := streamFrom(ctx)
+	if stream == nil {
+		return -1
+	}
+	buf := make([]byte, size)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if !m.Memory().Write(ptr, buf[:n]) {
+				return -1
+			}
+			return int32(n)
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			return -1
+		}
+	}
+}
+
+func writeHead(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+	stream := streamFrom(ctx)
+	if stream == nil {
+		return -1
+	}
+	buf, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return -1
+	}
+	rsp := new(pb.HTTPResponse)
+	if err := proto.Unmarshal(buf, rsp); err != nil {
+		return -1
+	}
+	header := http.Header{}
+	for key, value := range rsp.GetHeader() {
+		header[key] = value.GetFields()
+	}
+	if err := stream.WriteHead(int(rsp.GetCode()), header); err != nil {
+		return -1
+	}
+	return 0
+}
+
+func writeBody(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+	stream := streamFrom(ctx)
+	if stream == nil {
+		return -1
+	}
+	buf, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return -1
+	}
+	if _, err := stream.Write(buf); err != nil {
+		return -1
+	}
+	return 0
+}
@@ -1,3 +1,140 @@
 package settings
 
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
 var MaxBlobSize int64 = 1e7 * 50
+
+var (
+	DefaultRequestTimeout        = time.Second * 30
+	MaxRequestTimeout            = time.Minute * 5
+	DefaultMaxMemoryPages uint32 = 8192 // 512MiB, a wasm page is 64KiB
+	MaxMemoryPages        uint32 = 65536
+	DefaultMaxStdoutSize  int64  = 1 << 24 // 16MiB
+	MaxStdoutSize         int64  = 1 << 27 // 128MiB
+	// MaxRequestBodySize bounds the body of requests which are read as a whole rather than streamed to the guest.
+	MaxRequestBodySize int64 = 1 << 25 // 32MiB
+	// RequestTimeoutGrace is how long the ingress waits for the runtime after the request timeout
+	// before giving up on it, the runtime normally answers timed out requests itself.
+	RequestTimeoutGrace = time.Second * 5
+	// MaxWarmInstances bounds how many initialized instances of a reactor module each runtime keeps.
+	MaxWarmInstances = 16
+)
+
+var (
+	DefaultRuntimeInstances = 1
+	MaxRuntimeInstances     = 32
+	// DefaultMaxQueueDepth is how many requests each runtime of a deployment queues before the ingress answers
+	// further requests with 429.
+	DefaultMaxQueueDepth = 16
+	MaxQueueDepth        = 1024
+	// SaturatedRetryAfter is sent as Retry-After along with 429 answers of saturated deployments.
+	SaturatedRetryAfter = time.Second
+	// RuntimeIdleTimeout is how long a runtime waits for a request before it is stopped along with its module.
+	RuntimeIdleTimeout = time.Minute * 5
+	// RuntimeSweepInterval is how often runtimes of deleted, failed or retired deployments are stopped.
+	RuntimeSweepInterval = time.Minute
+	// RuntimeInitAttempts is how many times a runtime tries to load its module before the request fails, waiting
+	// RuntimeInitBackoff after the first failed attempt and twice as long after each further one.
+	RuntimeInitAttempts = 3
+	RuntimeInitBackoff  = time.Millisecond * 100
+	// CircuitFailureThreshold is how many requests in a row the runtimes of a deployment fail before the ingress
+	// refuses its requests with 503 for CircuitCooldown, after which a single request probes the deployment.
+	CircuitFailureThreshold = 5
+	CircuitCooldown         = time.Second * 30
+	// IngressAdminTimeout bounds the requests of the api server to the admin endpoints of the ingress.
+	IngressAdminTimeout = time.Second * 5
+)
+
+var (
+	DefaultLogPageSize = 50
+	MaxLogPageSize     = 500
+)
+
+var (
+	DefaultLogRetention = time.Hour * 24 * 7
+	MaxLogRetention     = time.Hour * 24 * 365
+	// LogRetentionSweepInterval is how often logs beyond the request count of their endpoint retention are removed
+	// and logs appended before logs carried their endpoint are attributed to it, expired logs are removed by the
+	// store on its own.
+	LogRetentionSweepInterval = time.Minute * 10
+)
+
+var (
+	// LogTailInterval is how often the log store is polled for new logs of tailed deployments.
+	LogTailInterval = time.Second
+	// LogStreamHeartbeat is how often an idle log stream sends a comment to keep the connection open.
+	LogStreamHeartbeat = time.Second * 15
+)
+
+var (
+	DefaultMetricWindow = time.Hour
+	DefaultMetricStep   = time.Minute
+	MaxMetricBuckets    = 1440
+)
+
+var (
+	// GoBinary is the go toolchain used to build deployments uploaded as source.
+	GoBinary              = "go"
+	MaxSourceSize   int64 = 1 << 26 // 64MiB
+	BuildTimeout          = time.Minute * 5
+	MaxBuildLogSize       = 1 << 20 // 1MiB
+	// BuildCacheDir and BuildModCacheDir are the build cache and the module cache shared by builds, apart from the
+	// ones of the host. Both are content addressed, modules are verified against the checksum database.
+	BuildCacheDir    = filepath.Join(os.TempDir(), "run", "build", "cache")
+	BuildModCacheDir = filepath.Join(os.TempDir(), "run", "build", "modcache")
+)
+
+var (
+	DeployWorkers = 2
+	// DeployQueueSize is how many deployments could wait for a deploy worker before new ones are rejected.
+	DeployQueueSize = 64
+	// DeployStepAttempts is how many times a deploy step which talks to the stores is tried before the deploy fails.
+	DeployStepAttempts = 3
+	DeployRetryBackoff = time.Second
+	// DefaultDeployHistory is how many of the latest deployments of an endpoint are kept when its history is pruned.
+	DefaultDeployHistory = 10
+)
+
+var (
+	// ModCacheDir is where the ingress keeps compiled modules, so that restarts do not compile them again.
+	ModCacheDir           = filepath.Join(os.TempDir(), "run", "modcache")
+	MaxModCacheSize int64 = 1 << 30 // 1GiB
+	// ModCacheSweepInterval is how often compiled modules of deleted or failed deployments are removed.
+	ModCacheSweepInterval = time.Minute * 10
+)
+
+var (
+	// EdgeDomain is the domain under which endpoints are served by slug, as {slug}.{EdgeDomain}. Custom hosts of
+	// endpoints could not be under it.
+	EdgeDomain       = "edge.local"
+	MaxEndpointHosts = 16
+	// RoutingTableTTL is how long the ingress routes hosts with the endpoints it loaded, a host which is not routed
+	// reloads them at most every RoutingTableMissRefresh so that new endpoints are served right away.
+	RoutingTableTTL         = time.Second * 30
+	RoutingTableMissRefresh = time.Second
+)
+
+var (
+	MaxTrafficTargets = 10
+	// TrafficCookie and TrafficKeyHeader carry the key which keeps a client on the same deployment of a traffic split,
+	// the ingress sets the cookie on clients which send neither.
+	TrafficCookie       = "run_traffic"
+	TrafficKeyHeader    = "X-Run-Traffic-Key"
+	TrafficCookieMaxAge = time.Hour * 24
+)
+
+var (
+	// HealthCheckInterval is how often the api server checks newly active deployments against the health policy of
+	// their endpoint.
+	HealthCheckInterval      = time.Second * 15
+	DefaultHealthWindow      = time.Minute * 10
+	MaxHealthWindow          = time.Hour * 24
+	DefaultHealthMinRequests = 20
+	// MaxHealthP95 bounds the p95 latency rule, no request runs for longer than MaxRequestTimeout so a higher bound
+	// could never be broken.
+	MaxHealthP95 = MaxRequestTimeout
+)
@@ -0,0 +1,101 @@
+package shared
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hnimtadd/run/internal/types"
+)
+
+var (
+	levelKeys   = []string{"level", "lvl", "severity"}
+	messageKeys = []string{"msg", "message"}
+	timeKeys    = []string{"time", "ts", "timestamp"}
+)
+
+// ParseLogEntries parses each line of the output written to given stream into a log entry.
+// Lines which are json objects are parsed into structured entries, their level, message and time
+// are taken from the common keys and the other keys are kept as fields. Other lines are plain messages,
+// logged at info level on stdout and at error level on stderr. Entries without time are stamped with at.
+func ParseLogEntries(out []byte, stream types.LogStream, at time.Time) []types.LogEntry {
+	lines, _ := ParseLog(out)
+	defaultLevel := types.LogLevelInfo
+	if stream == types.LogStreamStderr {
+		defaultLevel = types.LogLevelError
+	}
+
+	entries := make([]types.LogEntry, 0, len(lines))
+	for _, line := range lines {
+		entry := types.LogEntry{
+			Stream:  stream,
+			Level:   defaultLevel,
+			Time:    at.UnixMilli(),
+			Message: line,
+		}
+		if fields := parseJSONLine(line); fields != nil {
+			applyFields(&entry, fields)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func parseJSONLine(line string) map[string]any {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func applyFields(entry *types.LogEntry, fields map[string]any) {
+	if raw, ok := popString(fields, levelKeys); ok {
+		if level, ok := types.ParseLogLevel(raw); ok {
+			entry.Level = level
+		}
+	}
+	if msg, ok := popString(fields, messageKeys); ok {
+		entry.Message = msg
+	}
+	for _, key := range timeKeys {
+		if t, ok := parseLogTime(fields[key]); ok {
+			entry.Time = t.UnixMilli()
+			delete(fields, key)
+			break
+		}
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+}
+
+func popString(fields map[string]any, keys []string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := fields[key].(string); ok {
+			delete(fields, key)
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// parseLogTime accepts RFC3339 formatted time or unix timestamp in seconds or milliseconds.
+func parseLogTime(raw any) (time.Time, bool) {
+	switch value := raw.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		return t, err == nil
+	case float64:
+		if value > 1e11 {
+			return time.UnixMilli(int64(value)), true
+		}
+		sec := int64(value)
+		return time.Unix(sec, int64((value-float64(sec))*1e9)), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,38 @@
+package shared_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/shared"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogEntries(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	out := []byte("plain line\n" +
+		`{"level":"WARNING","msg":"structured","time":"2023-11-14T22:13:21Z","user":"alice"}` + "\n" +
+		`{"severity":"debug","message":"unix time","ts":1700000001.5}` + "\n" +
+		"{not json\n")
+
+	entries := shared.ParseLogEntries(out, types.LogStreamStdout, at)
+	require.Equal(t, []types.LogEntry{
+		{Stream: types.LogStreamStdout, Level: types.LogLevelInfo, Time: at.UnixMilli(), Message: "plain line"},
+		{
+			Stream:  types.LogStreamStdout,
+			Level:   types.LogLevelWarn,
+			Time:    time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC).UnixMilli(),
+			Message: "structured",
+			Fields:  map[string]any{"user": "alice"},
+		},
+		{Stream: types.LogStreamStdout, Level: types.LogLevelDebug, Time: 1700000001500, Message: "unix time"},
+		{Stream: types.LogStreamStdout, Level: types.LogLevelInfo, Time: at.UnixMilli(), Message: "{not json"},
+	}, entries)
+
+	stderr := shared.ParseLogEntries([]byte("panic: boom\n"), types.LogStreamStderr, at)
+	require.Equal(t, types.LogLevelError, stderr[0].Level)
+	require.Equal(t, types.LogStreamStderr, stderr[0].Stream)
+
+	require.Equal(t, 1, len(types.FilterLogEntries(entries, types.LogLevelWarn)))
+}
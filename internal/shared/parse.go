@@ -5,17 +5,24 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/hnimtadd/run/internal/frame"
 )
 
 var magicLen = 2 // len of uint16
 
-// ParseStdout returns logs, body, status, err, body is bytes of pb.HTTPResponse
+// ParseStdout returns logs, body, status, err, body is bytes of pb.HTTPResponse.
+// Output of guests built against the framed protocol is parsed with frame.Parse,
+// others are expected to end with the response followed by its uint16 length.
 func ParseStdout(r io.Reader) (logs []byte, body []byte, err error) {
 	var bufBytes []byte
 	bufBytes, err = io.ReadAll(r)
 	if err != nil {
 		return
 	}
+	if logs, body, err := frame.Parse(bufBytes); err == nil {
+		return logs, body, nil
+	}
 
 	outLen := len(bufBytes)
 	if outLen < magicLen {
@@ -0,0 +1,68 @@
+package shared_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/hnimtadd/run/internal/frame"
+	"github.com/hnimtadd/run/internal/shared"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStdout_Framed(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 1<<17) // larger than the legacy uint16 trailer could describe
+	out := new(bytes.Buffer)
+	out.WriteString("before\n")
+	require.Nil(t, frame.Write(out, frame.Log, []byte("framed\n")))
+	require.Nil(t, frame.Write(out, frame.Response, body))
+	out.WriteString("after\n")
+
+	logs, rsp, err := shared.ParseStdout(out)
+	require.Nil(t, err)
+	require.Equal(t, body, rsp)
+	require.Equal(t, "before\nframed\nafter\n", string(logs))
+}
+
+func TestParseStdout_Legacy(t *testing.T) {
+	body := []byte("response")
+	out := new(bytes.Buffer)
+	out.WriteString("log\n")
+	out.Write(body)
+	trailer := make([]byte, 2)
+	binary.LittleEndian.PutUint16(trailer, uint16(len(body)))
+	out.Write(trailer)
+
+	logs, rsp, err := shared.ParseStdout(out)
+	require.Nil(t, err)
+	require.Equal(t, body, rsp)
+	require.Equal(t, "log\n", string(logs))
+}
+
+func TestParseStdout_MagicInLogs(t *testing.T) {
+	body := []byte("response")
+	magic := string(frame.Magic[:])
+
+	// legacy output whose logs happen to contain the magic bytes.
+	out := new(bytes.Buffer)
+	out.WriteString("log " + magic + "\n")
+	out.Write(body)
+	trailer := make([]byte, 2)
+	binary.LittleEndian.PutUint16(trailer, uint16(len(body)))
+	out.Write(trailer)
+	require.False(t, frame.IsFramed(out.Bytes()))
+	logs, rsp, err := shared.ParseStdout(out)
+	require.Nil(t, err)
+	require.Equal(t, body, rsp)
+	require.Equal(t, "log "+magic+"\n", string(logs))
+
+	// framed output with the magic bytes written outside of frames.
+	out.Reset()
+	out.WriteString("log " + magic + "\n")
+	require.Nil(t, frame.Write(out, frame.Response, body))
+	require.True(t, frame.IsFramed(out.Bytes()))
+	logs, rsp, err = shared.ParseStdout(out)
+	require.Nil(t, err)
+	require.Equal(t, body, rsp)
+	require.Equal(t, "log "+magic+"\n", string(logs))
+}
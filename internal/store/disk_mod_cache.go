@@ -0,0 +1,291 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+)
+
+// deploymentsFile lists the deployments of a cached module, one per line, so that they survive restarts.
+const deploymentsFile = ".deployments"
+
+// DiskModCacher caches compiled modules on disk so that they survive restarts of the ingress. A module is kept
+// under <dir>/<wazero version>/<blob hash> and shared by every deployment of the blob, the least recently used
+// modules are removed once the cache grows beyond its max size.
+type DiskModCacher struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	size        int64
+	lru         *list.List               // of *diskModEntry, most recently used first
+	entries     map[string]*list.Element // by blob hash
+	deployments map[uuid.UUID]string     // map deploymentID with the blob hash of its module
+}
+
+type diskModEntry struct {
+	hash        string
+	dir         string
+	size        int64
+	cache       wazero.CompilationCache // opened on first use
+	deployments map[uuid.UUID]struct{}
+}
+
+// NewDiskModCacher opens the cache at dir, modules cached by a previous run with the same wazero version are kept.
+func NewDiskModCacher(dir string, maxSize int64) (*DiskModCacher, error) {
+	m := &DiskModCacher{
+		dir:         filepath.Join(dir, wazeroVersion()),
+		maxSize:     maxSize,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		deployments: make(map[uuid.UUID]string),
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.evict(nil)
+	m.mu.Unlock()
+	return m, nil
+}
+
+// load indexes modules cached by a previous run, the modification time of their directory is their last use.
+func (m *DiskModCacher) load() error {
+	dirEntries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+	type loaded struct {
+		entry  *diskModEntry
+		usedAt time.Time
+	}
+	var modules []loaded
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		entry := &diskModEntry{
+			hash:        dirEntry.Name(),
+			dir:         filepath.Join(m.dir, dirEntry.Name()),
+			deployments: make(map[uuid.UUID]struct{}),
+		}
+		if entry.size, err = dirSize(entry.dir); err != nil {
+			return err
+		}
+		if b, err := os.ReadFile(filepath.Join(entry.dir, deploymentsFile)); err == nil {
+			for _, line := range strings.Fields(string(b)) {
+				if deploymentID, err := uuid.Parse(line); err == nil {
+					entry.deployments[deploymentID] = struct{}{}
+				}
+			}
+		}
+		modules = append(modules, loaded{entry: entry, usedAt: info.ModTime()})
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].usedAt.After(modules[j].usedAt) })
+	for _, module := range modules {
+		m.entries[module.entry.hash] = m.lru.PushBack(module.entry)
+		m.size += module.entry.size
+		for deploymentID := range module.entry.deployments {
+			m.deployments[deploymentID] = module.entry.hash
+		}
+	}
+	return nil
+}
+
+// Get returns the compilation cache of the module of the deployment, which is created empty if missing. Modules
+// compiled with it are written to disk.
+func (m *DiskModCacher) Get(key ModKey) (wazero.CompilationCache, error) {
+	if key.Hash == "" {
+		return nil, errors.New("mod cacher: cannot get cache, hash of the blob is missing")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entry *diskModEntry
+	if elem, ok := m.entries[key.Hash]; ok {
+		entry = elem.Value.(*diskModEntry)
+		m.lru.MoveToFront(elem)
+		now := time.Now()
+		_ = os.Chtimes(entry.dir, now, now)
+	} else {
+		entry = &diskModEntry{
+			hash:        key.Hash,
+			dir:         filepath.Join(m.dir, key.Hash),
+			deployments: make(map[uuid.UUID]struct{}),
+		}
+		if err := os.MkdirAll(entry.dir, 0o755); err != nil {
+			return nil, errors.Newf("mod cacher: cannot create cache directory, %v", err)
+		}
+		m.entries[key.Hash] = m.lru.PushFront(entry)
+	}
+
+	if _, ok := entry.deployments[key.DeploymentID]; !ok {
+		entry.deployments[key.DeploymentID] = struct{}{}
+		m.deployments[key.DeploymentID] = key.Hash
+		if err := entry.writeDeployments(); err != nil {
+			return nil, errors.Newf("mod cacher: cannot write deployments of cache, %v", err)
+		}
+	}
+
+	if entry.cache == nil {
+		cache, err := wazero.NewCompilationCacheWithDir(entry.dir)
+		if err != nil {
+			return nil, errors.Newf("mod cacher: cannot open cache directory, %v", err)
+		}
+		entry.cache = cache
+	}
+	return entry.cache, nil
+}
+
+// Put accounts for the module compiled with the cache returned by Get, evicting least recently used modules if
+// the cache grew beyond its max size.
+func (m *DiskModCacher) Put(key ModKey, _ wazero.CompilationCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.entries[key.Hash]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*diskModEntry)
+	size, err := dirSize(entry.dir)
+	if err != nil {
+		return errors.Newf("mod cacher: cannot measure cache directory, %v", err)
+	}
+	m.size += size - entry.size
+	entry.size = size
+	m.evict(entry)
+	return nil
+}
+
+// Delete forgets the deployment, its module is removed once no deployment uses it.
+func (m *DiskModCacher) Delete(deploymentID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, ok := m.deployments[deploymentID]
+	if !ok {
+		return errors.Newf("mod cacher: cannot delete cache, %w", errors.ErrDeploymentNotExisted)
+	}
+	delete(m.deployments, deploymentID)
+
+	elem, ok := m.entries[hash]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*diskModEntry)
+	delete(entry.deployments, deploymentID)
+	if len(entry.deployments) > 0 {
+		return entry.writeDeployments()
+	}
+	if entry.cache != nil {
+		_ = entry.cache.Close(context.Background())
+	}
+	return m.remove(elem)
+}
+
+func (m *DiskModCacher) Deployments() []uuid.UUID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deployments := make([]uuid.UUID, 0, len(m.deployments))
+	for deploymentID := range m.deployments {
+		deployments = append(deployments, deploymentID)
+	}
+	return deployments
+}
+
+func (m *DiskModCacher) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Size returns the size of cached modules in bytes.
+func (m *DiskModCacher) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
+
+// evict removes least recently used modules, except keep, until the cache fits its max size. Their compilation
+// caches are left open since runtimes could still run the modules compiled with them.
+func (m *DiskModCacher) evict(keep *diskModEntry) {
+	for elem := m.lru.Back(); elem != nil && m.size > m.maxSize; {
+		prev := elem.Prev()
+		if entry := elem.Value.(*diskModEntry); entry != keep {
+			if err := m.remove(elem); err != nil {
+				slog.Error("cannot evict compiled module", "hash", entry.hash, "msg", err.Error())
+			}
+		}
+		elem = prev
+	}
+}
+
+func (m *DiskModCacher) remove(elem *list.Element) error {
+	entry := elem.Value.(*diskModEntry)
+	m.lru.Remove(elem)
+	delete(m.entries, entry.hash)
+	m.size -= entry.size
+	for deploymentID := range entry.deployments {
+		delete(m.deployments, deploymentID)
+	}
+	return os.RemoveAll(entry.dir)
+}
+
+func (e *diskModEntry) writeDeployments() error {
+	var b strings.Builder
+	for deploymentID := range e.deployments {
+		b.WriteString(deploymentID.String())
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(filepath.Join(e.dir, deploymentsFile), []byte(b.String()), 0o644)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// wazeroVersion returns the version of wazero the binary is built with, modules compiled by other versions are not
+// reused.
+func wazeroVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/tetratelabs/wazero" {
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratelabs/wazero"
+)
+
+// startModule is the binary of (module (func (export "_start"))).
+var startModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export section
+	0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b, // code section
+}
+
+// compile compiles the module with the cache of key the way runtimes do.
+func compile(t *testing.T, cacher store.ModCacher, key store.ModKey) {
+	ctx := context.Background()
+	cache, err := cacher.Get(key)
+	require.Nil(t, err)
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCompilationCache(cache))
+	_, err = r.CompileModule(ctx, startModule)
+	require.Nil(t, err)
+	require.Nil(t, r.Close(ctx))
+	require.Nil(t, cacher.Put(key, cache))
+}
+
+func TestDiskModCacher_Persist(t *testing.T) {
+	dir := t.TempDir()
+	cacher, err := store.NewDiskModCacher(dir, 1<<30)
+	require.Nil(t, err)
+
+	first := store.ModKey{DeploymentID: uuid.New(), Hash: "hash"}
+	second := store.ModKey{DeploymentID: uuid.New(), Hash: "hash"}
+	compile(t, cacher, first)
+	compile(t, cacher, second)
+	require.Equal(t, 1, cacher.Len())
+
+	// the module is kept when the cache is opened again.
+	cacher, err = store.NewDiskModCacher(dir, 1<<30)
+	require.Nil(t, err)
+	require.Equal(t, 1, cacher.Len())
+	require.ElementsMatch(t, []uuid.UUID{first.DeploymentID, second.DeploymentID}, cacher.Deployments())
+	require.NotZero(t, cacher.Size())
+
+	// the module is removed along with the last deployment using it.
+	require.Nil(t, cacher.Delete(first.DeploymentID))
+	require.Equal(t, 1, cacher.Len())
+	require.Nil(t, cacher.Delete(second.DeploymentID))
+	require.Equal(t, 0, cacher.Len())
+	require.Zero(t, cacher.Size())
+	require.ErrorIs(t, cacher.Delete(second.DeploymentID), errors.ErrDeploymentNotExisted)
+
+	cacher, err = store.NewDiskModCacher(dir, 1<<30)
+	require.Nil(t, err)
+	require.Equal(t, 0, cacher.Len())
+}
+
+func TestDiskModCacher_Evict(t *testing.T) {
+	dir := t.TempDir()
+	cacher, err := store.NewDiskModCacher(dir, 1)
+	require.Nil(t, err)
+
+	first := store.ModKey{DeploymentID: uuid.New(), Hash: "first"}
+	second := store.ModKey{DeploymentID: uuid.New(), Hash: "second"}
+	compile(t, cacher, first)
+	compile(t, cacher, second)
+
+	// only the most recently used module is kept since both do not fit.
+	require.Equal(t, 1, cacher.Len())
+	require.Equal(t, []uuid.UUID{second.DeploymentID}, cacher.Deployments())
+	require.ErrorIs(t, cacher.Delete(first.DeploymentID), errors.ErrDeploymentNotExisted)
+
+	_, err = cacher.Get(store.ModKey{DeploymentID: uuid.New()})
+	require.NotNil(t, err)
+}
+
+func TestSweepModCache(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("modcache", "go", nil)
+	require.Nil(t, err)
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	active, _ := types.NewDeployment(endpoint)
+	active.Status = types.DeploymentStatusActive
+	require.Nil(t, memoryStore.CreateDeployment(active))
+	failed, _ := types.NewDeployment(endpoint)
+	failed.Status = types.DeploymentStatusFailed
+	require.Nil(t, memoryStore.CreateDeployment(failed))
+	deleted := uuid.New()
+
+	cacher, err := store.NewDiskModCacher(t.TempDir(), 1<<30)
+	require.Nil(t, err)
+	for _, deploymentID := range []uuid.UUID{active.ID, failed.ID, deleted} {
+		compile(t, cacher, store.ModKey{DeploymentID: deploymentID, Hash: deploymentID.String()})
+	}
+	require.Equal(t, 3, cacher.Len())
+
+	store.SweepModCache(memoryStore, cacher)
+	require.Equal(t, []uuid.UUID{active.ID}, cacher.Deployments())
+	require.Equal(t, 1, cacher.Len())
+}
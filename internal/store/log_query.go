@@ -0,0 +1,107 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
+)
+
+// LogOrder is the order of queried logs by creation time, ties are broken by request id.
+type LogOrder string
+
+const (
+	LogOrderDesc LogOrder = "desc"
+	LogOrderAsc  LogOrder = "asc"
+)
+
+// ParseLogOrder parses given order, the empty order is the default descending order.
+func ParseLogOrder(raw string) (LogOrder, error) {
+	switch LogOrder(strings.ToLower(raw)) {
+	case "", LogOrderDesc:
+		return LogOrderDesc, nil
+	case LogOrderAsc:
+		return LogOrderAsc, nil
+	}
+	return "", errors.ErrInvalidOrder
+}
+
+// logCursor is the position of the last log of a page, the next page starts right after it.
+type logCursor struct {
+	createdAt int64
+	requestID uuid.UUID
+}
+
+func encodeLogCursor(log *types.RequestLog) string {
+	raw := fmt.Sprintf("%d:%s", log.CreatedAt, log.RequestID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeLogCursor(cursor string) (*logCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.ErrInvalidCursor
+	}
+	createdAt, requestID, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.ErrInvalidCursor
+	}
+	c := new(logCursor)
+	if c.createdAt, err = strconv.ParseInt(createdAt, 10, 64); err != nil {
+		return nil, errors.ErrInvalidCursor
+	}
+	if c.requestID, err = uuid.Parse(requestID); err != nil {
+		return nil, errors.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// after reports whether the log comes after the cursor in given order.
+func (c *logCursor) after(log *types.RequestLog, order LogOrder) bool {
+	cmp := compareLogs(log, c.createdAt, c.requestID)
+	if order == LogOrderAsc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func compareLogs(log *types.RequestLog, createdAt int64, requestID uuid.UUID) int {
+	switch {
+	case log.CreatedAt < createdAt:
+		return -1
+	case log.CreatedAt > createdAt:
+		return 1
+	}
+	return strings.Compare(string(log.RequestID[:]), string(requestID[:]))
+}
+
+// normalize returns a copy of the params with the defaults applied.
+func (p LogQueryParams) normalize() (LogQueryParams, *logCursor, error) {
+	if p.Order == "" {
+		p.Order = LogOrderDesc
+	}
+	if p.Limit <= 0 {
+		p.Limit = settings.DefaultLogPageSize
+	}
+	if p.Cursor == "" {
+		return p, nil, nil
+	}
+	cursor, err := decodeLogCursor(p.Cursor)
+	return p, cursor, err
+}
+
+// newLogPage cuts the logs, sorted in order and fetched with one more than limit, into a page.
+func newLogPage(logs []*types.RequestLog, limit int) *LogPage {
+	page := &LogPage{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		page.NextCursor = encodeLogCursor(page.Logs[limit-1])
+	}
+	return page
+}
@@ -1,6 +1,9 @@
 package store
 
 import (
+	"context"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,9 +14,10 @@ import (
 )
 
 var (
-	_ LogStore  = &MemoryStore{}
-	_ Store     = &MemoryStore{}
-	_ BlobStore = &MemoryStore{}
+	_ LogStore    = &MemoryStore{}
+	_ Store       = &MemoryStore{}
+	_ BlobStore   = &MemoryStore{}
+	_ MetricStore = &MemoryStore{}
 )
 
 type MemoryStore struct {
@@ -23,6 +27,9 @@ type MemoryStore struct {
 	blobs       map[uuid.UUID]*types.BlobMetadata
 	logs        map[uuid.UUID]map[uuid.UUID]*types.RequestLog // map deploymentID with request_id and request_log.go
 	blobObjects map[uuid.UUID][]byte
+	metrics     map[uuid.UUID][]types.RequestMetric               // map endpointID with its request metrics
+	events      map[uuid.UUID][]*types.Event                      // map endpointID with its events, oldest first
+	tails       map[uuid.UUID]map[chan *types.RequestLog]struct{} // map deploymentID with channels of its tails
 }
 
 // AddDeploymentBlob implements BlobStore.
@@ -91,40 +98,66 @@ func (m *MemoryStore) UpdateActiveDeploymentOfEndpoint(endpointID string, deploy
 	}
 
 	m.mu.Lock()
-	_, ok := m.endpoints[endpointUID]
-	m.mu.Unlock()
+	defer m.mu.Unlock()
+	curr, ok := m.endpoints[endpointUID]
 	if !ok {
 		return errors.ErrDocumentNotFound
 	}
-	m.endpoints[endpointUID].ActiveDeploymentID = deploymentUID
+	// endpoints are handed out by pointer, so the updated one replaces rather than mutates the stored one.
+	endpoint := *curr
+	endpoint.ActiveDeploymentID = deploymentUID
+	m.endpoints[endpointUID] = &endpoint
 	return nil
 }
 
 func (m *MemoryStore) AppendLog(log *types.RequestLog) error {
+	// runtimes of a deployment append side by side, and its logs could be purged meanwhile, so the whole append is
+	// done under the lock.
 	m.mu.Lock()
-	_, ok := m.logs[log.DeploymentID]
-	m.mu.Unlock()
-
-	if !ok {
-		m.mu.RLock()
+	defer m.mu.Unlock()
+	if m.logs[log.DeploymentID] == nil {
 		m.logs[log.DeploymentID] = make(map[uuid.UUID]*types.RequestLog)
-		m.mu.RUnlock()
 	}
-
-	m.mu.Lock()
-	_, ok = m.logs[log.DeploymentID][log.RequestID]
-	m.mu.Unlock()
-
-	if ok {
+	if _, ok := m.logs[log.DeploymentID][log.RequestID]; ok {
 		return errors.ErrDocumentDuplicated
 	}
-
-	m.mu.RLock()
 	m.logs[log.DeploymentID][log.RequestID] = log
-	m.mu.RUnlock()
+
+	for tail := range m.tails[log.DeploymentID] {
+		select {
+		case tail <- log:
+		default:
+			// the tail is too slow to keep up, the log is dropped for it rather than blocking the runtime.
+		}
+	}
 	return nil
 }
 
+// TailLogOfDeployment implements LogStore.
+func (m *MemoryStore) TailLogOfDeployment(ctx context.Context, deploymentID string) (<-chan *types.RequestLog, error) {
+	deploymentUUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	tail := make(chan *types.RequestLog, 64)
+	m.mu.Lock()
+	if m.tails[deploymentUUID] == nil {
+		m.tails[deploymentUUID] = make(map[chan *types.RequestLog]struct{})
+	}
+	m.tails[deploymentUUID][tail] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.tails[deploymentUUID], tail)
+		close(tail)
+	}()
+	return tail, nil
+}
+
 func (m *MemoryStore) GetLogOfDeployment(deploymentID string) ([]*types.RequestLog, error) {
 	deploymentUUID, err := uuid.Parse(deploymentID)
 	if err != nil {
@@ -145,6 +178,150 @@ func (m *MemoryStore) GetLogOfDeployment(deploymentID string) ([]*types.RequestL
 	return eventLogs, nil
 }
 
+// QueryLogOfDeployment implements LogStore.
+func (m *MemoryStore) QueryLogOfDeployment(deploymentID string, params LogQueryParams) (*LogPage, error) {
+	deploymentUUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	params, cursor, err := params.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	search := strings.ToLower(params.Search)
+	logs := make([]*types.RequestLog, 0)
+	m.mu.Lock()
+	for _, log := range m.logs[deploymentUUID] {
+		switch {
+		case params.Since > 0 && log.CreatedAt < params.Since:
+		case params.Until > 0 && log.CreatedAt >= params.Until:
+		case search != "" && !containsText(log.Contents, search):
+		case cursor != nil && !cursor.after(log, params.Order):
+		default:
+			logs = append(logs, log)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(logs, func(i, j int) bool {
+		cmp := compareLogs(logs[i], logs[j].CreatedAt, logs[j].RequestID)
+		if params.Order == LogOrderAsc {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+	if len(logs) > params.Limit+1 {
+		logs = logs[:params.Limit+1]
+	}
+	return newLogPage(logs, params.Limit), nil
+}
+
+// ApplyRetention implements LogStore.
+func (m *MemoryStore) ApplyRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error) {
+	return m.retain(endpointID, deploymentIDs, policy, true)
+}
+
+// EnforceRetention implements LogStore. The memory store has no ttl monitor, so expired logs are removed as well.
+func (m *MemoryStore) EnforceRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error) {
+	return m.retain(endpointID, deploymentIDs, policy, false)
+}
+
+// retain applies the policy to the logs of the endpoint, the expiry of logs which carried their endpoint is updated
+// only if restamp is set.
+func (m *MemoryStore) retain(endpointID string, deploymentIDs []string, policy types.RetentionPolicy, restamp bool) (int64, error) {
+	endpointUUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return 0, err
+	}
+	deployments := make(map[uuid.UUID]bool, len(deploymentIDs))
+	for _, deploymentID := range deploymentIDs {
+		deploymentUUID, err := uuid.Parse(deploymentID)
+		if err != nil {
+			return 0, err
+		}
+		deployments[deploymentUUID] = true
+	}
+	policy = policy.WithDefaults()
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	var kept []*types.RequestLog
+	for _, entry := range m.logs {
+		for requestID, log := range entry {
+			switch {
+			case log.EndpointID == uuid.Nil && deployments[log.DeploymentID]:
+				log.EndpointID = endpointUUID
+				log.ExpireAt = policy.ExpireAt(time.Unix(log.CreatedAt, 0))
+			case log.EndpointID != endpointUUID:
+				continue
+			case restamp:
+				log.ExpireAt = policy.ExpireAt(time.Unix(log.CreatedAt, 0))
+			}
+			if !log.ExpireAt.IsZero() && !log.ExpireAt.After(now) {
+				delete(entry, requestID)
+				deleted++
+				continue
+			}
+			kept = append(kept, log)
+		}
+	}
+	if policy.MaxRequests == 0 || len(kept) <= policy.MaxRequests {
+		return deleted, nil
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		return compareLogs(kept[i], kept[j].CreatedAt, kept[j].RequestID) > 0
+	})
+	for _, log := range kept[policy.MaxRequests:] {
+		delete(m.logs[log.DeploymentID], log.RequestID)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// PurgeLogOfDeployment implements LogStore.
+func (m *MemoryStore) PurgeLogOfDeployment(deploymentID string) (int64, error) {
+	deploymentUUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := int64(len(m.logs[deploymentUUID]))
+	delete(m.logs, deploymentUUID)
+	return deleted, nil
+}
+
+// SweepExpiredLogs removes logs whose expiry passed, it is the counterpart of the ttl index of the mongo store.
+func (m *MemoryStore) SweepExpiredLogs() int64 {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for _, entry := range m.logs {
+		for requestID, log := range entry {
+			if !log.ExpireAt.IsZero() && !log.ExpireAt.After(now) {
+				delete(entry, requestID)
+				deleted++
+			}
+		}
+	}
+	return deleted
+}
+
+// containsText reports whether one of the contents contains the lower cased text, case-insensitively.
+func containsText(contents []string, text string) bool {
+	for _, content := range contents {
+		if strings.Contains(strings.ToLower(content), text) {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *MemoryStore) GetLogsOfRequest(deploymentID string, requestID string) (*types.RequestLog, error) {
 	deploymentUUID, err := uuid.Parse(deploymentID)
 	if err != nil {
@@ -190,10 +367,14 @@ func (m *MemoryStore) GetLogByRequestID(requestID string) (*types.RequestLog, er
 func (m *MemoryStore) CreateEndpoint(endpoint *types.Endpoint) error {
 	m.mu.Lock()
 	_, existed := m.endpoints[endpoint.ID]
+	slugExisted := endpoint.Slug != "" && m.endpointBySlug(endpoint.Slug) != nil
 	m.mu.Unlock()
 	if existed {
 		return errors.ErrEndpointExisted
 	}
+	if slugExisted {
+		return errors.ErrSlugExisted
+	}
 	now := time.Now()
 	endpoint.CreatedAt = now.Unix()
 	m.mu.RLock()
@@ -208,15 +389,32 @@ func (m *MemoryStore) UpdateEndpoint(endpointID string, params UpdateEndpointPar
 		return err
 	}
 	m.mu.Lock()
+	defer m.mu.Unlock()
 	curr, ok := m.endpoints[endpointUUID]
-	m.mu.Unlock()
 	if !ok {
 		return errors.ErrEndpointNotExisted
 	}
-	curr.Environment = params.Environment
-	m.mu.RLock()
-	m.endpoints[endpointUUID] = curr
-	m.mu.RUnlock()
+	// endpoints are handed out by pointer, so the updated one replaces rather than mutates the stored one.
+	endpoint := *curr
+	if params.Environment != nil {
+		endpoint.Environment = params.Environment
+	}
+	if params.Retention != nil {
+		endpoint.Retention = *params.Retention
+	}
+	if params.Hosts != nil {
+		endpoint.Hosts = params.Hosts
+	}
+	if params.Traffic != nil {
+		endpoint.Traffic = params.Traffic
+	}
+	if params.Health != nil {
+		endpoint.Health = *params.Health
+	}
+	if params.History != nil {
+		endpoint.History = *params.History
+	}
+	m.endpoints[endpointUUID] = &endpoint
 	return nil
 }
 
@@ -233,6 +431,26 @@ func (m *MemoryStore) GetEndpointByID(endpointID string) (*types.Endpoint, error
 	return endpoint, nil
 }
 
+// GetEndpointBySlug implements Store.
+func (m *MemoryStore) GetEndpointBySlug(slug string) (*types.Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	endpoint := m.endpointBySlug(slug)
+	if endpoint == nil {
+		return nil, errors.ErrEndpointNotExisted
+	}
+	return endpoint, nil
+}
+
+func (m *MemoryStore) endpointBySlug(slug string) *types.Endpoint {
+	for _, endpoint := range m.endpoints {
+		if endpoint.Slug == slug {
+			return endpoint
+		}
+	}
+	return nil
+}
+
 func (m *MemoryStore) GetEndpoints() ([]*types.Endpoint, error) {
 	var res []*types.Endpoint
 	m.mu.Lock()
@@ -280,6 +498,38 @@ func (m *MemoryStore) CreateDeployment(deploy *types.Deployment) error {
 	return nil
 }
 
+func (m *MemoryStore) UpdateDeployment(deploymentID string, params UpdateDeploymentParams) error {
+	uid, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, existed := m.deploys[uid]
+	if !existed {
+		return errors.ErrDeploymentNotExisted
+	}
+	// deployments are handed out by pointer, so the updated one replaces rather than mutates the stored one.
+	deployment := *current
+	if params.Status != "" {
+		deployment.Status = params.Status
+	}
+	if params.Hash != "" {
+		deployment.Hash = params.Hash
+	}
+	if params.BuildLog != "" {
+		deployment.BuildLog = params.BuildLog
+	}
+	if params.Error != "" {
+		deployment.Error = params.Error
+	}
+	if params.ActivatedAt != 0 {
+		deployment.ActivatedAt = params.ActivatedAt
+	}
+	m.deploys[uid] = &deployment
+	return nil
+}
+
 func (m *MemoryStore) GetDeployment(deploymentID string) (*types.Deployment, error) {
 	deploymentUUID, err := uuid.Parse(deploymentID)
 	if err != nil {
@@ -332,6 +582,104 @@ func (m *MemoryStore) GetBlobMetadataByDeploymentID(deploymentID string) (*types
 	return blobMetadata, nil
 }
 
+// DeleteBlobMetadata implements Store.
+func (m *MemoryStore) DeleteBlobMetadata(deploymentID string) error {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.blobs, deploymentUID)
+	m.mu.Unlock()
+	return nil
+}
+
+// AddEvent implements Store.
+func (m *MemoryStore) AddEvent(event *types.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[event.EndpointID] = append(m.events[event.EndpointID], event)
+	return nil
+}
+
+// GetEventsOfEndpoint implements Store.
+func (m *MemoryStore) GetEventsOfEndpoint(endpointID string) ([]*types.Event, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.events[endpointUID]
+	res := make([]*types.Event, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		res = append(res, events[i])
+	}
+	return res, nil
+}
+
+// AddEndpointMetric implements MetricStore.
+func (m *MemoryStore) AddEndpointMetric(endpointID string, metric types.RequestMetric) error {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return err
+	}
+	metric.EndpointID = endpointUID
+	if metric.CreatedAt == 0 {
+		metric.CreatedAt = time.Now().Unix()
+	}
+	m.mu.Lock()
+	m.metrics[endpointUID] = append(m.metrics[endpointUID], metric)
+	m.mu.Unlock()
+	return nil
+}
+
+// GetMetricByEndpointID implements MetricStore.
+func (m *MemoryStore) GetMetricByEndpointID(endpointID string) (types.RuntimeMetric, error) {
+	metrics, err := m.GetMetricsOfEndpoint(endpointID, RecentMetrics(time.Now()))
+	if err != nil {
+		return types.RuntimeMetric{}, err
+	}
+	return types.NewRuntimeMetric(metrics), nil
+}
+
+// GetMetricsOfEndpoint implements MetricStore.
+func (m *MemoryStore) GetMetricsOfEndpoint(endpointID string, params MetricQueryParams) ([]types.RequestMetric, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	return m.filterMetrics(func(metric types.RequestMetric) bool {
+		return metric.EndpointID == endpointUID
+	}, params), nil
+}
+
+// GetMetricsOfDeployment implements MetricStore.
+func (m *MemoryStore) GetMetricsOfDeployment(deploymentID string, params MetricQueryParams) ([]types.RequestMetric, error) {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	return m.filterMetrics(func(metric types.RequestMetric) bool {
+		return metric.DeploymentID == deploymentUID
+	}, params), nil
+}
+
+func (m *MemoryStore) filterMetrics(match func(types.RequestMetric) bool, params MetricQueryParams) []types.RequestMetric {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]types.RequestMetric, 0)
+	for _, metrics := range m.metrics {
+		for _, metric := range metrics {
+			if match(metric) && metric.CreatedAt >= params.From && metric.CreatedAt < params.To {
+				res = append(res, metric)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt < res[j].CreatedAt })
+	return res
+}
+
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		deploys:     make(map[uuid.UUID]*types.Deployment),
@@ -339,5 +687,8 @@ func NewMemoryStore() *MemoryStore {
 		logs:        make(map[uuid.UUID]map[uuid.UUID]*types.RequestLog),
 		blobs:       make(map[uuid.UUID]*types.BlobMetadata),
 		blobObjects: make(map[uuid.UUID][]byte),
+		metrics:     make(map[uuid.UUID][]types.RequestMetric),
+		events:      make(map[uuid.UUID][]*types.Event),
+		tails:       make(map[uuid.UUID]map[chan *types.RequestLog]struct{}),
 	}
 }
@@ -0,0 +1,245 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_TailLogOfDeployment(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	deploymentID := uuid.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logCh, err := memoryStore.TailLogOfDeployment(ctx, deploymentID.String())
+	require.Nil(t, err)
+
+	other := types.NewRequestLog(uuid.New(), uuid.New(), []string{"other deployment"})
+	require.Nil(t, memoryStore.AppendLog(other))
+	log := types.NewRequestLog(deploymentID, uuid.New(), []string{"tailed"})
+	require.Nil(t, memoryStore.AppendLog(log))
+
+	select {
+	case got := <-logCh:
+		require.Equal(t, log.RequestID, got.RequestID)
+	case <-time.After(time.Second):
+		t.Fatal("expect tailed log")
+	}
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-logCh
+		return !ok
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestMemoryStore_AppendLogConcurrently(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	deploymentID := uuid.New()
+
+	// runtimes of a deployment append side by side while its logs are purged.
+	done := make(chan struct{})
+	purged := make(chan struct{})
+	go func() {
+		defer close(purged)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_, err := memoryStore.PurgeLogOfDeployment(deploymentID.String())
+			require.Nil(t, err)
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				require.Nil(t, memoryStore.AppendLog(types.NewRequestLog(deploymentID, uuid.New(), []string{"log"})))
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-purged
+}
+
+func TestMemoryStore_QueryLogOfDeployment(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	deploymentID := uuid.New()
+
+	var logs []*types.RequestLog
+	for i := 0; i < 5; i++ {
+		log := types.NewRequestLog(deploymentID, uuid.New(), []string{fmt.Sprintf("line %d", i)})
+		log.CreatedAt = int64(100 + i/2) // two logs share each second
+		require.Nil(t, memoryStore.AppendLog(log))
+		logs = append(logs, log)
+	}
+
+	// walk all pages in ascending order
+	var got []string
+	params := store.LogQueryParams{Order: store.LogOrderAsc, Limit: 2}
+	for {
+		page, err := memoryStore.QueryLogOfDeployment(deploymentID.String(), params)
+		require.Nil(t, err)
+		require.LessOrEqual(t, len(page.Logs), 2)
+		for _, log := range page.Logs {
+			got = append(got, log.Contents[0])
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+	require.Equal(t, 5, len(got))
+	require.ElementsMatch(t, []string{"line 0", "line 1", "line 2", "line 3", "line 4"}, got)
+	require.Equal(t, "line 4", got[4])
+
+	page, err := memoryStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Since: 101, Until: 102})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(page.Logs))
+	require.Equal(t, "", page.NextCursor)
+
+	page, err = memoryStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Search: "LINE 3"})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(page.Logs))
+	require.Equal(t, logs[3].RequestID, page.Logs[0].RequestID)
+
+	page, err = memoryStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Limit: 1})
+	require.Nil(t, err)
+	require.Equal(t, logs[4].RequestID, page.Logs[0].RequestID, "newest first by default")
+
+	_, err = memoryStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Cursor: "invalid"})
+	require.ErrorIs(t, err, errors.ErrInvalidCursor)
+}
+
+func TestMemoryStore_ApplyRetention(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpointID := uuid.New()
+	deploymentID := uuid.New()
+
+	now := time.Now().Unix()
+	for i := 0; i < 4; i++ {
+		log := types.NewRequestLog(deploymentID, uuid.New(), []string{fmt.Sprintf("line %d", i)})
+		log.EndpointID = endpointID
+		log.CreatedAt = now - int64(3-i)*3600 // one log per hour, the latest created now
+		require.Nil(t, memoryStore.AppendLog(log))
+	}
+
+	// the oldest log is older than 150 minutes, the request count then keeps the latest two of the remaining three.
+	deleted, err := memoryStore.ApplyRetention(endpointID.String(), nil, types.RetentionPolicy{MaxAge: 150 * 60, MaxRequests: 2})
+	require.Nil(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	logs, err := memoryStore.GetLogOfDeployment(deploymentID.String())
+	require.Nil(t, err)
+	var contents []string
+	for _, log := range logs {
+		contents = append(contents, log.Contents[0])
+	}
+	require.ElementsMatch(t, []string{"line 2", "line 3"}, contents)
+
+	deleted, err = memoryStore.PurgeLogOfDeployment(deploymentID.String())
+	require.Nil(t, err)
+	require.Equal(t, int64(2), deleted)
+}
+
+func TestMemoryStore_EnforceRetention(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpointID := uuid.New()
+	deploymentID := uuid.New()
+
+	now := time.Now()
+	appendLog := func(content string, endpointID uuid.UUID, createdAt time.Time, expireAt time.Time) *types.RequestLog {
+		log := types.NewRequestLog(deploymentID, uuid.New(), []string{content})
+		log.EndpointID = endpointID
+		log.CreatedAt = createdAt.Unix()
+		log.ExpireAt = expireAt
+		require.Nil(t, memoryStore.AppendLog(log))
+		return log
+	}
+	// logs appended before logs carried their endpoint have neither endpoint nor expiry.
+	legacy := appendLog("legacy", uuid.Nil, now.Add(-3*time.Hour), time.Time{})
+	stamped := appendLog("stamped", endpointID, now.Add(-2*time.Hour), now.Add(time.Hour))
+	appendLog("latest", endpointID, now.Add(-time.Hour), now.Add(time.Hour))
+
+	// the sweeper keeps the expiry of logs, besides the legacy ones which are attributed to the endpoint.
+	policy := types.RetentionPolicy{MaxAge: 60 * 60, MaxRequests: 2}
+	deleted, err := memoryStore.EnforceRetention(endpointID.String(), []string{deploymentID.String()}, policy)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), deleted)
+	_, err = memoryStore.GetLogByRequestID(legacy.RequestID.String())
+	require.ErrorIs(t, err, errors.ErrDocumentNotFound)
+	got, err := memoryStore.GetLogByRequestID(stamped.RequestID.String())
+	require.Nil(t, err)
+	require.Equal(t, now.Add(time.Hour), got.ExpireAt)
+
+	// logs are kept whatever their age by a policy which bounds the request count only.
+	policy = types.RetentionPolicy{MaxAge: types.KeepByCount, MaxRequests: 1}
+	require.Nil(t, policy.Validate())
+	deleted, err = memoryStore.ApplyRetention(endpointID.String(), nil, policy)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), deleted)
+	logs, err := memoryStore.GetLogOfDeployment(deploymentID.String())
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, "latest", logs[0].Contents[0])
+	require.True(t, logs[0].ExpireAt.IsZero())
+
+	require.NotNil(t, types.RetentionPolicy{MaxAge: types.KeepByCount}.Validate())
+	require.NotNil(t, types.RetentionPolicy{MaxAge: -2, MaxRequests: 1}.Validate())
+}
+
+func TestMemoryStore_SweepExpiredLogs(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	deploymentID := uuid.New()
+
+	expired := types.NewRequestLog(deploymentID, uuid.New(), []string{"expired"})
+	expired.ExpireAt = time.Now().Add(-time.Second)
+	require.Nil(t, memoryStore.AppendLog(expired))
+	kept := types.NewRequestLog(deploymentID, uuid.New(), []string{"kept"})
+	require.Nil(t, memoryStore.AppendLog(kept))
+
+	require.Equal(t, int64(1), memoryStore.SweepExpiredLogs())
+	_, err := memoryStore.GetLogByRequestID(kept.RequestID.String())
+	require.Nil(t, err)
+	_, err = memoryStore.GetLogByRequestID(expired.RequestID.String())
+	require.ErrorIs(t, err, errors.ErrDocumentNotFound)
+}
+
+func TestMemoryStore_GetEndpointBySlug(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	endpoint, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	endpoint.Slug = "hello"
+	require.Nil(t, memoryStore.CreateEndpoint(endpoint))
+
+	other, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	other.Slug = "hello"
+	require.ErrorIs(t, memoryStore.CreateEndpoint(other), errors.ErrSlugExisted)
+	// endpoints without slug do not conflict.
+	first, _ := types.NewEndpoint("first", "go", nil)
+	second, _ := types.NewEndpoint("second", "go", nil)
+	require.Nil(t, memoryStore.CreateEndpoint(first))
+	require.Nil(t, memoryStore.CreateEndpoint(second))
+
+	for _, ref := range []string{"hello", endpoint.ID.String()} {
+		got, err := store.GetEndpoint(memoryStore, ref)
+		require.Nil(t, err)
+		require.Equal(t, endpoint.ID, got.ID)
+	}
+	_, err = store.GetEndpoint(memoryStore, "missing")
+	require.ErrorIs(t, err, errors.ErrEndpointNotExisted)
+}
@@ -2,9 +2,12 @@ package store
 
 import (
 	"context"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/types"
 
 	"github.com/google/uuid"
 	"github.com/tetratelabs/wazero"
@@ -12,9 +15,18 @@ import (
 
 // ModCacher cache compiled module
 type ModCacher interface {
-	Put(deploymentID uuid.UUID, modCache wazero.CompilationCache) error
-	Get(deploymentID uuid.UUID) (wazero.CompilationCache, error)
+	Put(key ModKey, modCache wazero.CompilationCache) error
+	Get(key ModKey) (wazero.CompilationCache, error)
 	Delete(deploymentID uuid.UUID) error
+	// Deployments returns deployments which have a cached module.
+	Deployments() []uuid.UUID
+	Len() int
+}
+
+// ModKey identifies the compiled module of a deployment.
+type ModKey struct {
+	DeploymentID uuid.UUID
+	Hash         string // hash of the blob of the deployment
 }
 
 type MemoryModCacher struct {
@@ -22,7 +34,8 @@ type MemoryModCacher struct {
 	cache map[uuid.UUID]wazero.CompilationCache
 }
 
-func (m *MemoryModCacher) Put(deploymentID uuid.UUID, modCache wazero.CompilationCache) error {
+func (m *MemoryModCacher) Put(key ModKey, modCache wazero.CompilationCache) error {
+	deploymentID := key.DeploymentID
 	m.mu.Lock()
 	_, existed := m.cache[deploymentID]
 	m.mu.Unlock()
@@ -35,9 +48,9 @@ func (m *MemoryModCacher) Put(deploymentID uuid.UUID, modCache wazero.Compilatio
 	return nil
 }
 
-func (m *MemoryModCacher) Get(deploymentID uuid.UUID) (wazero.CompilationCache, error) {
+func (m *MemoryModCacher) Get(key ModKey) (wazero.CompilationCache, error) {
 	m.mu.Lock()
-	cache, existed := m.cache[deploymentID]
+	cache, existed := m.cache[key.DeploymentID]
 	m.mu.Unlock()
 	if !existed {
 		return nil, errors.Newf("mod cacher: cannot get cache, %v", errors.ErrDeploymentNotExisted)
@@ -60,8 +73,59 @@ func (m *MemoryModCacher) Delete(deploymentID uuid.UUID) error {
 	return nil
 }
 
+func (m *MemoryModCacher) Deployments() []uuid.UUID {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	deployments := make([]uuid.UUID, 0, len(m.cache))
+	for deploymentID := range m.cache {
+		deployments = append(deployments, deploymentID)
+	}
+	return deployments
+}
+
+func (m *MemoryModCacher) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.cache)
+}
+
 func NewMemoryModCacher() ModCacher {
 	return &MemoryModCacher{
 		cache: make(map[uuid.UUID]wazero.CompilationCache),
 	}
 }
+
+// RunModCacheSweeper removes the cached modules of deployments which were deleted or failed every interval until
+// ctx is done. Deployments are managed by the api server, so the ingress learns about them from the store.
+func RunModCacheSweeper(ctx context.Context, store Store, cacher ModCacher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		SweepModCache(store, cacher)
+	}
+}
+
+// SweepModCache removes the cached modules of deployments which were deleted or failed.
+func SweepModCache(store Store, cacher ModCacher) {
+	for _, deploymentID := range cacher.Deployments() {
+		deployment, err := store.GetDeploymentByID(deploymentID.String())
+		switch {
+		case errors.Is(err, errors.ErrDeploymentNotExisted):
+		case err != nil:
+			slog.Error("cannot get deployment of cached module", "deployment", deploymentID, "msg", err.Error())
+			continue
+		case deployment.Status != types.DeploymentStatusFailed:
+			continue
+		}
+		if err := cacher.Delete(deploymentID); err != nil {
+			slog.Error("cannot remove cached module", "deployment", deploymentID, "msg", err.Error())
+			continue
+		}
+		slog.Info("removed cached module", "deployment", deploymentID)
+	}
+}
@@ -2,12 +2,16 @@ package store
 
 import (
 	"context"
+	"log/slog"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var LogColName = "logs"
@@ -16,9 +20,21 @@ type MongoLogStore struct {
 	LogCol *mongo.Collection
 }
 
+// NewMongoLogStore returns the log store backed by the logs collection, it ensures the ttl index which
+// removes logs once their expire_at passed.
 func NewMongoLogStore(db *mongo.Database) (LogStore, error) {
+	logCol := db.Collection(LogColName)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := logCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expire_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &MongoLogStore{
-		LogCol: db.Collection(LogColName),
+		LogCol: logCol,
 	}, nil
 }
 
@@ -85,3 +101,235 @@ func (m *MongoLogStore) GetLogsOfRequest(deploymentID string, requestID string)
 	err = m.LogCol.FindOne(ctx, filter).Decode(res)
 	return res, err
 }
+
+// TailLogOfDeployment implements LogStore, the collection is polled every settings.LogTailInterval.
+func (m *MongoLogStore) TailLogOfDeployment(ctx context.Context, deploymentID string) (<-chan *types.RequestLog, error) {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	logCh := make(chan *types.RequestLog)
+	go func() {
+		defer close(logCh)
+		ticker := time.NewTicker(settings.LogTailInterval)
+		defer ticker.Stop()
+
+		// created_at has a precision of seconds, logs of the latest second are remembered to not send them twice.
+		since := time.Now().Unix()
+		seen := make(map[uuid.UUID]bool)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			logs, err := m.findLogsSince(ctx, deploymentUID, since)
+			if err != nil {
+				slog.Error("cannot poll logs of deployment", "deployment", deploymentID, "msg", err.Error())
+				continue
+			}
+			for _, log := range logs {
+				if log.CreatedAt > since {
+					since = log.CreatedAt
+					seen = make(map[uuid.UUID]bool)
+				}
+				if seen[log.RequestID] {
+					continue
+				}
+				seen[log.RequestID] = true
+				select {
+				case logCh <- log:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return logCh, nil
+}
+
+func (m *MongoLogStore) findLogsSince(ctx context.Context, deploymentUID uuid.UUID, since int64) ([]*types.RequestLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	filter := bson.M{"deployment_id": deploymentUID, "created_at": bson.M{"$gte": since}}
+	cur, err := m.LogCol.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*types.RequestLog, 0)
+	err = cur.All(ctx, &res)
+	return res, err
+}
+
+// QueryLogOfDeployment implements LogStore.
+func (m *MongoLogStore) QueryLogOfDeployment(deploymentID string, params LogQueryParams) (*LogPage, error) {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	params, cursor, err := params.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	conds := bson.A{bson.M{"deployment_id": deploymentUID}}
+	createdAt := bson.M{}
+	if params.Since > 0 {
+		createdAt["$gte"] = params.Since
+	}
+	if params.Until > 0 {
+		createdAt["$lt"] = params.Until
+	}
+	if len(createdAt) > 0 {
+		conds = append(conds, bson.M{"created_at": createdAt})
+	}
+	if params.Search != "" {
+		conds = append(conds, bson.M{"contents": bson.M{"$regex": regexp.QuoteMeta(params.Search), "$options": "i"}})
+	}
+
+	op, dir := "$lt", -1
+	if params.Order == LogOrderAsc {
+		op, dir = "$gt", 1
+	}
+	if cursor != nil {
+		conds = append(conds, bson.M{"$or": bson.A{
+			bson.M{"created_at": bson.M{op: cursor.createdAt}},
+			bson.M{"created_at": cursor.createdAt, "_id": bson.M{op: cursor.requestID}},
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(params.Limit + 1))
+	cur, err := m.LogCol.Find(ctx, bson.M{"$and": conds}, opts)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*types.RequestLog, 0)
+	if err := cur.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return newLogPage(logs, params.Limit), nil
+}
+
+// ApplyRetention implements LogStore.
+func (m *MongoLogStore) ApplyRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return 0, err
+	}
+	policy = policy.WithDefaults()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := m.adoptLogs(ctx, endpointUID, deploymentIDs, policy); err != nil {
+		return 0, err
+	}
+	filter := bson.M{"endpoint_id": endpointUID}
+	if _, err := m.LogCol.UpdateMany(ctx, filter, bson.A{expiryStage(policy)}); err != nil {
+		return 0, err
+	}
+
+	// the ttl monitor runs only every minute, expired logs are removed right away instead.
+	expired := bson.M{"endpoint_id": endpointUID, "expire_at": bson.M{"$lte": time.Now()}}
+	res, err := m.LogCol.DeleteMany(ctx, expired)
+	if err != nil {
+		return 0, err
+	}
+	trimmed, err := m.trimLogs(ctx, endpointUID, policy.MaxRequests)
+	return res.DeletedCount + trimmed, err
+}
+
+// EnforceRetention implements LogStore.
+func (m *MongoLogStore) EnforceRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return 0, err
+	}
+	policy = policy.WithDefaults()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := m.adoptLogs(ctx, endpointUID, deploymentIDs, policy); err != nil {
+		return 0, err
+	}
+	return m.trimLogs(ctx, endpointUID, policy.MaxRequests)
+}
+
+// adoptLogs attributes the logs of the deployments which were appended before logs carried their endpoint to the
+// endpoint, along with the expiry of the policy.
+func (m *MongoLogStore) adoptLogs(ctx context.Context, endpointUID uuid.UUID, deploymentIDs []string, policy types.RetentionPolicy) error {
+	if len(deploymentIDs) == 0 {
+		return nil
+	}
+	deploymentUIDs := make([]uuid.UUID, 0, len(deploymentIDs))
+	for _, deploymentID := range deploymentIDs {
+		deploymentUID, err := uuid.Parse(deploymentID)
+		if err != nil {
+			return err
+		}
+		deploymentUIDs = append(deploymentUIDs, deploymentUID)
+	}
+	filter := bson.M{"deployment_id": bson.M{"$in": deploymentUIDs}, "endpoint_id": bson.M{"$exists": false}}
+	update := bson.A{bson.M{"$set": bson.M{"endpoint_id": endpointUID}}, expiryStage(policy)}
+	_, err := m.LogCol.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// expiryStage returns the update stage which sets the expiry of logs by the policy, from their creation.
+func expiryStage(policy types.RetentionPolicy) bson.M {
+	if policy.MaxAge == types.KeepByCount {
+		return bson.M{"$unset": "expire_at"}
+	}
+	expireAt := bson.M{"$toDate": bson.M{"$multiply": bson.A{bson.M{"$add": bson.A{"$created_at", policy.MaxAge}}, 1000}}}
+	return bson.M{"$set": bson.M{"expire_at": expireAt}}
+}
+
+// trimLogs removes the logs of the endpoint beyond the latest maxRequests ones, 0 keeps all of them.
+func (m *MongoLogStore) trimLogs(ctx context.Context, endpointUID uuid.UUID, maxRequests int) (int64, error) {
+	if maxRequests == 0 {
+		return 0, nil
+	}
+	// the oldest log to keep bounds the logs beyond the request count.
+	filter := bson.M{"endpoint_id": endpointUID}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(maxRequests - 1))
+	oldest := new(types.RequestLog)
+	if err := m.LogCol.FindOne(ctx, filter, opts).Decode(oldest); err == mongo.ErrNoDocuments {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	beyond := bson.M{"endpoint_id": endpointUID, "$or": bson.A{
+		bson.M{"created_at": bson.M{"$lt": oldest.CreatedAt}},
+		bson.M{"created_at": oldest.CreatedAt, "_id": bson.M{"$lt": oldest.RequestID}},
+	}}
+	res, err := m.LogCol.DeleteMany(ctx, beyond)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// PurgeLogOfDeployment implements LogStore.
+func (m *MongoLogStore) PurgeLogOfDeployment(deploymentID string) (int64, error) {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	res, err := m.LogCol.DeleteMany(ctx, bson.M{"deployment_id": deploymentUID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -51,3 +51,31 @@ func TestAppendLog(t *testing.T) {
 	require.NotNil(t, err)
 	require.Nil(t, failedGetEvent)
 }
+
+func TestQueryLogOfDeployment(t *testing.T) {
+	utils.SkipCI(t)
+	db := getMongoDatabase(t)
+
+	logCol := db.Collection(testColLog)
+	defer cleanCollection(t, logCol)
+
+	logStore := store.MongoLogStore{
+		LogCol: logCol,
+	}
+
+	deploymentID := uuid.New()
+	for i := 0; i < 3; i++ {
+		log := types.NewRequestLog(deploymentID, uuid.New(), []string{"line"})
+		require.Nil(t, logStore.AppendLog(log))
+	}
+
+	first, err := logStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Limit: 2})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(first.Logs))
+	require.NotEqual(t, "", first.NextCursor)
+
+	second, err := logStore.QueryLogOfDeployment(deploymentID.String(), store.LogQueryParams{Limit: 2, Cursor: first.NextCursor})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(second.Logs))
+	require.Equal(t, "", second.NextCursor)
+}
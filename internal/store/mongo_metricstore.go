@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hnimtadd/run/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var MetricColName = "metrics"
+
+type MongoMetricStore struct {
+	MetricCol *mongo.Collection
+}
+
+// NewMongoMetricStore returns the metric store on the metrics collection of db, it creates the indexes metrics are
+// queried by, which are bounded by time range on both endpoints and deployments.
+func NewMongoMetricStore(db *mongo.Database) (MetricStore, error) {
+	metricCol := db.Collection(MetricColName)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := metricCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "endpointID", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "deploymentID", Value: 1}, {Key: "createdAt", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoMetricStore{
+		MetricCol: metricCol,
+	}, nil
+}
+
+// AddEndpointMetric implements MetricStore.
+func (m *MongoMetricStore) AddEndpointMetric(endpointID string, metric types.RequestMetric) error {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return err
+	}
+	metric.EndpointID = endpointUID
+	if metric.CreatedAt == 0 {
+		metric.CreatedAt = time.Now().Unix()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = m.MetricCol.InsertOne(ctx, metric)
+	return err
+}
+
+// GetMetricByEndpointID implements MetricStore.
+func (m *MongoMetricStore) GetMetricByEndpointID(endpointID string) (types.RuntimeMetric, error) {
+	metrics, err := m.GetMetricsOfEndpoint(endpointID, RecentMetrics(time.Now()))
+	if err != nil {
+		return types.RuntimeMetric{}, err
+	}
+	return types.NewRuntimeMetric(metrics), nil
+}
+
+// GetMetricsOfEndpoint implements MetricStore.
+func (m *MongoMetricStore) GetMetricsOfEndpoint(endpointID string, params MetricQueryParams) ([]types.RequestMetric, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	return m.findMetrics(bson.M{"endpointID": endpointUID}, params)
+}
+
+// GetMetricsOfDeployment implements MetricStore.
+func (m *MongoMetricStore) GetMetricsOfDeployment(deploymentID string, params MetricQueryParams) ([]types.RequestMetric, error) {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	return m.findMetrics(bson.M{"deploymentID": deploymentUID}, params)
+}
+
+func (m *MongoMetricStore) findMetrics(filter bson.M, params MetricQueryParams) ([]types.RequestMetric, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	filter["createdAt"] = bson.M{"$gte": params.From, "$lt": params.To}
+	cur, err := m.MetricCol.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]types.RequestMetric, 0)
+	err = cur.All(ctx, &metrics)
+	return metrics, err
+}
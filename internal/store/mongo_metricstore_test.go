@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hnimtadd/run/internal/store"
+	"github.com/hnimtadd/run/internal/types"
+	"github.com/hnimtadd/run/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var testColMetric = "metrics"
+
+func TestMongoMetricStore_GetMetricByEndpointID(t *testing.T) {
+	utils.SkipCI(t)
+	db := getMongoDatabase(t)
+
+	metricCol := db.Collection(testColMetric)
+	defer cleanCollection(t, metricCol)
+
+	store := store.MongoMetricStore{
+		MetricCol: metricCol,
+	}
+
+	endpointID := uuid.New()
+	deploymentID := uuid.New()
+	for i, status := range []int{200, 200, 404, 500} {
+		metric := types.CreateRequestMetric(uuid.NewString(), status, time.Duration(i+1)*time.Millisecond)
+		metric.DeploymentID = deploymentID
+		require.Nil(t, store.AddEndpointMetric(endpointID.String(), metric))
+	}
+
+	metric, err := store.GetMetricByEndpointID(endpointID.String())
+	require.Nil(t, err)
+	require.Equal(t, 4, metric.NumRequest)
+	require.Equal(t, 2, metric.NumSuccess)
+	require.Equal(t, 10*time.Millisecond, metric.Duration)
+	require.Equal(t, 2*time.Millisecond, metric.P50)
+	require.Equal(t, 4*time.Millisecond, metric.P99)
+
+	empty, err := store.GetMetricByEndpointID(uuid.NewString())
+	require.Nil(t, err)
+	require.Equal(t, 0, empty.NumRequest)
+}
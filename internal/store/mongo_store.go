@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/types"
 
 	"github.com/google/uuid"
@@ -17,12 +18,14 @@ var (
 	EndpointColName   = "endpoints"
 	DeploymentColName = "deployments"
 	BlobColName       = "blobs"
+	EventColName      = "events"
 )
 
 type MongoStore struct {
 	EndpointCol   *mongo.Collection
 	DeploymentCol *mongo.Collection
 	BlobCol       *mongo.Collection
+	EventCol      *mongo.Collection
 }
 
 func (m MongoStore) UpdateActiveDeploymentOfEndpoint(endpointID string, deploymentID string) error {
@@ -55,6 +58,9 @@ func (m MongoStore) UpdateActiveDeploymentOfEndpoint(endpointID string, deployme
 
 func (m MongoStore) CreateEndpoint(endpoint *types.Endpoint) error {
 	_, err := m.EndpointCol.InsertOne(context.Background(), endpoint)
+	if mongo.IsDuplicateKeyError(err) && endpoint.Slug != "" {
+		return errors.Newf("%w, %s", errors.ErrSlugExisted, endpoint.Slug)
+	}
 	return err
 }
 
@@ -71,7 +77,23 @@ func (m MongoStore) UpdateEndpoint(endpointID string, params UpdateEndpointParam
 		currEnv[k] = v
 	}
 
-	update := bson.M{"$set": bson.M{"environment": currEnv}}
+	set := bson.M{"environment": currEnv}
+	if params.Retention != nil {
+		set["retention"] = *params.Retention
+	}
+	if params.Hosts != nil {
+		set["hosts"] = params.Hosts
+	}
+	if params.Traffic != nil {
+		set["traffic"] = params.Traffic
+	}
+	if params.Health != nil {
+		set["health"] = *params.Health
+	}
+	if params.History != nil {
+		set["history"] = *params.History
+	}
+	update := bson.M{"$set": set}
 	return m.EndpointCol.FindOneAndUpdate(context.Background(), filter, update).Err()
 }
 
@@ -91,6 +113,21 @@ func (m MongoStore) GetEndpointByID(endpointID string) (*types.Endpoint, error)
 	return endpoint, nil
 }
 
+// GetEndpointBySlug implements Store.
+func (m MongoStore) GetEndpointBySlug(slug string) (*types.Endpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	endpoint := new(types.Endpoint)
+	err := m.EndpointCol.FindOne(ctx, bson.M{"slug": slug}).Decode(endpoint)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.ErrEndpointNotExisted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
 func (m MongoStore) GetEndpoints() ([]*types.Endpoint, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
@@ -112,6 +149,43 @@ func (m MongoStore) CreateDeployment(deploy *types.Deployment) error {
 	return err
 }
 
+func (m MongoStore) UpdateDeployment(deploymentID string, params UpdateDeploymentParams) error {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return err
+	}
+	set := bson.M{}
+	if params.Status != "" {
+		set["status"] = params.Status
+	}
+	if params.Hash != "" {
+		set["hash"] = params.Hash
+	}
+	if params.BuildLog != "" {
+		set["buildLog"] = params.BuildLog
+	}
+	if params.Error != "" {
+		set["error"] = params.Error
+	}
+	if params.ActivatedAt != 0 {
+		set["activatedAt"] = params.ActivatedAt
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	res, err := m.DeploymentCol.UpdateOne(ctx, bson.M{"_id": deploymentUID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.ErrDeploymentNotExisted
+	}
+	return nil
+}
+
 func (m MongoStore) GetDeploymentByID(deploymentID string) (*types.Deployment, error) {
 	deploymentUID, err := uuid.Parse(deploymentID)
 	if err != nil {
@@ -123,6 +197,9 @@ func (m MongoStore) GetDeploymentByID(deploymentID string) (*types.Deployment, e
 
 	defer cancel()
 	if err := m.DeploymentCol.FindOne(ctx, filter).Decode(deployment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.ErrDeploymentNotExisted
+		}
 		return nil, err
 	}
 	return deployment, nil
@@ -211,10 +288,61 @@ func (m *MongoStore) GetBlobMetadataByDeploymentID(deploymentID string) (*types.
 	return metadata, nil
 }
 
+func (m *MongoStore) DeleteBlobMetadata(deploymentID string) error {
+	deploymentUID, err := uuid.Parse(deploymentID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = m.BlobCol.DeleteOne(ctx, bson.M{"_id": deploymentUID})
+	return err
+}
+
+// NewMongoStore returns the store backed by the collections of db, it ensures the unique index of endpoint slugs.
+// Endpoints created before slugs existed have none, so the index only covers endpoints with a slug.
 func NewMongoStore(db *mongo.Database) (Store, error) {
+	endpointCol := db.Collection(EndpointColName)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := endpointCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"slug": 1},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &MongoStore{
 		DeploymentCol: db.Collection(DeploymentColName),
-		EndpointCol:   db.Collection(EndpointColName),
+		EndpointCol:   endpointCol,
 		BlobCol:       db.Collection(BlobColName),
+		EventCol:      db.Collection(EventColName),
 	}, nil
 }
+
+func (m MongoStore) AddEvent(event *types.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := m.EventCol.InsertOne(ctx, event)
+	return err
+}
+
+func (m MongoStore) GetEventsOfEndpoint(endpointID string) ([]*types.Event, error) {
+	endpointUID, err := uuid.Parse(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	cur, err := m.EventCol.Find(ctx, bson.M{"endpointID": endpointUID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*types.Event, 0)
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
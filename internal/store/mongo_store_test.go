@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hnimtadd/run/internal/errors"
 	"github.com/hnimtadd/run/internal/store"
 	"github.com/hnimtadd/run/internal/types"
 	"github.com/hnimtadd/run/internal/utils"
@@ -46,6 +47,38 @@ func TestMongoStore_CreateDeployment(t *testing.T) {
 	require.NotNil(t, mongoStore.CreateDeployment(deployment))
 }
 
+func TestMongoStore_UpdateDeployment(t *testing.T) {
+	utils.SkipCI(t)
+	db := getMongoDatabase(t)
+	deploymentCol := db.Collection(testColDeployment)
+	defer cleanCollection(t, deploymentCol)
+	endpoint, err := types.NewEndpoint("endpoint1", "go", make(map[string]string))
+	require.Nil(t, err)
+
+	deployment, err := types.NewDeployment(endpoint)
+	require.Nil(t, err)
+	mongoStore := store.MongoStore{
+		DeploymentCol: deploymentCol,
+	}
+	require.Nil(t, mongoStore.CreateDeployment(deployment))
+	require.Nil(t, mongoStore.UpdateDeployment(deployment.ID.String(), store.UpdateDeploymentParams{
+		Status: types.DeploymentStatusReady,
+		Hash:   "hash",
+	}))
+	require.Nil(t, mongoStore.UpdateDeployment(deployment.ID.String(), store.UpdateDeploymentParams{
+		Status: types.DeploymentStatusActive,
+	}))
+
+	got, err := mongoStore.GetDeploymentByID(deployment.ID.String())
+	require.Nil(t, err)
+	require.Equal(t, types.DeploymentStatusActive, got.Status)
+	require.Equal(t, "hash", got.Hash)
+
+	require.NotNil(t, mongoStore.UpdateDeployment(uuid.NewString(), store.UpdateDeploymentParams{
+		Status: types.DeploymentStatusActive,
+	}))
+}
+
 func TestMongoStore_CreateEndpoint(t *testing.T) {
 	utils.SkipCI(t)
 	db := getMongoDatabase(t)
@@ -287,6 +320,34 @@ func TestMongoStore_GetBlobMetadataByDeploymentID(t *testing.T) {
 	require.Equal(t, *blobMetadata, *successBlobMetadata)
 }
 
+func TestMongoStore_GetEndpointBySlug(t *testing.T) {
+	utils.SkipCI(t)
+	db := getMongoDatabase(t)
+	defer cleanCollection(t, db.Collection(testColEndpoint))
+	mongoStore, err := store.NewMongoStore(db)
+	require.Nil(t, err)
+
+	endpoint, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	endpoint.Slug = "hello"
+	require.Nil(t, mongoStore.CreateEndpoint(endpoint))
+	other, err := types.NewEndpoint("hello", "go", nil)
+	require.Nil(t, err)
+	other.Slug = "hello"
+	require.ErrorIs(t, mongoStore.CreateEndpoint(other), errors.ErrSlugExisted)
+	// endpoints without slug do not conflict.
+	first, _ := types.NewEndpoint("first", "go", nil)
+	second, _ := types.NewEndpoint("second", "go", nil)
+	require.Nil(t, mongoStore.CreateEndpoint(first))
+	require.Nil(t, mongoStore.CreateEndpoint(second))
+
+	got, err := mongoStore.GetEndpointBySlug("hello")
+	require.Nil(t, err)
+	require.Equal(t, endpoint.ID, got.ID)
+	_, err = mongoStore.GetEndpointBySlug("missing")
+	require.ErrorIs(t, err, errors.ErrEndpointNotExisted)
+}
+
 func getMongoDatabase(t *testing.T) *mongo.Database {
 	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
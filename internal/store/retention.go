@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunRetentionSweeper enforces the retention policy of every endpoint on its logs every interval until ctx is done.
+// Stores expire logs by age on their own, the sweeper is what bounds the number of kept requests and attributes the
+// logs appended before logs carried their endpoint.
+func RunRetentionSweeper(ctx context.Context, store Store, logStore LogStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		endpoints, err := store.GetEndpoints()
+		if err != nil {
+			slog.Error("cannot get endpoints to apply log retention", "msg", err.Error())
+			continue
+		}
+		for _, endpoint := range endpoints {
+			endpointID := endpoint.ID.String()
+			deploymentIDs, err := GetDeploymentIDsOfEndpoint(store, endpointID)
+			if err != nil {
+				slog.Error("cannot get deployments to enforce log retention", "endpoint", endpoint.ID, "msg", err.Error())
+				continue
+			}
+			deleted, err := logStore.EnforceRetention(endpointID, deploymentIDs, endpoint.Retention)
+			if err != nil {
+				slog.Error("cannot apply log retention", "endpoint", endpoint.ID, "msg", err.Error())
+				continue
+			}
+			if deleted > 0 {
+				slog.Info("removed logs by retention", "endpoint", endpoint.ID, "deleted", deleted)
+			}
+		}
+	}
+}
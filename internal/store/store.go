@@ -1,7 +1,13 @@
 package store
 
 import (
+	"context"
+	"time"
+
+	"github.com/hnimtadd/run/internal/settings"
 	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/google/uuid"
 )
 
 type (
@@ -9,10 +15,12 @@ type (
 		CreateEndpoint(endpoint *types.Endpoint) error
 		UpdateEndpoint(endpointID string, params UpdateEndpointParams) error
 		GetEndpointByID(endpointID string) (*types.Endpoint, error)
+		GetEndpointBySlug(slug string) (*types.Endpoint, error)
 		GetEndpoints() ([]*types.Endpoint, error)
 		UpdateActiveDeploymentOfEndpoint(endpointID string, deploymentID string) error
 
 		CreateDeployment(deploy *types.Deployment) error
+		UpdateDeployment(deploymentID string, params UpdateDeploymentParams) error
 		GetDeploymentByID(deploymentID string) (*types.Deployment, error)
 		GetDeployments() ([]*types.Deployment, error)
 		DeleteDeployment(deploymentID string) error
@@ -20,20 +28,79 @@ type (
 
 		CreateBlobMetadata(metadata *types.BlobMetadata) error
 		GetBlobMetadataByDeploymentID(deploymentID string) (*types.BlobMetadata, error)
+		DeleteBlobMetadata(deploymentID string) error
+
+		AddEvent(event *types.Event) error
+		// GetEventsOfEndpoint returns the events of the endpoint, newest first.
+		GetEventsOfEndpoint(endpointID string) ([]*types.Event, error)
 	}
 	UpdateEndpointParams struct {
 		Environment map[string]string
+		Retention   *types.RetentionPolicy // left unchanged if nil
+		Hosts       []string               // left unchanged if nil, an empty slice removes every host
+		Traffic     []types.TrafficTarget  // left unchanged if nil, an empty slice sends every request to the active deployment
+		Health      *types.HealthPolicy    // left unchanged if nil
+		History     *types.HistoryPolicy   // left unchanged if nil
+	}
+
+	UpdateDeploymentParams struct {
+		Status   types.DeploymentStatus // left unchanged if empty
+		Hash     string                 // left unchanged if empty
+		BuildLog string                 // left unchanged if empty
+		Error    string                 // left unchanged if empty
+		// ActivatedAt is the unix timestamp of the activation, left unchanged if 0
+		ActivatedAt int64
 	}
 
 	LogStore interface {
+		// AppendLog stores the log until its expiry passes, a log without expiry is only removed by the request
+		// count of the retention of its endpoint.
 		AppendLog(log *types.RequestLog) error
 		GetLogByRequestID(requestID string) (*types.RequestLog, error)
 		GetLogsOfRequest(deploymentID string, requestID string) (*types.RequestLog, error)
 		GetLogOfDeployment(deploymentID string) ([]*types.RequestLog, error)
+		// QueryLogOfDeployment returns a page of logs of the deployment which match given params.
+		QueryLogOfDeployment(deploymentID string, params LogQueryParams) (*LogPage, error)
+		// TailLogOfDeployment sends logs of the deployment appended after the call until ctx is done,
+		// the channel is closed afterward.
+		TailLogOfDeployment(ctx context.Context, deploymentID string) (<-chan *types.RequestLog, error)
+		// ApplyRetention applies the changed policy of the endpoint to its logs, it updates their expiry and removes
+		// logs which are expired or beyond its request count. It returns the number of removed logs. Logs of the
+		// deployments appended before logs carried their endpoint are attributed to the endpoint first.
+		ApplyRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error)
+		// EnforceRetention removes the logs of the endpoint beyond the request count of the policy, their expiry is
+		// left to the store. It returns the number of removed logs. Logs of the deployments appended before logs
+		// carried their endpoint are attributed to the endpoint and given the expiry of the policy.
+		EnforceRetention(endpointID string, deploymentIDs []string, policy types.RetentionPolicy) (int64, error)
+		// PurgeLogOfDeployment removes all logs of the deployment, it returns the number of removed logs.
+		PurgeLogOfDeployment(deploymentID string) (int64, error)
+	}
+	// LogQueryParams selects a page of logs, the zero value selects the first page of all logs, newest first.
+	LogQueryParams struct {
+		Since  int64    // unix timestamp, logs created before are excluded, 0 means unbounded
+		Until  int64    // unix timestamp, logs created at or after are excluded, 0 means unbounded
+		Search string   // case-insensitive text which must appear in one of the log contents
+		Order  LogOrder // order of logs by creation time
+		Cursor string   // NextCursor of the previous page, empty for the first page
+		Limit  int      // maximum number of logs in the page, settings.DefaultLogPageSize if not positive
 	}
+	// LogPage is a page of logs, NextCursor is empty on the last page.
+	LogPage struct {
+		Logs       []*types.RequestLog
+		NextCursor string
+	}
+
 	MetricStore interface {
 		AddEndpointMetric(endpointID string, metrics types.RequestMetric) error
+		// GetMetricByEndpointID aggregates the metrics of the endpoint created within settings.DefaultMetricWindow.
 		GetMetricByEndpointID(endpointID string) (types.RuntimeMetric, error)
+		GetMetricsOfEndpoint(endpointID string, params MetricQueryParams) ([]types.RequestMetric, error)
+		GetMetricsOfDeployment(deploymentID string, params MetricQueryParams) ([]types.RequestMetric, error)
+	}
+	// MetricQueryParams limits the returned metrics to the ones created in [From, To).
+	MetricQueryParams struct {
+		From int64 // unix timestamp
+		To   int64 // unix timestamp
 	}
 
 	BlobStore interface {
@@ -42,3 +109,29 @@ type (
 		DeleteDeploymentBlob(location string) (bool, error)
 	}
 )
+
+// GetEndpoint returns the endpoint addressed by its ID or its slug.
+func GetEndpoint(store Store, ref string) (*types.Endpoint, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return store.GetEndpointByID(ref)
+	}
+	return store.GetEndpointBySlug(ref)
+}
+
+// GetDeploymentIDsOfEndpoint returns the IDs of the deployments of the endpoint.
+func GetDeploymentIDsOfEndpoint(store Store, endpointID string) ([]string, error) {
+	deployments, err := store.GetDeploymentsByEndpointID(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	deploymentIDs := make([]string, 0, len(deployments))
+	for _, deployment := range deployments {
+		deploymentIDs = append(deploymentIDs, deployment.ID.String())
+	}
+	return deploymentIDs, nil
+}
+
+// RecentMetrics returns the params selecting the metrics created within settings.DefaultMetricWindow before now.
+func RecentMetrics(now time.Time) MetricQueryParams {
+	return MetricQueryParams{From: now.Add(-settings.DefaultMetricWindow).Unix(), To: now.Unix() + 1}
+}
@@ -17,6 +17,18 @@ type BlobMetadata struct {
 	//
 	Location  string `json:"storage_location" bson:"location"` // this field will be setted after blob putted to object storage
 	CreatedAt int64  `json:"createdAt" bson:"createdAt"`       // Unix timestamp
+	// Module is what the inspection of the module found when it was deployed, blobs deployed before the inspection
+	// existed have none.
+	Module *ModuleInfo `json:"module,omitempty" bson:"module,omitempty"`
+}
+
+// ModuleInfo is what the inspection of a wasm module found, see runtime.Inspect.
+type ModuleInfo struct {
+	Valid       bool     `json:"valid" bson:"valid"`
+	Imports     []string `json:"imports" bson:"imports"` // module.name of imported functions and memories
+	Exports     []string `json:"exports" bson:"exports"` // names of exported functions
+	Problems    []string `json:"problems,omitempty" bson:"problems,omitempty"`
+	InspectedAt int64    `json:"inspectedAt" bson:"inspectedAt"` // Unix timestamp
 }
 
 type BlobObject struct {
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// ConcurrencyPolicy bounds how many requests of a deployment are served at once, zero values mean the defaults in settings.
+type ConcurrencyPolicy struct {
+	Instances     int `json:"instances" bson:"instances"`         // runtimes serving the deployment side by side
+	MaxQueueDepth int `json:"maxQueueDepth" bson:"maxQueueDepth"` // requests queued on each runtime, including the one being served
+}
+
+// WithDefaults returns a copy of the policy where unset bounds are replaced by the defaults.
+func (p ConcurrencyPolicy) WithDefaults() ConcurrencyPolicy {
+	if p.Instances == 0 {
+		p.Instances = settings.DefaultRuntimeInstances
+	}
+	if p.MaxQueueDepth == 0 {
+		p.MaxQueueDepth = settings.DefaultMaxQueueDepth
+	}
+	return p
+}
+
+func (p ConcurrencyPolicy) Validate() error {
+	switch {
+	case p.Instances < 0 || p.Instances > settings.MaxRuntimeInstances:
+		return errors.Newf("%v, instances must be between 0 and %d", errors.ErrInvalidConcurrency, settings.MaxRuntimeInstances)
+	case p.MaxQueueDepth < 0 || p.MaxQueueDepth > settings.MaxQueueDepth:
+		return errors.Newf("%v, maxQueueDepth must be between 0 and %d", errors.ErrInvalidConcurrency, settings.MaxQueueDepth)
+	}
+	return nil
+}
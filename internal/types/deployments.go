@@ -6,6 +6,55 @@ import (
 	"github.com/google/uuid"
 )
 
+// DeploymentStatus is the step of its lifecycle a deployment is at. A deployment is created pending, source
+// deployments are built first, then its module is validated and compiled, stored to become ready and finally made
+// active on its endpoint, which retires the previously active one. A canary deployment serves a share of the live
+// requests next to the active one instead, until it is promoted to active or retired. A deployment which fails at
+// any step never becomes active.
+type DeploymentStatus string
+
+const (
+	DeploymentStatusPending    DeploymentStatus = "pending"
+	DeploymentStatusBuilding   DeploymentStatus = "building"
+	DeploymentStatusValidating DeploymentStatus = "validating"
+	DeploymentStatusCompiled   DeploymentStatus = "compiled"
+	DeploymentStatusReady      DeploymentStatus = "ready"
+	DeploymentStatusActive     DeploymentStatus = "active"
+	DeploymentStatusCanary     DeploymentStatus = "canary"
+	DeploymentStatusRetired    DeploymentStatus = "retired"
+	DeploymentStatusFailed     DeploymentStatus = "failed"
+)
+
+var deploymentTransitions = map[DeploymentStatus][]DeploymentStatus{
+	DeploymentStatusPending:    {DeploymentStatusBuilding, DeploymentStatusValidating, DeploymentStatusFailed},
+	DeploymentStatusBuilding:   {DeploymentStatusValidating, DeploymentStatusFailed},
+	DeploymentStatusValidating: {DeploymentStatusCompiled, DeploymentStatusFailed},
+	DeploymentStatusCompiled:   {DeploymentStatusReady, DeploymentStatusFailed},
+	DeploymentStatusReady:      {DeploymentStatusActive, DeploymentStatusCanary, DeploymentStatusFailed},
+	DeploymentStatusActive:     {DeploymentStatusRetired},
+	DeploymentStatusCanary:     {DeploymentStatusActive, DeploymentStatusRetired},
+	DeploymentStatusRetired:    {DeploymentStatusActive, DeploymentStatusCanary}, // by a rollback or a traffic split
+}
+
+// CanTransitionTo reports whether a deployment could move from the status to next.
+func (s DeploymentStatus) CanTransitionTo(next DeploymentStatus) bool {
+	for _, status := range deploymentTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether the deployment is done with its deploy, either successfully or not.
+func (s DeploymentStatus) IsTerminal() bool {
+	switch s {
+	case DeploymentStatusActive, DeploymentStatusCanary, DeploymentStatusRetired, DeploymentStatusFailed, "":
+		return true
+	}
+	return false
+}
+
 type Deployment struct {
 	ID          uuid.UUID         `json:"id" bson:"_id"`
 	Hash        string            `json:"hash" bson:"hash"` /* Deprecated, this field will move to types.Blob*/
@@ -14,6 +63,11 @@ type Deployment struct {
 	EndpointID  uuid.UUID         `json:"endpointID" bson:"endpointID"`
 	Environment map[string]string `json:"environment" bson:"environment"`
 	Format      LogFormat         `json:"logFormat" bson:"format"`
+	Status      DeploymentStatus  `json:"status" bson:"status"`
+	BuildLog    string            `json:"buildLog,omitempty" bson:"buildLog,omitempty"`       // output of the build, only set for source deployments
+	Error       string            `json:"error,omitempty" bson:"error,omitempty"`             // why the deploy failed or the deployment was rolled back
+	Canary      int               `json:"canary,omitempty" bson:"canary,omitempty"`           // percent of live requests the deployment serves once ready, all of them if unset
+	ActivatedAt int64             `json:"activatedAt,omitempty" bson:"activatedAt,omitempty"` // unix timestamp of when a deploy or a promotion last made it active
 }
 
 func NewDeployment(endpoint *Endpoint, environment ...map[string]string) (*Deployment, error) {
@@ -29,6 +83,17 @@ func NewDeployment(endpoint *Endpoint, environment ...map[string]string) (*Deplo
 		EndpointID:  endpoint.ID,
 		Environment: env,
 		CreatedAt:   time.Now().Unix(),
+		Status:      DeploymentStatusPending,
 	}
 	return deployment, nil
 }
+
+// IsServable reports whether the blob of the deployment is stored, so that it could be served. Deployments stored
+// before the status existed are servable.
+func (d *Deployment) IsServable() bool {
+	switch d.Status {
+	case DeploymentStatusReady, DeploymentStatusActive, DeploymentStatusCanary, DeploymentStatusRetired, "":
+		return true
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
 
 	"github.com/google/uuid"
 )
@@ -20,10 +21,20 @@ func _isValidRuntime(runtime string) bool {
 type Endpoint struct {
 	Environment        map[string]string `json:"environment" bson:"environment"`
 	Name               string            `json:"name" bson:"name"`
+	Slug               string            `json:"slug" bson:"slug,omitempty"` // unique, addresses the endpoint wherever its ID does
 	Runtime            string            `json:"runtime" bson:"runtime"`
 	CreatedAt          int64             `json:"createdAt" bson:"createdAt"`
 	ID                 uuid.UUID         `json:"id" bson:"_id"`
 	ActiveDeploymentID uuid.UUID         `json:"activeDeploymentId" bson:"activeDeploymentID"`
+	Limits             ResourceLimits    `json:"limits" bson:"limits"`
+	Retention          RetentionPolicy   `json:"retention" bson:"retention"`
+	Streaming          bool              `json:"streaming" bson:"streaming"`         // stream request and response bodies between the ingress and the guest
+	WarmInstances      int               `json:"warmInstances" bson:"warmInstances"` // initialized instances of reactor modules kept by each runtime
+	Concurrency        ConcurrencyPolicy `json:"concurrency" bson:"concurrency"`
+	Hosts              []string          `json:"hosts" bson:"hosts"`     // custom domains claimed by the endpoint, besides the host of its name
+	Traffic            []TrafficTarget   `json:"traffic" bson:"traffic"` // split of live requests across deployments, all of them go to the active one if empty
+	Health             HealthPolicy      `json:"health" bson:"health"`   // rules a newly active deployment is rolled back by
+	History            HistoryPolicy     `json:"history" bson:"history"` // deployments kept when the history is pruned
 }
 
 func NewEndpoint(name string, runtime string, environment map[string]string) (*Endpoint, error) {
@@ -46,6 +57,14 @@ func NewEndpoint(name string, runtime string, environment map[string]string) (*E
 	return endpoint, nil
 }
 
+// ValidateWarmInstances checks the number of warm instances kept for reactor modules of an endpoint.
+func ValidateWarmInstances(n int) error {
+	if n < 0 || n > settings.MaxWarmInstances {
+		return errors.Newf("%v, warmInstances must be between 0 and %d", errors.ErrInvalidWarmInstances, settings.MaxWarmInstances)
+	}
+	return nil
+}
+
 func (e Endpoint) HasActiveDeploy() bool {
 	return e.ActiveDeploymentID.String() != uuid.Nil.String()
 }
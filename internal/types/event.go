@@ -0,0 +1,38 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventKind is what happened to an endpoint.
+type EventKind string
+
+const (
+	// EventKindRollback is the rollback of a deployment which broke the health policy of its endpoint.
+	EventKindRollback EventKind = "rollback"
+)
+
+// Event records a change the platform made to an endpoint on its own, and why.
+type Event struct {
+	ID                 uuid.UUID `json:"id" bson:"_id"`
+	EndpointID         uuid.UUID `json:"endpointID" bson:"endpointID"`
+	DeploymentID       uuid.UUID `json:"deploymentID" bson:"deploymentID"`             // deployment the event is about
+	ActiveDeploymentID uuid.UUID `json:"activeDeploymentID" bson:"activeDeploymentID"` // deployment active after the event
+	Kind               EventKind `json:"kind" bson:"kind"`
+	Reason             string    `json:"reason" bson:"reason"`
+	CreatedAt          int64     `json:"createdAt" bson:"createdAt"` // unix timestamp
+}
+
+func NewEvent(kind EventKind, deployment *Deployment, activeDeploymentID uuid.UUID, reason string) *Event {
+	return &Event{
+		ID:                 uuid.New(),
+		EndpointID:         deployment.EndpointID,
+		DeploymentID:       deployment.ID,
+		ActiveDeploymentID: activeDeploymentID,
+		Kind:               kind,
+		Reason:             reason,
+		CreatedAt:          time.Now().Unix(),
+	}
+}
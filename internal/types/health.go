@@ -0,0 +1,73 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// HealthPolicy are the rules the active deployment of an endpoint is held to for a while after its activation, a
+// deployment which breaks one of them is rolled back to the previous one. Rules left at zero are off, unset bounds of
+// the check mean the defaults in settings.
+type HealthPolicy struct {
+	MaxErrorRate float64 `json:"maxErrorRate" bson:"maxErrorRate"` // fraction of requests answered with 5xx, from 0 to 1
+	MaxP95       int64   `json:"maxP95" bson:"maxP95"`             // milliseconds
+	Window       int64   `json:"window" bson:"window"`             // seconds after the activation the rules are checked for
+	MinRequests  int     `json:"minRequests" bson:"minRequests"`   // requests served before the rules are checked
+}
+
+// WithDefaults returns a copy of the policy where unset bounds are replaced by the defaults.
+func (p HealthPolicy) WithDefaults() HealthPolicy {
+	if p.Window == 0 {
+		p.Window = int64(settings.DefaultHealthWindow / time.Second)
+	}
+	if p.MinRequests == 0 {
+		p.MinRequests = settings.DefaultHealthMinRequests
+	}
+	return p
+}
+
+// Enabled reports whether the policy has any rule.
+func (p HealthPolicy) Enabled() bool {
+	return p.MaxErrorRate > 0 || p.MaxP95 > 0
+}
+
+func (p HealthPolicy) Validate() error {
+	switch {
+	case p.MaxErrorRate < 0 || p.MaxErrorRate > 1:
+		return errors.Newf("%v, maxErrorRate must be between 0 and 1", errors.ErrInvalidHealthPolicy)
+	case p.MaxP95 < 0 || p.MaxP95 > settings.MaxHealthP95.Milliseconds():
+		return errors.Newf("%v, maxP95 must be between 0 and %d", errors.ErrInvalidHealthPolicy, settings.MaxHealthP95.Milliseconds())
+	case p.Window < 0 || p.Window > int64(settings.MaxHealthWindow/time.Second):
+		return errors.Newf("%v, window must be between 0 and %d", errors.ErrInvalidHealthPolicy, int64(settings.MaxHealthWindow/time.Second))
+	case p.MinRequests < 0:
+		return errors.Newf("%v, minRequests must not be negative", errors.ErrInvalidHealthPolicy)
+	}
+	return nil
+}
+
+// Watches reports whether the rules apply at now to a deployment activated at activatedAt, a unix timestamp.
+func (p HealthPolicy) Watches(activatedAt int64, now time.Time) bool {
+	if !p.Enabled() || activatedAt == 0 {
+		return false
+	}
+	return now.Unix() < activatedAt+p.WithDefaults().Window
+}
+
+// Check returns which rule the metric of the requests served since the activation breaks, or an empty string if
+// it breaks none or too few requests were served to tell.
+func (p HealthPolicy) Check(metric RuntimeMetric) string {
+	p = p.WithDefaults()
+	if metric.NumRequest == 0 || metric.NumRequest < p.MinRequests {
+		return ""
+	}
+	if p.MaxErrorRate > 0 && metric.ErrorRate > p.MaxErrorRate {
+		return fmt.Sprintf("error rate %.2f%% of %d requests is above %.2f%%", metric.ErrorRate*100, metric.NumRequest, p.MaxErrorRate*100)
+	}
+	if maxP95 := time.Duration(p.MaxP95) * time.Millisecond; p.MaxP95 > 0 && metric.P95 > maxP95 {
+		return fmt.Sprintf("p95 latency %s of %d requests is above %s", metric.P95, metric.NumRequest, maxP95)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// HistoryPolicy bounds the deployments of an endpoint which are kept when its history is pruned, zero values mean
+// the defaults in settings. The active deployment, canaries and deployments still being deployed are always kept.
+type HistoryPolicy struct {
+	MaxDeployments int   `json:"maxDeployments" bson:"maxDeployments"` // latest deployments to keep
+	MaxAge         int64 `json:"maxAge" bson:"maxAge"`                 // seconds, 0 keeps deployments of any age
+}
+
+// WithDefaults returns a copy of the policy where unset bounds are replaced by the defaults.
+func (p HistoryPolicy) WithDefaults() HistoryPolicy {
+	if p.MaxDeployments == 0 {
+		p.MaxDeployments = settings.DefaultDeployHistory
+	}
+	return p
+}
+
+func (p HistoryPolicy) Validate() error {
+	switch {
+	case p.MaxDeployments < 0:
+		return errors.Newf("%v, maxDeployments must not be negative", errors.ErrInvalidHistoryPolicy)
+	case p.MaxAge < 0:
+		return errors.Newf("%v, maxAge must not be negative", errors.ErrInvalidHistoryPolicy)
+	}
+	return nil
+}
+
+// Prunable returns the deployments of the endpoint which the policy does not keep at now, newest first.
+func (p HistoryPolicy) Prunable(endpoint *Endpoint, deployments []*Deployment, now time.Time) []*Deployment {
+	p = p.WithDefaults()
+	sorted := append([]*Deployment{}, deployments...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt > sorted[j].CreatedAt })
+
+	var prunable []*Deployment
+	for i, deployment := range sorted {
+		if endpoint.Serves(deployment.ID) || !deployment.Status.IsTerminal() {
+			continue
+		}
+		expired := p.MaxAge > 0 && deployment.CreatedAt < now.Unix()-p.MaxAge
+		if i >= p.MaxDeployments || expired {
+			prunable = append(prunable, deployment)
+		}
+	}
+	return prunable
+}
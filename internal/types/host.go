@@ -0,0 +1,94 @@
+package types
+
+import (
+	"net"
+	"strings"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// NormalizeHost returns the host of a Host header or a hostname given by a user in the form hosts are routed with,
+// lower case and without port or trailing dot.
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// LabelHost returns the host of given label under settings.EdgeDomain, or "" if it is not a valid label of a hostname.
+func LabelHost(label string) string {
+	label = strings.ToLower(label)
+	if !isHostLabel(label) {
+		return ""
+	}
+	return label + "." + settings.EdgeDomain
+}
+
+// Host returns the host the endpoint is served at under settings.EdgeDomain, which is derived from its unique slug.
+// Endpoints created before slugs have the host of their name, which is not unique.
+func (e Endpoint) Host() string {
+	if e.Slug != "" {
+		return LabelHost(e.Slug)
+	}
+	return LabelHost(e.Name)
+}
+
+// Hostnames returns the hosts the endpoint is served at, the host of its slug first.
+func (e Endpoint) Hostnames() []string {
+	var hosts []string
+	if host := e.Host(); host != "" {
+		hosts = append(hosts, host)
+	}
+	return append(hosts, e.Hosts...)
+}
+
+// NormalizeHosts checks the custom hosts claimed by an endpoint, it returns them normalized.
+func NormalizeHosts(hosts []string) ([]string, error) {
+	if len(hosts) > settings.MaxEndpointHosts {
+		return nil, errors.Newf("%v, an endpoint claims at most %d hosts", errors.ErrInvalidHost, settings.MaxEndpointHosts)
+	}
+	normalized := make([]string, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		host = NormalizeHost(host)
+		switch {
+		case !isHostname(host):
+			return nil, errors.Newf("%v, %q is not a hostname", errors.ErrInvalidHost, host)
+		case host == settings.EdgeDomain || strings.HasSuffix(host, "."+settings.EdgeDomain):
+			return nil, errors.Newf("%v, hosts under %s are reserved for endpoint slugs", errors.ErrInvalidHost, settings.EdgeDomain)
+		case seen[host]:
+			return nil, errors.Newf("%v, %q is given twice", errors.ErrInvalidHost, host)
+		}
+		seen[host] = true
+		normalized = append(normalized, host)
+	}
+	return normalized, nil
+}
+
+// isHostname reports whether host is a fully qualified hostname of at least two labels.
+func isHostname(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(host) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !isHostLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHostLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
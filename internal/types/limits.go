@@ -0,0 +1,76 @@
+package types
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// MemoryStats is a snapshot of the resources held by a runtime.
+type MemoryStats struct {
+	WarmInstances int    `json:"warmInstances"`
+	WarmMemory    uint64 `json:"warmMemory"` // bytes of linear memory held by the warm instances
+	PeakMemory    uint64 `json:"peakMemory"` // bytes of linear memory of the largest instance so far
+}
+
+// ResourceLimits bounds the resources a single invocation of an endpoint could use, zero values mean the defaults in settings.
+type ResourceLimits struct {
+	MaxMemoryPages uint32 `json:"maxMemoryPages" bson:"maxMemoryPages"` // wasm pages of 64KiB
+	MaxWallTime    int64  `json:"maxWallTime" bson:"maxWallTime"`       // milliseconds
+	MaxStdoutSize  int64  `json:"maxStdoutSize" bson:"maxStdoutSize"`   // bytes, applies to stdout and stderr each
+}
+
+// WithDefaults returns a copy of the limits where unset limits are replaced by the defaults.
+func (l ResourceLimits) WithDefaults() ResourceLimits {
+	if l.MaxMemoryPages == 0 {
+		l.MaxMemoryPages = settings.DefaultMaxMemoryPages
+	}
+	if l.MaxWallTime == 0 {
+		l.MaxWallTime = settings.DefaultRequestTimeout.Milliseconds()
+	}
+	if l.MaxStdoutSize == 0 {
+		l.MaxStdoutSize = settings.DefaultMaxStdoutSize
+	}
+	return l
+}
+
+// WallTime returns how long a single invocation is allowed to run.
+func (l ResourceLimits) WallTime() time.Duration {
+	return time.Duration(l.WithDefaults().MaxWallTime) * time.Millisecond
+}
+
+func (l ResourceLimits) Validate() error {
+	switch {
+	case l.MaxMemoryPages > settings.MaxMemoryPages:
+		return errors.Newf("%v, maxMemoryPages must be at most %d", errors.ErrInvalidLimits, settings.MaxMemoryPages)
+	case l.MaxWallTime < 0 || l.MaxWallTime > settings.MaxRequestTimeout.Milliseconds():
+		return errors.Newf("%v, maxWallTime must be between 0 and %d", errors.ErrInvalidLimits, settings.MaxRequestTimeout.Milliseconds())
+	case l.MaxStdoutSize < 0 || l.MaxStdoutSize > settings.MaxStdoutSize:
+		return errors.Newf("%v, maxStdoutSize must be between 0 and %d", errors.ErrInvalidLimits, settings.MaxStdoutSize)
+	}
+	return nil
+}
+
+// ErrorClass tells which resource limit a failed invocation violated.
+type ErrorClass string
+
+const (
+	ErrorClassNone        ErrorClass = ""
+	ErrorClassWallTime    ErrorClass = "wall_time_exceeded"
+	ErrorClassMemoryLimit ErrorClass = "memory_limit_exceeded"
+	ErrorClassStdoutLimit ErrorClass = "stdout_limit_exceeded"
+)
+
+func ErrorClassOf(err error) ErrorClass {
+	switch {
+	case stderrors.Is(err, errors.ErrInvokeTimeout):
+		return ErrorClassWallTime
+	case stderrors.Is(err, errors.ErrMemoryLimitExceeded):
+		return ErrorClassMemoryLimit
+	case stderrors.Is(err, errors.ErrStdoutLimitExceeded):
+		return ErrorClassStdoutLimit
+	}
+	return ErrorClassNone
+}
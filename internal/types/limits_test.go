@@ -0,0 +1,44 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimits_Validate(t *testing.T) {
+	maxWallTime := settings.MaxRequestTimeout.Milliseconds()
+	tests := []struct {
+		name   string
+		limits types.ResourceLimits
+		err    error
+	}{
+		{name: "defaults", limits: types.ResourceLimits{}},
+		{name: "max wall time", limits: types.ResourceLimits{MaxWallTime: maxWallTime}},
+		{name: "above max wall time", limits: types.ResourceLimits{MaxWallTime: maxWallTime + 1}, err: errors.ErrInvalidLimits},
+		{
+			// the wall time overflows as a duration, which must not wrap around to a negative one.
+			name:   "overflowing max wall time",
+			limits: types.ResourceLimits{MaxWallTime: 10000000000000},
+			err:    errors.ErrInvalidLimits,
+		},
+		{name: "negative max wall time", limits: types.ResourceLimits{MaxWallTime: -1}, err: errors.ErrInvalidLimits},
+		{name: "max memory pages", limits: types.ResourceLimits{MaxMemoryPages: settings.MaxMemoryPages}},
+		{name: "above max memory pages", limits: types.ResourceLimits{MaxMemoryPages: settings.MaxMemoryPages + 1}, err: errors.ErrInvalidLimits},
+		{name: "above max stdout size", limits: types.ResourceLimits{MaxStdoutSize: settings.MaxStdoutSize + 1}, err: errors.ErrInvalidLimits},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.limits.Validate()
+			if test.err == nil {
+				require.Nil(t, err)
+				return
+			}
+			require.ErrorContains(t, err, test.err.Error())
+		})
+	}
+}
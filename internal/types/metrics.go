@@ -1,18 +1,31 @@
 package types
 
-import "time"
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // RuntimeMetric is metric of specific deployment
 type RuntimeMetric struct {
-	Duration   time.Duration
-	NumRequest int
-	NumSuccess int
+	Duration   time.Duration `json:"duration"` // total duration of all requests
+	NumRequest int           `json:"numRequest"`
+	NumSuccess int           `json:"numSuccess"`
+	NumError   int           `json:"numError"` // requests answered with 5xx status
+	ErrorRate  float64       `json:"errorRate"`
+	P50        time.Duration `json:"p50"`
+	P95        time.Duration `json:"p95"`
+	P99        time.Duration `json:"p99"`
 }
 
 type RequestMetric struct {
-	RequestID string
-	Status    int
-	Duration  time.Duration
+	RequestID    string        `json:"requestID" bson:"_id"`
+	EndpointID   uuid.UUID     `json:"endpointID" bson:"endpointID"`
+	DeploymentID uuid.UUID     `json:"deploymentID" bson:"deploymentID"`
+	Status       int           `json:"status" bson:"status"`
+	Duration     time.Duration `json:"duration" bson:"duration"`
+	CreatedAt    int64         `json:"createdAt" bson:"createdAt"` // unix timestamp
 }
 
 func CreateRequestMetric(id string, status int, duration time.Duration) RequestMetric {
@@ -20,5 +33,96 @@ func CreateRequestMetric(id string, status int, duration time.Duration) RequestM
 		RequestID: id,
 		Status:    status,
 		Duration:  duration,
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// IsError reports whether the request was answered with server error.
+func (m RequestMetric) IsError() bool {
+	return m.Status >= 500
+}
+
+// IsSuccess reports whether the request was answered without client or server error.
+func (m RequestMetric) IsSuccess() bool {
+	return m.Status >= 200 && m.Status < 400
+}
+
+// NewRuntimeMetric aggregates given request metrics into a single RuntimeMetric.
+func NewRuntimeMetric(metrics []RequestMetric) RuntimeMetric {
+	res := RuntimeMetric{NumRequest: len(metrics)}
+	if len(metrics) == 0 {
+		return res
+	}
+
+	durations := make([]time.Duration, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.IsSuccess() {
+			res.NumSuccess++
+		}
+		if metric.IsError() {
+			res.NumError++
+		}
+		res.Duration += metric.Duration
+		durations = append(durations, metric.Duration)
+	}
+
+	res.ErrorRate = float64(res.NumError) / float64(res.NumRequest)
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	res.P50 = percentile(durations, 50)
+	res.P95 = percentile(durations, 95)
+	res.P99 = percentile(durations, 99)
+	return res
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// MetricBucket is the aggregated metric of requests created in [Start, End).
+type MetricBucket struct {
+	Start int64 `json:"start"` // unix timestamp
+	End   int64 `json:"end"`   // unix timestamp
+	RuntimeMetric
+}
+
+// BucketRequestMetrics splits [from, to) into windows of step and aggregates given metrics into them.
+// Metrics created outside of the range are ignored.
+func BucketRequestMetrics(metrics []RequestMetric, from, to time.Time, step time.Duration) []MetricBucket {
+	if step < time.Second || !to.After(from) {
+		return nil
+	}
+
+	stepSec := int64(step / time.Second)
+	fromSec, toSec := from.Unix(), to.Unix()
+	numBucket := int((toSec - fromSec + stepSec - 1) / stepSec)
+
+	grouped := make([][]RequestMetric, numBucket)
+	for _, metric := range metrics {
+		if metric.CreatedAt < fromSec || metric.CreatedAt >= toSec {
+			continue
+		}
+		idx := int((metric.CreatedAt - fromSec) / stepSec)
+		grouped[idx] = append(grouped[idx], metric)
+	}
+
+	buckets := make([]MetricBucket, 0, numBucket)
+	for idx, group := range grouped {
+		start := fromSec + int64(idx)*stepSec
+		end := start + stepSec
+		if end > toSec {
+			end = toSec
+		}
+		buckets = append(buckets, MetricBucket{
+			Start:         start,
+			End:           end,
+			RuntimeMetric: NewRuntimeMetric(group),
+		})
 	}
+	return buckets
 }
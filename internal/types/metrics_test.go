@@ -0,0 +1,77 @@
+package types_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketRequestMetrics(t *testing.T) {
+	from := time.Unix(1000, 0)
+	metricAt := func(createdAt int64, status int) types.RequestMetric {
+		return types.RequestMetric{Status: status, Duration: time.Millisecond, CreatedAt: createdAt}
+	}
+	metrics := []types.RequestMetric{
+		metricAt(999, http.StatusOK), // before the range
+		metricAt(1000, http.StatusOK),
+		metricAt(1059, http.StatusInternalServerError),
+		metricAt(1060, http.StatusOK),
+		metricAt(1150, http.StatusOK), // at the end of the range
+	}
+
+	tests := []struct {
+		name     string
+		metrics  []types.RequestMetric
+		to       time.Time
+		step     time.Duration
+		expected [][3]int64 // start, end and number of requests of each bucket
+	}{
+		{
+			name:     "empty buckets",
+			to:       from.Add(3 * time.Minute),
+			step:     time.Minute,
+			expected: [][3]int64{{1000, 1060, 0}, {1060, 1120, 0}, {1120, 1180, 0}},
+		},
+		{
+			name:     "aligned to step from the start",
+			metrics:  metrics,
+			to:       from.Add(150 * time.Second),
+			step:     time.Minute,
+			expected: [][3]int64{{1000, 1060, 2}, {1060, 1120, 1}, {1120, 1150, 0}},
+		},
+		{
+			name:     "single bucket",
+			metrics:  metrics,
+			to:       from.Add(150 * time.Second),
+			step:     time.Hour,
+			expected: [][3]int64{{1000, 1150, 3}},
+		},
+		{
+			name: "step below a second",
+			to:   from.Add(time.Minute),
+			step: time.Millisecond,
+		},
+		{
+			name: "empty range",
+			to:   from,
+			step: time.Minute,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buckets := types.BucketRequestMetrics(test.metrics, from, test.to, test.step)
+			require.Len(t, buckets, len(test.expected))
+			for idx, bucket := range buckets {
+				require.Equal(t, test.expected[idx], [3]int64{bucket.Start, bucket.End, int64(bucket.NumRequest)})
+			}
+		})
+	}
+
+	buckets := types.BucketRequestMetrics(metrics, from, from.Add(time.Minute), time.Minute)
+	require.Equal(t, 1, buckets[0].NumError)
+	require.Equal(t, 0.5, buckets[0].ErrorRate)
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,11 +9,70 @@ import (
 
 type LogFormat byte
 
+// LogStream is the output stream of the guest a log entry was written to.
+type LogStream string
+
+const (
+	LogStreamStdout LogStream = "stdout"
+	LogStreamStderr LogStream = "stderr"
+)
+
+// LogLevel is the severity of a log entry, levels are ordered from debug to error.
+type LogLevel string
+
+const (
+	LogLevelDebug LogLevel = "debug"
+	LogLevelInfo  LogLevel = "info"
+	LogLevelWarn  LogLevel = "warn"
+	LogLevelError LogLevel = "error"
+)
+
+var logLevelRank = map[LogLevel]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+}
+
+// ParseLogLevel parses the level written by the guest, common aliases such as "warning" or "ERR" are accepted.
+func ParseLogLevel(raw string) (LogLevel, bool) {
+	switch strings.ToLower(raw) {
+	case "debug", "trace":
+		return LogLevelDebug, true
+	case "info", "notice":
+		return LogLevelInfo, true
+	case "warn", "warning":
+		return LogLevelWarn, true
+	case "error", "err", "fatal", "panic", "critical":
+		return LogLevelError, true
+	}
+	return "", false
+}
+
+// AtLeast reports whether the level is as severe as given level.
+func (l LogLevel) AtLeast(level LogLevel) bool {
+	return logLevelRank[l] >= logLevelRank[level]
+}
+
+// LogEntry is a single line of guest output.
+type LogEntry struct {
+	Stream  LogStream      `json:"stream" bson:"stream"`
+	Level   LogLevel       `json:"level" bson:"level"`
+	Time    int64          `json:"time" bson:"time"` // unix timestamp in milliseconds
+	Message string         `json:"message" bson:"message"`
+	Fields  map[string]any `json:"fields,omitempty" bson:"fields,omitempty"` // remaining fields of json log lines
+}
+
 type RequestLog struct {
-	RequestID    uuid.UUID `bson:"_id"`
-	DeploymentID uuid.UUID `bson:"deployment_id"`
-	Contents     []string  `bson:"contents"`
-	CreatedAt    int64     `bson:"created_at"` // unix timestamp
+	RequestID    uuid.UUID  `bson:"_id"`
+	DeploymentID uuid.UUID  `bson:"deployment_id"`
+	EndpointID   uuid.UUID  `bson:"endpoint_id,omitempty"`
+	Contents     []string   `bson:"contents"`
+	Entries      []LogEntry `bson:"entries,omitempty"`
+	Status       int        `bson:"status,omitempty"`      // status code the request was answered with
+	CreatedAt    int64      `bson:"created_at"`            // unix timestamp
+	ExpireAt     time.Time  `bson:"expire_at,omitempty"`   // when the log is removed, by the retention policy of its endpoint
+	ErrorClass   ErrorClass `bson:"error_class,omitempty"` // set when the request violated one of the resource limits
 }
 
 func NewRequestLog(deploymentID uuid.UUID, requestID uuid.UUID, logs []string) *RequestLog {
@@ -23,3 +83,42 @@ func NewRequestLog(deploymentID uuid.UUID, requestID uuid.UUID, logs []string) *
 		CreatedAt:    time.Now().Unix(),
 	}
 }
+
+// NewStructuredRequestLog creates the request log of given entries, Contents holds their messages.
+func NewStructuredRequestLog(deploymentID uuid.UUID, requestID uuid.UUID, entries []LogEntry) *RequestLog {
+	contents := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		contents = append(contents, entry.Message)
+	}
+	log := NewRequestLog(deploymentID, requestID, contents)
+	log.Entries = entries
+	return log
+}
+
+// LogEntries returns the entries of the log, logs stored before entries existed are converted from their contents.
+func (l *RequestLog) LogEntries() []LogEntry {
+	if l.Entries != nil || len(l.Contents) == 0 {
+		return l.Entries
+	}
+	entries := make([]LogEntry, 0, len(l.Contents))
+	for _, line := range l.Contents {
+		entries = append(entries, LogEntry{
+			Stream:  LogStreamStdout,
+			Level:   LogLevelInfo,
+			Time:    l.CreatedAt * 1000,
+			Message: line,
+		})
+	}
+	return entries
+}
+
+// FilterLogEntries returns the entries which are at least as severe as given level.
+func FilterLogEntries(entries []LogEntry, level LogLevel) []LogEntry {
+	res := make([]LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Level.AtLeast(level) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+)
+
+// KeepByCount is the MaxAge of retention policies which keep logs whatever their age, bounded by MaxRequests only.
+const KeepByCount int64 = -1
+
+// RetentionPolicy bounds how long request logs of an endpoint are kept, zero values mean the defaults in settings.
+type RetentionPolicy struct {
+	MaxAge      int64 `json:"maxAge" bson:"maxAge"`           // seconds, or KeepByCount
+	MaxRequests int   `json:"maxRequests" bson:"maxRequests"` // logs of the latest requests to keep, 0 keeps all of them
+}
+
+// WithDefaults returns a copy of the policy where unset bounds are replaced by the defaults.
+func (p RetentionPolicy) WithDefaults() RetentionPolicy {
+	if p.MaxAge == 0 {
+		p.MaxAge = int64(settings.DefaultLogRetention / time.Second)
+	}
+	return p
+}
+
+// ExpireAt returns when the log created at createdAt expires, or the zero time if the policy keeps logs whatever
+// their age.
+func (p RetentionPolicy) ExpireAt(createdAt time.Time) time.Time {
+	p = p.WithDefaults()
+	if p.MaxAge == KeepByCount {
+		return time.Time{}
+	}
+	return createdAt.Add(time.Duration(p.MaxAge) * time.Second)
+}
+
+func (p RetentionPolicy) Validate() error {
+	switch {
+	case p.MaxAge < KeepByCount || p.MaxAge > int64(settings.MaxLogRetention/time.Second):
+		return errors.Newf("%v, maxAge must be between 0 and %d, or %d to keep logs by maxRequests only",
+			errors.ErrInvalidRetention, int64(settings.MaxLogRetention/time.Second), KeepByCount)
+	case p.MaxRequests < 0:
+		return errors.Newf("%v, maxRequests must not be negative", errors.ErrInvalidRetention)
+	case p.MaxAge == KeepByCount && p.MaxRequests == 0:
+		return errors.Newf("%v, maxRequests must be set to keep logs by maxRequests only", errors.ErrInvalidRetention)
+	}
+	return nil
+}
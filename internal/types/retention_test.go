@@ -0,0 +1,45 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+	"github.com/hnimtadd/run/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	maxAge := int64(settings.MaxLogRetention / time.Second)
+	tests := []struct {
+		name   string
+		policy types.RetentionPolicy
+		err    error
+	}{
+		{name: "defaults", policy: types.RetentionPolicy{}},
+		{name: "max age", policy: types.RetentionPolicy{MaxAge: maxAge}},
+		{name: "above max age", policy: types.RetentionPolicy{MaxAge: maxAge + 1}, err: errors.ErrInvalidRetention},
+		{
+			// the age overflows as a duration, which must not wrap around to a time in the past.
+			name:   "overflowing max age",
+			policy: types.RetentionPolicy{MaxAge: 10000000000},
+			err:    errors.ErrInvalidRetention,
+		},
+		{name: "keep by count", policy: types.RetentionPolicy{MaxAge: types.KeepByCount, MaxRequests: 10}},
+		{name: "keep by count without count", policy: types.RetentionPolicy{MaxAge: types.KeepByCount}, err: errors.ErrInvalidRetention},
+		{name: "negative max age", policy: types.RetentionPolicy{MaxAge: -2}, err: errors.ErrInvalidRetention},
+		{name: "negative max requests", policy: types.RetentionPolicy{MaxRequests: -1}, err: errors.ErrInvalidRetention},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate()
+			if test.err == nil {
+				require.Nil(t, err)
+				return
+			}
+			require.ErrorContains(t, err, test.err.Error())
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/hnimtadd/run/internal/errors"
+
+	"github.com/google/uuid"
+)
+
+// ValidateSlug checks the slug of an endpoint, which addresses the endpoint wherever its ID does. It is a lower case
+// label of a hostname which does not look like an ID.
+func ValidateSlug(slug string) error {
+	if !isHostLabel(slug) {
+		return errors.Newf("%v, slug must be 1 to 63 lower case letters, digits or inner hyphens", errors.ErrInvalidSlug)
+	}
+	if _, err := uuid.Parse(slug); err == nil {
+		return errors.Newf("%v, slug must not be an ID", errors.ErrInvalidSlug)
+	}
+	return nil
+}
+
+// Slugify derives the slug of an endpoint from its name, runs of other characters than letters and digits become a
+// hyphen. It returns "" if the name has no letter or digit.
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(c)
+			continue
+		}
+		hyphen = true
+	}
+	slug := b.String()
+	if len(slug) > 63 {
+		slug = strings.TrimRight(slug[:63], "-")
+	}
+	return slug
+}
@@ -0,0 +1,17 @@
+package types
+
+import (
+	"io"
+	"net/http"
+)
+
+// Stream is the request body and the response of a streamed invocation. It wraps the connection of the client, so
+// it only lives on the node which accepted the request.
+type Stream interface {
+	// Read reads the next chunk of the request body.
+	io.Reader
+	// WriteHead writes the status code and headers of the response, it is called at most once before any Write.
+	WriteHead(code int, header http.Header) error
+	// Write writes a chunk of the response body and flushes it to the client.
+	Write(p []byte) (int, error)
+}
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/hnimtadd/run/internal/errors"
+	"github.com/hnimtadd/run/internal/settings"
+
+	"github.com/google/uuid"
+)
+
+// TrafficTarget is the share of the live requests of an endpoint served by one of its deployments.
+type TrafficTarget struct {
+	DeploymentID uuid.UUID `json:"deploymentID" bson:"deploymentID"`
+	Weight       int       `json:"weight" bson:"weight"` // percent of the requests
+}
+
+// ValidateTraffic checks a split of the live requests of an endpoint whose active deployment is given. The weights
+// are percents adding up to 100, and the active deployment is part of the split as the stable track of canaries.
+// An empty split sends every request to the active deployment.
+func ValidateTraffic(traffic []TrafficTarget, active uuid.UUID) error {
+	if len(traffic) == 0 {
+		return nil
+	}
+	if len(traffic) > settings.MaxTrafficTargets {
+		return errors.Newf("%v, traffic is split across at most %d deployments", errors.ErrInvalidTraffic, settings.MaxTrafficTargets)
+	}
+	var (
+		total     int
+		hasActive bool
+		seen      = make(map[uuid.UUID]bool, len(traffic))
+	)
+	for _, target := range traffic {
+		switch {
+		case target.Weight < 0 || target.Weight > 100:
+			return errors.Newf("%v, weights must be between 0 and 100", errors.ErrInvalidTraffic)
+		case seen[target.DeploymentID]:
+			return errors.Newf("%v, deployment %s is given twice", errors.ErrInvalidTraffic, target.DeploymentID)
+		}
+		seen[target.DeploymentID] = true
+		hasActive = hasActive || target.DeploymentID == active
+		total += target.Weight
+	}
+	if total != 100 {
+		return errors.Newf("%v, weights must add up to 100, got %d", errors.ErrInvalidTraffic, total)
+	}
+	if !hasActive {
+		return errors.Newf("%v, active deployment %s must be part of the split", errors.ErrInvalidTraffic, active)
+	}
+	return nil
+}
+
+// PickDeployment returns the deployment which serves the live request of given sticky key by the traffic split of
+// the endpoint, requests of the same key go to the same deployment as long as the split is unchanged. A request
+// without key goes to a random deployment by weight.
+func (e Endpoint) PickDeployment(key string) uuid.UUID {
+	if len(e.Traffic) == 0 {
+		return e.ActiveDeploymentID
+	}
+	var bucket int
+	if key == "" {
+		bucket = rand.Intn(100)
+	} else {
+		// the endpoint is part of the hash so that a client is not in the same bucket of every endpoint.
+		h := fnv.New32a()
+		_, _ = h.Write(e.ID[:])
+		_, _ = h.Write([]byte(key))
+		bucket = int(h.Sum32() % 100)
+	}
+	for _, target := range e.Traffic {
+		if bucket < target.Weight {
+			return target.DeploymentID
+		}
+		bucket -= target.Weight
+	}
+	return e.ActiveDeploymentID
+}
+
+// Serves reports whether the deployment is the active deployment of the endpoint or part of its traffic split.
+func (e Endpoint) Serves(deploymentID uuid.UUID) bool {
+	if deploymentID == e.ActiveDeploymentID {
+		return true
+	}
+	for _, target := range e.Traffic {
+		if target.DeploymentID == deploymentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Canary returns the deployment of the split which is not the active one and serves the most requests, or uuid.Nil
+// if the endpoint has no canary.
+func (e Endpoint) Canary() uuid.UUID {
+	canary, weight := uuid.Nil, -1
+	for _, target := range e.Traffic {
+		if target.DeploymentID != e.ActiveDeploymentID && target.Weight > weight {
+			canary, weight = target.DeploymentID, target.Weight
+		}
+	}
+	return canary
+}
+
+// CanaryTraffic returns the split which sends weight percent of the requests to the canary and the others to the
+// active deployment.
+func CanaryTraffic(active, canary uuid.UUID, weight int) []TrafficTarget {
+	return []TrafficTarget{
+		{DeploymentID: active, Weight: 100 - weight},
+		{DeploymentID: canary, Weight: weight},
+	}
+}
+
+// ValidateCanaryWeight checks the percent of the live requests a canary deployment serves.
+func ValidateCanaryWeight(weight int) error {
+	if weight < 0 || weight > 99 {
+		return errors.Newf("%v, canary weight must be between 1 and 99", errors.ErrInvalidTraffic)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !wasip1
+
+package sdk
+
+import "errors"
+
+// streaming host functions only exist when running inside the runtime.
+var errHost = errors.New("sdk: host functions are only available on wasip1")
+
+func hostReadBody([]byte) (int, error) {
+	return 0, errHost
+}
+
+func hostWriteHead([]byte) error {
+	return errHost
+}
+
+func hostWriteBody([]byte) error {
+	return errHost
+}
@@ -0,0 +1,51 @@
+//go:build wasip1
+
+package sdk
+
+import (
+	"errors"
+	"unsafe"
+)
+
+//go:wasmimport run read_body
+func readBody(ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport run write_head
+func writeHead(ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport run write_body
+func writeBody(ptr unsafe.Pointer, size uint32) int32
+
+var errHost = errors.New("sdk: host function failed")
+
+func hostReadBody(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	n := readBody(unsafe.Pointer(&buf[0]), uint32(len(buf)))
+	if n < 0 {
+		return 0, errHost
+	}
+	return int(n), nil
+}
+
+func hostWriteHead(b []byte) error {
+	var ptr unsafe.Pointer
+	if len(b) > 0 {
+		ptr = unsafe.Pointer(&b[0])
+	}
+	if writeHead(ptr, uint32(len(b))) != 0 {
+		return errHost
+	}
+	return nil
+}
+
+func hostWriteBody(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if writeBody(unsafe.Pointer(&b[0]), uint32(len(b))) != 0 {
+		return errHost
+	}
+	return nil
+}
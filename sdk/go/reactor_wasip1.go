@@ -0,0 +1,15 @@
+//go:build wasip1 && go1.24
+
+package sdk
+
+import "log"
+
+// handle serves the request of a reactor module with the handler registered by Serve.
+//
+//go:wasmexport handle
+func handle() {
+	if handler == nil {
+		log.Fatalf("sdk: no handler to serve the request, call Serve from init")
+	}
+	Handle(handler)
+}
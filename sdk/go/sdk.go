@@ -2,12 +2,12 @@ package sdk
 
 import (
 	"bytes"
-	"encoding/binary"
 	"io"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/hnimtadd/run/internal/frame"
 	pb "github.com/hnimtadd/run/pbs/gopb/v1"
 	"google.golang.org/protobuf/proto"
 )
@@ -22,6 +22,7 @@ func newResponseWriter() *responseWriter {
 	return &responseWriter{
 		header: http.Header{},
 		buffer: new(bytes.Buffer),
+		code:   http.StatusOK,
 	}
 }
 
@@ -37,6 +38,34 @@ func (w *responseWriter) WriteHeader(status int) {
 	w.code = status
 }
 
+// Flush implements http.Flusher, the buffered response is only sent once the handler returns.
+func (w *responseWriter) Flush() {}
+
+// Log is where handlers write their logs, each write is sent to the runtime as a single log frame so that it is kept
+// apart from the response whatever bytes it holds.
+var Log io.Writer = &logWriter{out: os.Stdout}
+
+type logWriter struct {
+	out io.Writer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if err := frame.Write(w.out, frame.Log, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handler serves the requests of reactor modules, see Serve.
+var handler http.Handler
+
+// Serve registers h to serve the requests of a reactor module, built with -buildmode=c-shared. Its instances are
+// initialized once and kept warm by the runtime, each request calls the exported handle function rather than
+// running main, so Serve must be called from init.
+func Serve(h http.Handler) {
+	handler = h
+}
+
 // Handle unmarshal the marshaled request and process
 func Handle(h http.Handler) {
 	b, err := io.ReadAll(os.Stdin)
@@ -49,16 +78,13 @@ func Handle(h http.Handler) {
 		log.Fatalf("sdk: cannot unmarshal the proto request, err: %v", err)
 	}
 
-	w := newResponseWriter()
-	r, err := http.NewRequest(req.GetMethod(), req.GetUrl(), bytes.NewReader(req.GetBody()))
-	if err != nil {
-		log.Fatalf("sdk: cannot create http request from given proto request, err: %v", err)
-	}
-
-	for header, values := range req.GetHeader() {
-		r.Header[header] = values.Fields
+	if os.Getenv(streamingEnv) == "1" {
+		handleStream(h, req)
+		return
 	}
 
+	w := newResponseWriter()
+	r := newRequest(req, bytes.NewReader(req.GetBody()))
 	h.ServeHTTP(w, r)
 	// _, _ = io.Copy(os.Stdout, os.Stderr)
 
@@ -76,17 +102,31 @@ func Handle(h http.Handler) {
 		log.Fatalf("sdk: cannot handle marshal response")
 	}
 
-	written, err := os.Stdout.Write(bufBytes)
-	if err != nil {
-		log.Fatalf("sdk: cannot handle write response")
+	// the response is framed so that it could not be mixed up with the output of the handler.
+	if err := frame.Write(os.Stdout, frame.Response, bufBytes); err != nil {
+		log.Fatalf("sdk: cannot handle write response, err: %v", err)
 	}
+}
 
-	if written != len(bufBytes) {
-		log.Fatalf("sdk: given response with length: %d, written: %d", len(bufBytes), written)
+// handleStream serves the request with body read from the host, the response is flushed to the host as it is written.
+func handleStream(h http.Handler, req *pb.HTTPRequest) {
+	w := newStreamWriter()
+	r := newRequest(req, &bodyReader{})
+	h.ServeHTTP(w, r)
+	w.flush()
+	if w.err != nil {
+		log.Fatalf("sdk: cannot stream the response, err: %v", w.err)
 	}
+}
 
-	buf := make([]byte, 2)
-	binary.LittleEndian.PutUint16(buf, uint16(len(bufBytes)))
+func newRequest(req *pb.HTTPRequest, body io.Reader) *http.Request {
+	r, err := http.NewRequest(req.GetMethod(), req.GetUrl(), body)
+	if err != nil {
+		log.Fatalf("sdk: cannot create http request from given proto request, err: %v", err)
+	}
 
-	_, _ = os.Stdout.Write(buf)
+	for header, values := range req.GetHeader() {
+		r.Header[header] = values.Fields
+	}
+	return r
 }
@@ -1,8 +1,11 @@
 package sdk
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/hnimtadd/run/internal/frame"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,3 +21,17 @@ func Test_responseWriter_Header(t *testing.T) {
 	require.Contains(t, w.Header().Values(key), val)
 	require.Equal(t, w.Header().Get(key), val)
 }
+
+func Test_logWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := &logWriter{out: out}
+	n, err := w.Write([]byte("log with magic " + string(frame.Magic[:]) + "\n"))
+	require.Nil(t, err)
+	require.Equal(t, 20, n)
+	require.Nil(t, frame.Write(out, frame.Response, []byte("response")))
+
+	logs, body, err := frame.Parse(out.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, "response", string(body))
+	require.Equal(t, "log with magic "+string(frame.Magic[:])+"\n", string(logs))
+}
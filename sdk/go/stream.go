@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	pb "github.com/hnimtadd/run/pbs/gopb/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// streamingEnv is set to "1" by the runtime when the invocation is streamed.
+const streamingEnv = "RUN_STREAMING"
+
+// flushThreshold is the size of buffered response body after which streamWriter flushes on its own.
+const flushThreshold = 32 * 1024
+
+// bodyReader reads the request body from the host.
+type bodyReader struct {
+	eof bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.eof {
+		return 0, io.EOF
+	}
+	n, err := hostReadBody(p)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 && len(p) > 0 {
+		b.eof = true
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (b *bodyReader) Close() error {
+	return nil
+}
+
+// streamWriter is the http.ResponseWriter of a streamed invocation,
+// written body is sent to the host on Flush or when the buffer grows over flushThreshold.
+type streamWriter struct {
+	header      http.Header
+	buffer      *bytes.Buffer
+	code        int
+	headWritten bool
+	err         error
+}
+
+var _ http.Flusher = &streamWriter{}
+
+func newStreamWriter() *streamWriter {
+	return &streamWriter{
+		header: http.Header{},
+		buffer: new(bytes.Buffer),
+		code:   http.StatusOK,
+	}
+}
+
+func (w *streamWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *streamWriter) WriteHeader(status int) {
+	if w.headWritten {
+		return
+	}
+	w.code = status
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, _ := w.buffer.Write(b)
+	if w.buffer.Len() >= flushThreshold {
+		w.flush()
+	}
+	return n, w.err
+}
+
+// Flush implements http.Flusher.
+func (w *streamWriter) Flush() {
+	w.flush()
+}
+
+func (w *streamWriter) flush() {
+	if w.err != nil {
+		return
+	}
+	if !w.headWritten {
+		rsp := &pb.HTTPResponse{
+			Header: make(map[string]*pb.HeaderFields),
+			Code:   int32(w.code),
+		}
+		for key, value := range w.header {
+			rsp.Header[key] = &pb.HeaderFields{Fields: value}
+		}
+		b, err := proto.Marshal(rsp)
+		if err != nil {
+			w.err = err
+			return
+		}
+		if err := hostWriteHead(b); err != nil {
+			w.err = err
+			return
+		}
+		w.headWritten = true
+	}
+	if w.buffer.Len() == 0 {
+		return
+	}
+	if err := hostWriteBody(w.buffer.Bytes()); err != nil {
+		w.err = err
+		return
+	}
+	w.buffer.Reset()
+}